@@ -22,45 +22,208 @@ import (
 	"log"
 
 	"github.com/kelseyhightower/envconfig"
+	"go.uber.org/zap"
+
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/logging/logkey"
+	"knative.dev/pkg/metrics"
+	"knative.dev/pkg/tracing"
+	tracingconfig "knative.dev/pkg/tracing/config"
 
 	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
 	"github.com/triggermesh/bumblebee/pkg/pipeline"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/k8slookup"
 )
 
 type envConfig struct {
 	// Sink URL where to send cloudevents
 	Sink string `envconfig:"K_SINK"`
+	// Dead letter sink URL where to send events that could not be processed
+	DeadLetterSink string `envconfig:"DEAD_LETTER_SINK"`
 
 	// Transformation specifications
 	TransformationContext string `envconfig:"TRANSFORMATION_CONTEXT"`
 	TransformationData    string `envconfig:"TRANSFORMATION_DATA"`
+
+	// Binary data encoding specification
+	TransformationEncoding string `envconfig:"TRANSFORMATION_ENCODING"`
+	// Data validation specification
+	TransformationValidation string `envconfig:"TRANSFORMATION_VALIDATION"`
+	// Duplicate events detection specification
+	TransformationDeduplication string `envconfig:"TRANSFORMATION_DEDUPLICATION"`
+	// Persistent state store specification
+	TransformationState string `envconfig:"TRANSFORMATION_STATE"`
+	// Rate limiting specification
+	TransformationRateLimit string `envconfig:"TRANSFORMATION_RATELIMIT"`
+	// Sampling specification
+	TransformationSampling string `envconfig:"TRANSFORMATION_SAMPLING"`
+	// Sink delivery specification
+	TransformationDelivery string `envconfig:"TRANSFORMATION_DELIVERY"`
+	// Undelivered events buffer specification
+	TransformationBuffer string `envconfig:"TRANSFORMATION_BUFFER"`
+	// Default error policy of the operations
+	TransformationOnError string `envconfig:"TRANSFORMATION_ONERROR"`
+	// Payload logging specification
+	TransformationLogging string `envconfig:"TRANSFORMATION_LOGGING"`
+
+	// Transformation object reference that labels the metrics
+	Namespace string `envconfig:"NAMESPACE"`
+	Name      string `envconfig:"NAME"`
+	// Metrics exporter options
+	MetricsConfig string `envconfig:"K_METRICS_CONFIG"`
+	// Tracing exporter configuration
+	TracingConfig string `envconfig:"K_TRACING_CONFIG"`
+	// Logger configuration
+	LoggingConfig string `envconfig:"K_LOGGING_CONFIG"`
 }
 
+// loggerComponent is the name of the adapter logger
+// whose level is set by the "loglevel.transformation" key.
+const loggerComponent = "transformation"
+
 func main() {
 	var env envConfig
 	if err := envconfig.Process("", &env); err != nil {
 		log.Fatalf("Failed to process env var: %v", err)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	loggingConfig, err := logging.NewConfigFromMap(nil)
+	if env.LoggingConfig != "" {
+		loggingConfig, err = logging.JSONToConfig(env.LoggingConfig)
+	}
+	if err != nil {
+		log.Fatalf("Cannot unmarshal logging config variable: %v", err)
+	}
+	logger, _ := logging.NewLoggerFromConfig(loggingConfig, loggerComponent)
+	if env.Name != "" {
+		logger = logger.With(zap.String(logkey.Key, env.Namespace+"/"+env.Name))
+	}
+	defer func() {
+		_ = logger.Sync()
+	}()
+	zap.ReplaceGlobals(logger.Desugar())
+
+	ctx, cancel := context.WithCancel(logging.WithLogger(context.Background(), logger))
 	defer cancel()
 
+	if env.MetricsConfig != "" {
+		opts, err := metrics.JSONToOptions(env.MetricsConfig)
+		if err != nil {
+			logger.Fatalf("Cannot unmarshal metrics config variable: %v", err)
+		}
+		if err := metrics.UpdateExporter(ctx, *opts, logger); err != nil {
+			logger.Fatalf("Cannot set up metrics exporter: %v", err)
+		}
+		defer metrics.FlushExporter()
+	}
+
+	if env.TracingConfig != "" {
+		cfg, err := tracingconfig.JSONToTracingConfig(env.TracingConfig)
+		if err != nil {
+			logger.Fatalf("Cannot unmarshal tracing config variable: %v", err)
+		}
+		serviceName := "transformation"
+		if env.Name != "" {
+			serviceName = env.Name + "." + env.Namespace
+		}
+		if err := tracing.SetupStaticPublishing(logger, serviceName, cfg); err != nil {
+			logger.Fatalf("Cannot set up tracing exporter: %v", err)
+		}
+	}
+
 	trnContext, trnData := []v1alpha1.Transform{}, []v1alpha1.Transform{}
-	err := json.Unmarshal([]byte(env.TransformationContext), &trnContext)
+	err = json.Unmarshal([]byte(env.TransformationContext), &trnContext)
 	if err != nil {
-		log.Fatalf("Cannot unmarshal Context Transformation variable: %v", err)
+		logger.Fatalf("Cannot unmarshal Context Transformation variable: %v", err)
 	}
 	err = json.Unmarshal([]byte(env.TransformationData), &trnData)
 	if err != nil {
-		log.Fatalf("Cannot unmarshal Data Transformation variable: %v", err)
+		logger.Fatalf("Cannot unmarshal Data Transformation variable: %v", err)
+	}
+
+	var trnEncoding *v1alpha1.Encoding
+	if env.TransformationEncoding != "" {
+		if err := json.Unmarshal([]byte(env.TransformationEncoding), &trnEncoding); err != nil {
+			logger.Fatalf("Cannot unmarshal Encoding variable: %v", err)
+		}
+	}
+
+	var trnValidation *v1alpha1.Validation
+	if env.TransformationValidation != "" {
+		if err := json.Unmarshal([]byte(env.TransformationValidation), &trnValidation); err != nil {
+			logger.Fatalf("Cannot unmarshal Validation variable: %v", err)
+		}
+	}
+
+	var trnDedup *v1alpha1.Deduplication
+	if env.TransformationDeduplication != "" {
+		if err := json.Unmarshal([]byte(env.TransformationDeduplication), &trnDedup); err != nil {
+			logger.Fatalf("Cannot unmarshal Deduplication variable: %v", err)
+		}
+	}
+
+	var trnState *v1alpha1.State
+	if env.TransformationState != "" {
+		if err := json.Unmarshal([]byte(env.TransformationState), &trnState); err != nil {
+			logger.Fatalf("Cannot unmarshal State variable: %v", err)
+		}
+	}
+
+	var trnRateLimit *v1alpha1.RateLimit
+	if env.TransformationRateLimit != "" {
+		if err := json.Unmarshal([]byte(env.TransformationRateLimit), &trnRateLimit); err != nil {
+			logger.Fatalf("Cannot unmarshal RateLimit variable: %v", err)
+		}
+	}
+
+	var trnSampling *v1alpha1.Sampling
+	if env.TransformationSampling != "" {
+		if err := json.Unmarshal([]byte(env.TransformationSampling), &trnSampling); err != nil {
+			logger.Fatalf("Cannot unmarshal Sampling variable: %v", err)
+		}
+	}
+
+	var trnDelivery *v1alpha1.Delivery
+	if env.TransformationDelivery != "" {
+		if err := json.Unmarshal([]byte(env.TransformationDelivery), &trnDelivery); err != nil {
+			logger.Fatalf("Cannot unmarshal Delivery variable: %v", err)
+		}
+	}
+
+	var trnLogging *v1alpha1.Logging
+	if env.TransformationLogging != "" {
+		if err := json.Unmarshal([]byte(env.TransformationLogging), &trnLogging); err != nil {
+			logger.Fatalf("Cannot unmarshal Logging variable: %v", err)
+		}
+	}
+
+	var trnBuffer *v1alpha1.Buffer
+	if env.TransformationBuffer != "" {
+		if err := json.Unmarshal([]byte(env.TransformationBuffer), &trnBuffer); err != nil {
+			logger.Fatalf("Cannot unmarshal Buffer variable: %v", err)
+		}
 	}
 
-	handler, err := pipeline.NewHandler(trnContext, trnData)
+	handler, err := pipeline.NewHandler(trnContext, trnData,
+		pipeline.Encoding(trnEncoding),
+		pipeline.Validation(trnValidation),
+		pipeline.DeadLetterSink(env.DeadLetterSink),
+		pipeline.Deduplication(trnDedup),
+		pipeline.State(trnState),
+		pipeline.Kubernetes(k8slookup.NewClient(env.Namespace, nil, nil)),
+		pipeline.RateLimit(trnRateLimit),
+		pipeline.Sampling(trnSampling),
+		pipeline.Delivery(trnDelivery),
+		pipeline.Buffer(trnBuffer),
+		pipeline.OnError(env.TransformationOnError),
+		pipeline.Name(env.Namespace, env.Name),
+		pipeline.Logging(trnLogging),
+	)
 	if err != nil {
-		log.Fatalf("Cannot create transformation handler: %v", err)
+		logger.Fatalf("Cannot create transformation handler: %v", err)
 	}
 
 	if err := handler.Start(ctx, env.Sink); err != nil {
-		log.Fatalf("Transformation handler: %v", err)
+		logger.Fatalf("Transformation handler: %v", err)
 	}
 }
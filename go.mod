@@ -4,9 +4,21 @@ go 1.14
 
 require (
 	github.com/cloudevents/sdk-go/v2 v2.2.0
+	github.com/dop251/goja v0.0.0-20230812105242-81d76064690d
+	github.com/fxamacker/cbor/v2 v2.5.0
+	github.com/google/cel-go v0.12.7
+	github.com/itchyny/gojq v0.12.13
 	github.com/kelseyhightower/envconfig v1.4.0
+	github.com/linkedin/goavro/v2 v2.10.1
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
 	github.com/stretchr/testify v1.7.0
+	github.com/tetratelabs/wazero v1.5.0
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	go.etcd.io/bbolt v1.3.5
+	go.opencensus.io v0.23.0
 	go.uber.org/zap v1.17.0
+	golang.org/x/time v0.0.0-20210220033141-f8bda1e9f3ba
+	google.golang.org/protobuf v1.28.0
 	k8s.io/api v0.19.7
 	k8s.io/apimachinery v0.19.7
 	k8s.io/client-go v0.19.7
@@ -16,4 +28,5 @@ require (
 	knative.dev/serving v0.22.2
 	sigs.k8s.io/structured-merge-diff v1.0.1-0.20191108220359-b1b620dd3f06 // indirect
 	sigs.k8s.io/structured-merge-diff/v3 v3.0.0 // indirect
+	sigs.k8s.io/yaml v1.2.0
 )
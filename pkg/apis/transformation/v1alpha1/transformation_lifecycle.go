@@ -48,6 +48,14 @@ func (ts *TransformationStatus) MarkServiceUnavailable(name string) {
 		"Service %q is not ready.", name)
 }
 
+// MarkResourceNotOwned marks Transformation as not ready with NotOwned reason.
+func (ts *TransformationStatus) MarkResourceNotOwned(kind, name string) {
+	condSet.Manage(ts).MarkFalse(
+		TransformationConditionReady,
+		"NotOwned",
+		"There is an existing %s %q that the Transformation does not own.", kind, name)
+}
+
 // MarkServiceAvailable sets Transformation condition to ready.
 func (ts *TransformationStatus) MarkServiceAvailable() {
 	condSet.Manage(ts).MarkTrue(TransformationConditionReady)
@@ -17,7 +17,10 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"knative.dev/pkg/apis"
 	duckv1 "knative.dev/pkg/apis/duck/v1"
 	"knative.dev/pkg/kmeta"
@@ -60,18 +63,475 @@ type TransformationSpec struct {
 	Context []Transform `json:"context,omitempty"`
 	// Data contains Transformations that must be applied on CE Data
 	Data []Transform `json:"data,omitempty"`
+	// Encoding describes how non-JSON CE Data is decoded before
+	// the transformation and encoded afterwards.
+	// +optional
+	Encoding *Encoding `json:"encoding,omitempty"`
+	// Validation contains JSON Schemas of incoming and transformed CE Data.
+	// +optional
+	Validation *Validation `json:"validation,omitempty"`
+	// DeadLetterSink is a reference to an object that will resolve to a uri
+	// to use as the destination of events that could not be processed.
+	// +optional
+	DeadLetterSink *duckv1.Destination `json:"deadLetterSink,omitempty"`
+	// Deduplication drops events that were received before.
+	// +optional
+	Deduplication *Deduplication `json:"deduplication,omitempty"`
+	// State is the store of the values that persist across events.
+	// +optional
+	State *State `json:"state,omitempty"`
+	// RateLimit limits the number of transformed events per second.
+	// +optional
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+	// Sampling forwards a part of the events.
+	// +optional
+	Sampling *Sampling `json:"sampling,omitempty"`
+	// Delivery configures how transformed events are sent to the sink.
+	// +optional
+	Delivery *Delivery `json:"delivery,omitempty"`
+	// Buffer keeps events that could not be delivered on disk
+	// and replays them when the sink recovers.
+	// +optional
+	Buffer *Buffer `json:"buffer,omitempty"`
+	// OnError is the default error policy of the operations, one of
+	// "fail", "skip" or "continue". Defaults to "fail". See the error
+	// policy constants for their semantics.
+	// +optional
+	OnError string `json:"onError,omitempty"`
+	// Logging configures the debug logs of the event payloads.
+	// +optional
+	Logging *Logging `json:"logging,omitempty"`
+}
+
+// Deduplication describes how repeated events are detected. Events are
+// identified by "source" and "id" attributes unless a path or an expression
+// is set.
+type Deduplication struct {
+	// Path is a CE Data path with the event key.
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Expression is a CEL expression over "context", "data" and "vars"
+	// that returns the event key.
+	// +optional
+	Expression string `json:"expression,omitempty"`
+	// Window is how long the keys are remembered, defaults to 10m.
+	// +optional
+	Window *metav1.Duration `json:"window,omitempty"`
+	// Size is the maximum number of remembered keys, defaults to 10000.
+	// +optional
+	Size int `json:"size,omitempty"`
+}
+
+// Error policies of the operations.
+const (
+	// OnErrorFail fails the event transformation.
+	OnErrorFail = "fail"
+	// OnErrorSkip stops the failed Context or Data transformation:
+	// none of the operations declared after the failed one run, and
+	// the document is passed on with the changes made before the
+	// failure. Store operations run first, so the failed one only
+	// stops the remaining store operations of its section.
+	OnErrorSkip = "skip"
+	// OnErrorContinue ignores the failed operation.
+	OnErrorContinue = "continue"
+)
+
+// Buffer describes the on-disk queue of events that could not be delivered.
+type Buffer struct {
+	// PersistentVolumeClaim is the name of the claim the events are stored
+	// on. They are stored on an emptyDir volume of the adapter pod if empty.
+	// +optional
+	PersistentVolumeClaim string `json:"persistentVolumeClaim,omitempty"`
+	// MaxEvents is the maximum number of buffered events, defaults to 10000.
+	// +optional
+	MaxEvents int `json:"maxEvents,omitempty"`
+	// MaxSize is the maximum size of the buffer file, defaults to 100Mi.
+	// +optional
+	MaxSize *resource.Quantity `json:"maxSize,omitempty"`
+}
+
+// Backoff policies of the delivery retries.
+const (
+	// BackoffPolicyLinear multiplies the delay by the retry number.
+	BackoffPolicyLinear = "linear"
+	// BackoffPolicyExponential doubles the delay with each retry.
+	BackoffPolicyExponential = "exponential"
+)
+
+// Delivery describes how failed deliveries to the sink are retried.
+// Events that could not be delivered are sent to the dead letter sink.
+type Delivery struct {
+	// Retry is the number of retries after the failed delivery.
+	// +optional
+	Retry int32 `json:"retry,omitempty"`
+	// BackoffPolicy is one of "linear" or "exponential".
+	// Defaults to "exponential".
+	// +optional
+	BackoffPolicy string `json:"backoffPolicy,omitempty"`
+	// BackoffDelay is the delay before the first retry, defaults to 1s.
+	// The delays of the next retries are capped at 5m.
+	// +optional
+	BackoffDelay *metav1.Duration `json:"backoffDelay,omitempty"`
+	// Timeout limits the duration of each delivery attempt.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// RetryableCodes are HTTP response codes of the sink that are
+	// retried, defaults to 408, 429 and 5xx. Connection errors
+	// are always retried.
+	// +optional
+	RetryableCodes []int `json:"retryableCodes,omitempty"`
+	// CircuitBreaker stops sending events to the failing sink.
+	// +optional
+	CircuitBreaker *CircuitBreaker `json:"circuitBreaker,omitempty"`
+}
+
+// CircuitBreaker describes when deliveries fail without calling the sink.
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failed delivery
+	// attempts, retries included, that open the circuit, defaults to 5.
+	// +optional
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	// OpenDuration is how long deliveries fail before a trial
+	// delivery is made, defaults to 30s.
+	// +optional
+	OpenDuration *metav1.Duration `json:"openDuration,omitempty"`
+}
+
+// Policies for events that exceed the rate limit.
+const (
+	// RateLimitReject responds with "429 Too Many Requests" so that
+	// the event is redelivered according to the sender's retry policy.
+	RateLimitReject = "reject"
+	// RateLimitDrop acknowledges the event without transforming it.
+	RateLimitDrop = "drop"
+)
+
+// RateLimit describes the token bucket that limits the event rate.
+type RateLimit struct {
+	// Rate is the number of events per second.
+	Rate int `json:"rate"`
+	// Burst is the number of events that can be transformed at once,
+	// defaults to the rate.
+	// +optional
+	Burst int `json:"burst,omitempty"`
+	// Path is a CE Data path with the key, events with different
+	// keys are limited separately.
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Policy is one of "reject" or "drop". Defaults to "reject".
+	// +optional
+	Policy string `json:"policy,omitempty"`
+}
+
+// Sampling describes the part of the events that is forwarded.
+type Sampling struct {
+	// Percentage of the events that are forwarded. Events are
+	// selected by the hash of their "id" attribute so that
+	// redelivered events get the same decision.
+	Percentage int `json:"percentage"`
+}
+
+// Logging describes the event payloads that are logged at the debug level.
+type Logging struct {
+	// Percentage of the events whose payloads are logged, selected
+	// by the hash of their "id" attribute. Defaults to 100.
+	// +optional
+	Percentage *int `json:"percentage,omitempty"`
+	// Redact are the CE data paths whose values are hidden
+	// in the logged payloads.
+	// +optional
+	Redact []string `json:"redact,omitempty"`
+}
+
+// State store backends.
+const (
+	// StateMemory keeps the values until the adapter is restarted.
+	StateMemory = "memory"
+	// StateFile keeps the values in an embedded key-value database file.
+	StateFile = "file"
+)
+
+// State describes where "increment", "setState" and "getState"
+// operations keep their values.
+type State struct {
+	// Backend is one of "memory" or "file", defaults to "memory".
+	// +optional
+	Backend string `json:"backend,omitempty"`
+	// Path is the database file of the "file" backend. It must be
+	// on a persistent volume for the values to survive pod restarts.
+	// +optional
+	Path string `json:"path,omitempty"`
+	// PersistentVolumeClaim is the name of the claim mounted at the
+	// directory of the Path. The file is opened by one pod at a time.
+	// +optional
+	PersistentVolumeClaim string `json:"persistentVolumeClaim,omitempty"`
+}
+
+// Policies for CE Data that does not match JSON Schema.
+const (
+	// ValidationReject fails the event transformation.
+	ValidationReject = "reject"
+	// ValidationDeadLetter sends the event to the dead letter sink.
+	ValidationDeadLetter = "deadLetter"
+	// ValidationAnnotate adds "validationerror" extension to the event.
+	ValidationAnnotate = "annotate"
+)
+
+// Validation describes how CE Data is checked against JSON Schemas.
+type Validation struct {
+	// Input is the schema of incoming CE Data.
+	// +optional
+	Input *JSONSchema `json:"input,omitempty"`
+	// Output is the schema of transformed CE Data. Its "$id"
+	// is set as "dataschema" attribute of the resulting event.
+	// +optional
+	Output *JSONSchema `json:"output,omitempty"`
+	// Policy is one of "reject", "deadLetter" or "annotate".
+	// Defaults to "reject".
+	// +optional
+	Policy string `json:"policy,omitempty"`
+}
+
+// JSONSchema is a JSON Schema document declared inline or stored in a ConfigMap.
+type JSONSchema struct {
+	// Inline is a JSON Schema document.
+	// +optional
+	Inline string `json:"inline,omitempty"`
+	// ConfigMapKeyRef is a ConfigMap key that contains a JSON Schema document.
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+}
+
+// Encoding contains schemas of binary CE Data formats.
+type Encoding struct {
+	// Output is the content type of transformed CE Data, i.e. "application/cbor".
+	// If empty, Data is sent as JSON or encoded with the output schema.
+	// +optional
+	Output string `json:"output,omitempty"`
+	// Protobuf is used to decode "application/protobuf" CE Data.
+	// +optional
+	Protobuf *ProtobufSchema `json:"protobuf,omitempty"`
+	// Avro is used to decode "application/avro" CE Data.
+	// +optional
+	Avro *AvroSchema `json:"avro,omitempty"`
+	// Unsupported sets the policy for CE Data that cannot be decoded.
+	// Events with unsupported Data are rejected by default.
+	// +optional
+	Unsupported *UnsupportedData `json:"unsupported,omitempty"`
+}
+
+// Policies for CE Data with unsupported content type.
+const (
+	// UnsupportedDataReject fails the event transformation.
+	UnsupportedDataReject = "reject"
+	// UnsupportedDataPass applies Context transformations and keeps Data unchanged.
+	UnsupportedDataPass = "pass"
+	// UnsupportedDataWrap wraps Data as a base64 string into the JSON object.
+	UnsupportedDataWrap = "wrap"
+)
+
+// UnsupportedData describes what to do with CE Data that cannot be decoded.
+type UnsupportedData struct {
+	// Policy is one of "reject", "pass" or "wrap".
+	Policy string `json:"policy"`
+	// Key is a JSON key that holds base64 encoded Data in "wrap" mode.
+	// Defaults to "data".
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// ProtobufSchema references protobuf message descriptors stored in a ConfigMap.
+type ProtobufSchema struct {
+	// DescriptorSet is a ConfigMap key that contains serialized FileDescriptorSet,
+	// i.e. the output of "protoc --include_imports --descriptor_set_out".
+	DescriptorSet corev1.ConfigMapKeySelector `json:"descriptorSet"`
+	// MessageType is a fully qualified name of the incoming message.
+	MessageType string `json:"messageType"`
+	// OutputMessageType is a fully qualified name of the message used
+	// to encode transformed data. Data is sent as JSON if empty.
+	// +optional
+	OutputMessageType string `json:"outputMessageType,omitempty"`
+}
+
+// AvroSchema references Avro schemas stored in a ConfigMap.
+type AvroSchema struct {
+	// Schema is a ConfigMap key that contains the schema of incoming data.
+	Schema corev1.ConfigMapKeySelector `json:"schema"`
+	// OutputSchema is a ConfigMap key that contains the schema used
+	// to encode transformed data. Data is sent as JSON if empty.
+	// +optional
+	OutputSchema *corev1.ConfigMapKeySelector `json:"outputSchema,omitempty"`
 }
 
 // Transform describes transformation schemes for different CE types.
 type Transform struct {
 	Operation string `json:"operation"`
 	Paths     []Path `json:"paths"`
+	// Condition is a CEL expression over "context", "data" and "vars"
+	// that must return true for the operation to be applied.
+	// +optional
+	Condition string `json:"condition,omitempty"`
+	// OnError is the policy for the failed operation, one of "fail",
+	// "skip" or "continue". Defaults to the Transformation "onError".
+	// "skip" does not run any of the next operations of the section.
+	// +optional
+	OnError string `json:"onError,omitempty"`
+	// Lookup is the table used by "lookup" operation.
+	// +optional
+	Lookup *LookupTable `json:"lookup,omitempty"`
+	// Enrich is the HTTP request performed by "enrich" operation.
+	// +optional
+	Enrich *EnrichRequest `json:"enrich,omitempty"`
+	// K8sLookup is the Kubernetes object fetched by "k8slookup" operation.
+	// +optional
+	K8sLookup *KubernetesObject `json:"k8sLookup,omitempty"`
+	// Increment sets the step of "increment" operation.
+	// +optional
+	Increment *Increment `json:"increment,omitempty"`
+	// Script sets the limits of "script" operation.
+	// +optional
+	Script *ScriptLimits `json:"script,omitempty"`
+	// Wasm sets the limits of "wasm" operation.
+	// +optional
+	Wasm *WasmLimits `json:"wasm,omitempty"`
+}
+
+// ScriptLimits bound the resources that "script" operation
+// may use to transform an event.
+type ScriptLimits struct {
+	// Timeout limits the execution time, defaults to 1s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// MaxCallStackSize limits the recursion depth, defaults to 1024.
+	// +optional
+	MaxCallStackSize int `json:"maxCallStackSize,omitempty"`
+	// MaxResultSize limits the approximate size of the value
+	// returned by the function, defaults to 64Mi.
+	// +optional
+	MaxResultSize *resource.Quantity `json:"maxResultSize,omitempty"`
+}
+
+// WasmLimits bound the resources that "wasm" operation
+// may use to transform an event.
+type WasmLimits struct {
+	// Timeout limits the execution time per call, defaults to 1s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// MaxMemory limits the memory of each module instance, rounded
+	// up to 64Ki pages, defaults to 16Mi.
+	// +optional
+	MaxMemory *resource.Quantity `json:"maxMemory,omitempty"`
+	// PoolSize is the number of module instances, defaults to 4.
+	// +optional
+	PoolSize int `json:"poolSize,omitempty"`
+}
+
+// Increment describes how much "increment" operation
+// adds to the counter.
+type Increment struct {
+	// By is a number, a path or a variable with the number
+	// that is added to the counter, defaults to 1.
+	// +optional
+	By string `json:"by,omitempty"`
+}
+
+// KubernetesObject identifies the object that is fetched with
+// the adapter service account.
+type KubernetesObject struct {
+	// APIVersion of the object, i.e. "apps/v1".
+	APIVersion string `json:"apiVersion"`
+	// Kind of the object, i.e. "Deployment", one of LookupKinds.
+	Kind string `json:"kind"`
+	// Namespace is a path or a variable with the object namespace,
+	// defaults to the namespace of the Transformation. Objects in
+	// other namespaces are not read.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// Name is a path or a variable with the object name.
+	Name string `json:"name"`
+}
+
+// LookupKinds are the kinds that "k8slookup" operation can fetch.
+// The controller grants the adapter access to them, so it must hold
+// the same permissions itself. Kinds with sensitive content, such as
+// Secrets, and cluster scoped kinds are not allowed.
+var LookupKinds = map[schema.GroupKind]bool{
+	{Group: "", Kind: "ConfigMap"}:                  true,
+	{Group: "", Kind: "Endpoints"}:                  true,
+	{Group: "", Kind: "PersistentVolumeClaim"}:      true,
+	{Group: "", Kind: "Pod"}:                        true,
+	{Group: "", Kind: "Service"}:                    true,
+	{Group: "", Kind: "ServiceAccount"}:             true,
+	{Group: "apps", Kind: "DaemonSet"}:              true,
+	{Group: "apps", Kind: "Deployment"}:             true,
+	{Group: "apps", Kind: "ReplicaSet"}:             true,
+	{Group: "apps", Kind: "StatefulSet"}:            true,
+	{Group: "batch", Kind: "CronJob"}:               true,
+	{Group: "batch", Kind: "Job"}:                   true,
+	{Group: "serving.knative.dev", Kind: "Service"}: true,
+}
+
+// EnrichRequest describes the HTTP request whose JSON response
+// is added to the event. Pipeline variables in the URL, the headers
+// and the body are replaced with their values.
+type EnrichRequest struct {
+	// Method is the HTTP method, defaults to "GET".
+	// +optional
+	Method string `json:"method,omitempty"`
+	// URL is the request URL.
+	URL string `json:"url"`
+	// Headers are the request headers.
+	// +optional
+	Headers map[string]string `json:"headers,omitempty"`
+	// Body is the request body. Variable values
+	// are escaped for JSON strings.
+	// +optional
+	Body string `json:"body,omitempty"`
+	// Timeout limits the duration of each attempt, defaults to 5s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// Retries is the number of attempts after the failed one,
+	// only GET and HEAD requests can be retried.
+	// +optional
+	Retries int `json:"retries,omitempty"`
+	// CacheTTL is how long the responses are reused for the same
+	// requests. Responses are not cached if empty.
+	// +optional
+	CacheTTL *metav1.Duration `json:"cacheTTL,omitempty"`
+}
+
+// LookupTable maps values to the results.
+type LookupTable struct {
+	// Table is an inline map of values to the results.
+	// +optional
+	Table map[string]string `json:"table,omitempty"`
+	// ConfigMapKeyRef is a ConfigMap key that contains YAML or JSON map of
+	// values to the results. Its entries override the inline table ones.
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+	// Default is the result for the values missing in the table.
+	// If not set, the missing values are kept as is.
+	// +optional
+	Default *string `json:"default,omitempty"`
+	// DropOnMiss drops the events with the values missing in the table.
+	// +optional
+	DropOnMiss bool `json:"dropOnMiss,omitempty"`
 }
 
 // Path is a key-value pair that represents JSON object path
 type Path struct {
 	Key   string `json:"key,omitempty"`
 	Value string `json:"value,omitempty"`
+	// ValueFrom is a source of the value that is too large
+	// to be declared inline, i.e. a script.
+	// +optional
+	ValueFrom *ValueSource `json:"valueFrom,omitempty"`
+}
+
+// ValueSource references the Path value stored outside of the spec.
+type ValueSource struct {
+	// ConfigMapKeyRef is a ConfigMap key that contains the value.
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
 }
 
 const (
@@ -87,6 +547,10 @@ type TransformationStatus struct {
 	// Address holds the information needed to connect this Addressable up to receive events.
 	// +optional
 	Address *duckv1.Addressable `json:"address,omitempty"`
+
+	// DeadLetterSinkURI is the resolved URI of the dead letter sink.
+	// +optional
+	DeadLetterSinkURI *apis.URL `json:"deadLetterSinkUri,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -0,0 +1,192 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/zap"
+
+	"knative.dev/pkg/logging"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/queue"
+)
+
+const (
+	defaultBufferEvents = 10000
+	defaultBufferSize   = 100 << 20
+)
+
+// ReplayInterval is the delay before the next attempt
+// to replay buffered events to the unavailable sink.
+var ReplayInterval = 5 * time.Second
+
+// buffer keeps undelivered events on disk.
+type buffer struct {
+	queue *queue.File
+	stats *statsReporter
+	// notify wakes up the replay of the empty buffer.
+	notify chan struct{}
+}
+
+// Buffer stores events that could not be delivered because the sink
+// is unavailable, and replays them in order when it recovers.
+func Buffer(b *v1alpha1.Buffer) Option {
+	return func(h *Handler) error {
+		if b == nil {
+			return nil
+		}
+
+		maxEvents := b.MaxEvents
+		if maxEvents <= 0 {
+			maxEvents = defaultBufferEvents
+		}
+		maxSize := int64(defaultBufferSize)
+		if b.MaxSize != nil {
+			maxSize = b.MaxSize.Value()
+		}
+
+		q, err := queue.Open(queue.MountPath, maxEvents, maxSize)
+		if err != nil {
+			return fmt.Errorf("cannot open event buffer: %w", err)
+		}
+
+		h.buffer = &buffer{
+			queue:  q,
+			stats:  h.stats,
+			notify: make(chan struct{}, 1),
+		}
+		return nil
+	}
+}
+
+// pending returns true if there are events to replay.
+func (b *buffer) pending() bool {
+	return b.queue.Len() != 0
+}
+
+func (b *buffer) push(ctx context.Context, event cloudevents.Event) error {
+	record, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := b.queue.Push(record); err != nil {
+		return err
+	}
+	b.report()
+
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// report records the buffer depth.
+func (b *buffer) report() {
+	b.stats.reportBuffer(int64(b.queue.Len()), b.queue.Size())
+}
+
+// bufferEvent stores the event for the replay. Events
+// that do not fit into the buffer are dead-lettered.
+func (t *Handler) bufferEvent(ctx context.Context, event cloudevents.Event) error {
+	if err := t.buffer.push(ctx, event); err != nil {
+		logging.FromContext(ctx).Errorw("Cannot buffer event", zap.Error(err))
+		return t.deadLetter(ctx, event, fmt.Errorf("cannot buffer event: %w", err))
+	}
+	logging.FromContext(ctx).Infof("Buffered event (%d buffered)", t.buffer.queue.Len())
+	return nil
+}
+
+// replay sends buffered events to the sink in the context
+// until the context is done.
+func (t *Handler) replay(ctx context.Context) {
+	t.buffer.report()
+	if n := t.buffer.queue.Len(); n != 0 {
+		logging.FromContext(ctx).Infof("Found %d buffered events", n)
+	}
+	for {
+		if !t.buffer.pending() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.buffer.notify:
+			}
+			continue
+		}
+
+		if !t.replayNext(ctx) {
+			if err := wait(ctx, ReplayInterval); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// replayNext sends the first buffered event and returns
+// false if the sink is still unavailable. Events that the sink
+// rejects are dead-lettered, or dropped if that fails too.
+func (t *Handler) replayNext(ctx context.Context) bool {
+	record, err := t.buffer.queue.Peek()
+	if err != nil {
+		logging.FromContext(ctx).Errorw("Cannot read buffered event", zap.Error(err))
+		return t.popBuffer(ctx)
+	}
+	var event cloudevents.Event
+	if err := json.Unmarshal(record, &event); err != nil {
+		logging.FromContext(ctx).Errorw("Cannot decode buffered event", zap.Error(err))
+		return t.popBuffer(ctx)
+	}
+
+	ctx = logging.WithLogger(ctx, eventLogger(ctx, event))
+	logger := logging.FromContext(ctx)
+
+	ctx, span := startSpan(ctx, replaySpanName, event)
+	defer span.End()
+
+	result := t.send(ctx, event)
+	spanError(span, result)
+	switch {
+	case cloudevents.IsACK(result):
+		logger.Debug("Replayed buffered event")
+	case t.unavailable(result):
+		logger.Infow("Sink is still unavailable", zap.Error(result))
+		return false
+	default:
+		if err := t.deadLetter(ctx, event, fmt.Errorf("cannot deliver event: %w", result)); err != nil {
+			// the failure is not retryable, keeping the event
+			// would block the replay of the following ones
+			logger.Errorw("Dropping buffered event that cannot be delivered", zap.Error(err))
+			t.stats.reportBufferDropped()
+		}
+	}
+	return t.popBuffer(ctx)
+}
+
+func (t *Handler) popBuffer(ctx context.Context) bool {
+	if err := t.buffer.queue.Pop(); err != nil {
+		logging.FromContext(ctx).Errorw("Cannot remove buffered event", zap.Error(err))
+		return false
+	}
+	t.buffer.report()
+	return true
+}
@@ -0,0 +1,230 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/linkedin/goavro/v2"
+
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+)
+
+var _ Codec = (*Avro)(nil)
+
+// Avro decodes and encodes binary Avro data of a single schema.
+type Avro struct {
+	codec  *goavro.Codec
+	schema interface{}
+	// named types of the schema by their full names
+	types map[string]map[string]interface{}
+}
+
+// NewAvro parses the schema and returns a Codec for it.
+func NewAvro(schema []byte) (*Avro, error) {
+	codec, err := goavro.NewCodec(string(schema))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse Avro schema: %w", err)
+	}
+	var s interface{}
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return nil, fmt.Errorf("cannot parse Avro schema: %w", err)
+	}
+	a := &Avro{
+		codec:  codec,
+		schema: s,
+		types:  make(map[string]map[string]interface{}),
+	}
+	a.register(s, "")
+	return a, nil
+}
+
+// ContentType returns the content type of Avro encoded data.
+func (a *Avro) ContentType() string {
+	return ApplicationAvro
+}
+
+// Decode converts binary Avro data into the JSON tree. The tree follows
+// Avro JSON encoding, i.e. union values are wrapped in {"type": value} objects.
+func (a *Avro) Decode(data []byte) (interface{}, error) {
+	native, _, err := a.codec.NativeFromBinary(data)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonData, err := a.codec.TextualFromNative(nil, native)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := convert.Decode(jsonData)
+	if err != nil {
+		return nil, err
+	}
+	// record fields are written in random order,
+	// the tree keeps them in the schema order
+	return a.order(a.schema, "", tree), nil
+}
+
+// Encode converts the JSON tree into binary Avro data.
+func (a *Avro) Encode(tree interface{}) ([]byte, error) {
+	jsonData, err := convert.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	native, _, err := a.codec.NativeFromTextual(jsonData)
+	if err != nil {
+		return nil, err
+	}
+	return a.codec.BinaryFromNative(nil, native)
+}
+
+// register stores the named types defined in the schema.
+func (a *Avro) register(schema interface{}, namespace string) {
+	switch s := schema.(type) {
+	case []interface{}:
+		for _, branch := range s {
+			a.register(branch, namespace)
+		}
+	case map[string]interface{}:
+		switch s["type"] {
+		case "record", "error", "enum", "fixed":
+			name, namespace := avroName(s, namespace)
+			a.types[name] = s
+			fields, _ := s["fields"].([]interface{})
+			for _, f := range fields {
+				if field, ok := f.(map[string]interface{}); ok {
+					a.register(field["type"], namespace)
+				}
+			}
+		case "array":
+			a.register(s["items"], namespace)
+		case "map":
+			a.register(s["values"], namespace)
+		default:
+			a.register(s["type"], namespace)
+		}
+	}
+}
+
+// order rebuilds the objects of the tree that follows
+// the schema with record fields in their schema order.
+func (a *Avro) order(schema interface{}, namespace string, tree interface{}) interface{} {
+	switch s := schema.(type) {
+	case string:
+		if _, t, ok := a.lookup(s, namespace); ok {
+			return a.order(t, namespace, tree)
+		}
+	case []interface{}:
+		// union values are wrapped in {"type": value} objects
+		object, ok := tree.(*convert.Object)
+		if !ok || object.Len() != 1 {
+			return tree
+		}
+		key := object.Keys()[0]
+		value, _ := object.Get(key)
+		for _, branch := range s {
+			if a.typeName(branch, namespace) == key {
+				object.Set(key, a.order(branch, namespace, value))
+			}
+		}
+	case map[string]interface{}:
+		switch s["type"] {
+		case "record", "error":
+			object, ok := tree.(*convert.Object)
+			if !ok {
+				return tree
+			}
+			_, namespace := avroName(s, namespace)
+			ordered := convert.NewObject()
+			fields, _ := s["fields"].([]interface{})
+			for _, f := range fields {
+				field, _ := f.(map[string]interface{})
+				name, _ := field["name"].(string)
+				if value, ok := object.Get(name); ok {
+					ordered.Set(name, a.order(field["type"], namespace, value))
+				}
+			}
+			return ordered
+		case "array":
+			if items, ok := tree.([]interface{}); ok {
+				for i, item := range items {
+					items[i] = a.order(s["items"], namespace, item)
+				}
+			}
+		case "map":
+			if object, ok := tree.(*convert.Object); ok {
+				for _, k := range object.Keys() {
+					value, _ := object.Get(k)
+					object.Set(k, a.order(s["values"], namespace, value))
+				}
+			}
+		case "enum", "fixed":
+		default:
+			return a.order(s["type"], namespace, tree)
+		}
+	}
+	return tree
+}
+
+// avroName returns the full name of the named type
+// and the namespace of the types that it encloses.
+func avroName(schema map[string]interface{}, namespace string) (string, string) {
+	name, _ := schema["name"].(string)
+	if ns, ok := schema["namespace"].(string); ok && !strings.Contains(name, ".") {
+		namespace = ns
+	}
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name, name[:i]
+	}
+	if namespace == "" {
+		return name, namespace
+	}
+	return namespace + "." + name, namespace
+}
+
+// lookup returns the full name and the schema of the named type
+// referenced by the name in the namespace.
+func (a *Avro) lookup(name, namespace string) (string, map[string]interface{}, bool) {
+	if namespace != "" && !strings.Contains(name, ".") {
+		if t, ok := a.types[namespace+"."+name]; ok {
+			return namespace + "." + name, t, true
+		}
+	}
+	t, ok := a.types[name]
+	return name, t, ok
+}
+
+// typeName returns the name that wraps the union value of the type.
+func (a *Avro) typeName(schema interface{}, namespace string) string {
+	switch s := schema.(type) {
+	case string:
+		name, _, _ := a.lookup(s, namespace)
+		return name
+	case map[string]interface{}:
+		switch s["type"] {
+		case "record", "error", "enum", "fixed":
+			name, _ := avroName(s, namespace)
+			return name
+		}
+		return a.typeName(s["type"], namespace)
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package codec
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+)
+
+var _ Codec = (*Base64)(nil)
+
+// Base64 wraps data of any format into the JSON object
+// as a base64 string value of the Key.
+type Base64 struct {
+	Key string
+}
+
+// ContentType returns the content type of arbitrary binary data.
+func (b *Base64) ContentType() string {
+	return ApplicationOctetStream
+}
+
+// Decode wraps data into the JSON tree.
+func (b *Base64) Decode(data []byte) (interface{}, error) {
+	object := convert.NewObject()
+	object.Set(b.Key, base64.StdEncoding.EncodeToString(data))
+	return object, nil
+}
+
+// Encode extracts data from the JSON tree.
+func (b *Base64) Encode(tree interface{}) ([]byte, error) {
+	object, ok := tree.(*convert.Object)
+	if !ok {
+		return nil, fmt.Errorf("data is not an object")
+	}
+	value, _ := object.Get(b.Key)
+	encoded, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("key %q is not a string", b.Key)
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
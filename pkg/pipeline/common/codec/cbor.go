@@ -0,0 +1,168 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package codec
+
+import (
+	"encoding/binary"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+var _ Codec = (*CBOR)(nil)
+
+// CBOR decodes and encodes Concise Binary Object Representation data.
+type CBOR struct{}
+
+// ContentType returns the content type of CBOR encoded data.
+func (c *CBOR) ContentType() string {
+	return ApplicationCBOR
+}
+
+// CBOR major types that contain other data items.
+const (
+	cborArray = 4
+	cborMap   = 5
+	cborTag   = 6
+)
+
+// cborBreak terminates indefinite-length arrays and maps.
+const cborBreak = 0xff
+
+// Decode converts CBOR data into the JSON tree.
+func (c *CBOR) Decode(data []byte) (interface{}, error) {
+	// the check limits the nesting levels and the number
+	// of elements, so that the items can be walked safely
+	if err := cbor.Wellformed(data); err != nil {
+		return nil, err
+	}
+	tree, _, err := decodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	return jsonTree(tree)
+}
+
+// decodeCBOR decodes the first data item of well-formed data and returns
+// the rest. Maps are decoded into orderedMap to keep their entries in the
+// encoded order, tags of arrays and maps are replaced by their content,
+// other items are decoded by the cbor package.
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	switch data[0] >> 5 {
+	case cborArray:
+		n, indefinite, rest := cborHeader(data)
+		arr := make([]interface{}, 0)
+		for i := uint64(0); indefinite && rest[0] != cborBreak || !indefinite && i < n; i++ {
+			item, next, err := decodeCBOR(rest)
+			if err != nil {
+				return nil, nil, err
+			}
+			arr = append(arr, item)
+			rest = next
+		}
+		if indefinite {
+			rest = rest[1:]
+		}
+		return arr, rest, nil
+	case cborMap:
+		n, indefinite, rest := cborHeader(data)
+		m := make(orderedMap, 0)
+		for i := uint64(0); indefinite && rest[0] != cborBreak || !indefinite && i < n; i++ {
+			key, next, err := decodeCBOR(rest)
+			if err != nil {
+				return nil, nil, err
+			}
+			value, next, err := decodeCBOR(next)
+			if err != nil {
+				return nil, nil, err
+			}
+			m = append(m, mapEntry{key: key, value: value})
+			rest = next
+		}
+		if indefinite {
+			rest = rest[1:]
+		}
+		return m, rest, nil
+	case cborTag:
+		_, _, content := cborHeader(data)
+		switch content[0] >> 5 {
+		case cborArray, cborMap, cborTag:
+			return decodeCBOR(content)
+		}
+	}
+	var item interface{}
+	rest, err := cbor.UnmarshalFirst(data, &item)
+	return item, rest, err
+}
+
+// MarshalCBOR encodes the map with the entries in their order.
+func (m orderedMap) MarshalCBOR() ([]byte, error) {
+	data := cborAppendHeader(nil, cborMap, uint64(len(m)))
+	for _, e := range m {
+		for _, v := range []interface{}{e.key, e.value} {
+			item, err := cbor.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, item...)
+		}
+	}
+	return data, nil
+}
+
+// cborAppendHeader appends the header of the data item
+// with the major type and the argument to the data.
+func cborAppendHeader(data []byte, major byte, n uint64) []byte {
+	major <<= 5
+	var arg [8]byte
+	switch {
+	case n < 24:
+		return append(data, major|byte(n))
+	case n <= 0xff:
+		return append(data, major|24, byte(n))
+	case n <= 0xffff:
+		binary.BigEndian.PutUint16(arg[:], uint16(n))
+		return append(append(data, major|25), arg[:2]...)
+	case n <= 0xffffffff:
+		binary.BigEndian.PutUint32(arg[:], uint32(n))
+		return append(append(data, major|26), arg[:4]...)
+	}
+	binary.BigEndian.PutUint64(arg[:], n)
+	return append(append(data, major|27), arg[:]...)
+}
+
+// cborHeader returns the argument of the data item header, whether the
+// item has indefinite length and the data that follows the header.
+func cborHeader(data []byte) (uint64, bool, []byte) {
+	switch info := data[0] & 0x1f; {
+	case info < 24:
+		return uint64(info), false, data[1:]
+	case info == 24:
+		return uint64(data[1]), false, data[2:]
+	case info == 25:
+		return uint64(binary.BigEndian.Uint16(data[1:])), false, data[3:]
+	case info == 26:
+		return uint64(binary.BigEndian.Uint32(data[1:])), false, data[5:]
+	case info == 27:
+		return binary.BigEndian.Uint64(data[1:]), false, data[9:]
+	}
+	return 0, true, data[1:]
+}
+
+// Encode converts the JSON tree into CBOR data.
+func (c *CBOR) Encode(tree interface{}) ([]byte, error) {
+	return cbor.Marshal(binaryTree(tree))
+}
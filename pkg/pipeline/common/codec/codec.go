@@ -0,0 +1,183 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package codec
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+)
+
+// Supported CE Data content types.
+const (
+	ApplicationJSON     = "application/json"
+	ApplicationProtobuf = "application/protobuf"
+	ApplicationAvro     = "application/avro"
+	ApplicationCBOR     = "application/cbor"
+	ApplicationMsgpack  = "application/msgpack"
+
+	ApplicationOctetStream = "application/octet-stream"
+)
+
+// Codec converts binary CE Data into the JSON tree of convert.Objects,
+// arrays and values with json.Number numbers, as convert.Decode
+// returns it, and the transformed tree back into binary data.
+type Codec interface {
+	ContentType() string
+	Decode([]byte) (interface{}, error)
+	Encode(interface{}) ([]byte, error)
+}
+
+// aliases are alternative content types that are commonly used
+// by the event producers.
+var aliases = map[string][]string{
+	ApplicationProtobuf: {"application/x-protobuf"},
+	ApplicationAvro:     {"avro/binary"},
+	ApplicationMsgpack:  {"application/x-msgpack"},
+}
+
+// Match returns "true" if the CE Data content type is handled by the Codec.
+// HTTP headers may contain parameters, i.e. "application/protobuf; proto=foo"
+// so we must use "contains" instead of strict equality.
+func Match(c Codec, contentType string) bool {
+	if strings.Contains(contentType, c.ContentType()) {
+		return true
+	}
+	for _, alias := range aliases[c.ContentType()] {
+		if strings.Contains(contentType, alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// mapEntry is a key-value pair of the decoded map.
+type mapEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+// orderedMap is the decoded map with the entries in their encoded
+// order, binary decoders return maps as unordered Go maps.
+type orderedMap []mapEntry
+
+// jsonTree converts decoded values into the JSON tree: maps are converted
+// into Objects with the keys in the decoded order formatted as strings,
+// numbers into json.Number, binary values are represented as base64
+// strings and CBOR tags are replaced by their content.
+func jsonTree(v interface{}) (interface{}, error) {
+	switch value := v.(type) {
+	case orderedMap:
+		object := convert.NewObject()
+		for _, e := range value {
+			key, err := jsonKey(e.key)
+			if err != nil {
+				return nil, err
+			}
+			item, err := jsonTree(e.value)
+			if err != nil {
+				return nil, err
+			}
+			object.Set(key, item)
+		}
+		return object, nil
+	case []interface{}:
+		for i, v := range value {
+			item, err := jsonTree(v)
+			if err != nil {
+				return nil, err
+			}
+			value[i] = item
+		}
+		return value, nil
+	case []byte:
+		return base64.StdEncoding.EncodeToString(value), nil
+	case cbor.Tag:
+		return jsonTree(value.Content)
+	case nil, bool, string, json.Number:
+		return v, nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		// numbers are written as encoding/json writes them
+		number, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(number), nil
+	}
+	// other values, i.e. timestamps and big integers, are converted
+	// into the values that they are encoded to in JSON
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return convert.Decode(data)
+}
+
+// jsonKey formats the map key as a string, non-string
+// keys are written as they are encoded in JSON.
+func jsonKey(k interface{}) (string, error) {
+	key, err := jsonTree(k)
+	if err != nil {
+		return "", err
+	}
+	if s, ok := key.(string); ok {
+		return s, nil
+	}
+	encoded, err := convert.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// binaryTree converts the JSON tree into ordered maps and slices that binary
+// encoders support, JSON numbers are converted into integers where
+// possible so that they are compactly encoded. The tree is not modified.
+func binaryTree(v interface{}) interface{} {
+	switch value := v.(type) {
+	case *convert.Object:
+		m := make(orderedMap, 0, value.Len())
+		for _, k := range value.Keys() {
+			v, _ := value.Get(k)
+			m = append(m, mapEntry{key: k, value: binaryTree(v)})
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, len(value))
+		for i, v := range value {
+			arr[i] = binaryTree(v)
+		}
+		return arr
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		if f, err := value.Float64(); err == nil {
+			return f
+		}
+		return value.String()
+	case float64:
+		if i := int64(value); float64(i) == value {
+			return i
+		}
+	}
+	return v
+}
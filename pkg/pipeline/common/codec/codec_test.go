@@ -0,0 +1,225 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package codec
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+)
+
+// testTree decodes JSON data into the tree that codecs encode.
+func testTree(t *testing.T, data string) interface{} {
+	tree, err := convert.Decode([]byte(data))
+	assert.NoError(t, err)
+	return tree
+}
+
+// assertTree checks that the tree is encoded as the expected JSON.
+func assertTree(t *testing.T, expected string, tree interface{}) {
+	data, err := convert.Marshal(tree)
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected, string(data))
+	}
+}
+
+func testDescriptorSet(t *testing.T) []byte {
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Event"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{
+						Name:     proto.String("user_name"),
+						JsonName: proto.String("userName"),
+						Number:   proto.Int32(1),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					}, {
+						Name:     proto.String("count"),
+						JsonName: proto.String("count"),
+						Number:   proto.Int32(2),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(),
+					},
+				},
+			},
+		},
+	}
+	data, err := proto.Marshal(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{file},
+	})
+	assert.NoError(t, err)
+	return data
+}
+
+func TestProtobuf(t *testing.T) {
+	c, err := NewProtobuf(testDescriptorSet(t), "test.Event")
+	assert.NoError(t, err)
+
+	encoded, err := c.Encode(testTree(t, `{"user_name":"foo","count":42}`))
+	assert.NoError(t, err)
+
+	decoded, err := c.Decode(encoded)
+	assert.NoError(t, err)
+	assertTree(t, `{"user_name":"foo","count":42}`, decoded)
+
+	_, err = NewProtobuf(testDescriptorSet(t), "test.Missing")
+	assert.Error(t, err)
+}
+
+func TestAvro(t *testing.T) {
+	c, err := NewAvro([]byte(`{
+		"type": "record",
+		"name": "Event",
+		"fields": [
+			{"name": "user", "type": "string"},
+			{"name": "count", "type": "long"}
+		]
+	}`))
+	assert.NoError(t, err)
+
+	encoded, err := c.Encode(testTree(t, `{"user":"foo","count":42}`))
+	assert.NoError(t, err)
+
+	decoded, err := c.Decode(encoded)
+	assert.NoError(t, err)
+	assertTree(t, `{"user":"foo","count":42}`, decoded)
+
+	_, err = c.Decode([]byte{0xff})
+	assert.Error(t, err)
+
+	// nested records keep the schema field order
+	c, err = NewAvro([]byte(`{
+		"type": "record",
+		"name": "Order",
+		"namespace": "test",
+		"fields": [
+			{"name": "user", "type": "string"},
+			{"name": "item", "type": ["null", {
+				"type": "record",
+				"name": "Item",
+				"fields": [
+					{"name": "sku", "type": "string"},
+					{"name": "count", "type": "long"}
+				]
+			}]},
+			{"name": "items", "type": {"type": "array", "items": "Item"}},
+			{"name": "stock", "type": {"type": "map", "values": "test.Item"}}
+		]
+	}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tree := `{"user":"foo","item":{"test.Item":{"sku":"a","count":1}},` +
+		`"items":[{"sku":"b","count":2}],"stock":{"c":{"sku":"c","count":3}}}`
+	encoded, err = c.Encode(testTree(t, tree))
+	assert.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		decoded, err = c.Decode(encoded)
+		assert.NoError(t, err)
+		assertTree(t, tree, decoded)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	c := &Protobuf{}
+	assert.True(t, Match(c, "application/protobuf"))
+	assert.True(t, Match(c, "application/x-protobuf; proto=test.Event"))
+	assert.False(t, Match(c, "application/json"))
+}
+
+func TestCBOR(t *testing.T) {
+	c := &CBOR{}
+
+	// {1: h'0102', "foo": [1, 1.5]}
+	decoded, err := c.Decode([]byte{0xa2, 0x01, 0x42, 0x01, 0x02, 0x63, 'f', 'o', 'o', 0x82, 0x01, 0xf9, 0x3e, 0x00})
+	assert.NoError(t, err)
+	assertTree(t, `{"1":"AQI=","foo":[1,1.5]}`, decoded)
+	if assert.IsType(t, &convert.Object{}, decoded) {
+		foo, _ := decoded.(*convert.Object).Get("foo")
+		assert.Equal(t, []interface{}{json.Number("1"), json.Number("1.5")}, foo)
+	}
+
+	// 55799({"b": 1, "a": {_ "d": [_ 1, 2], "c": null}}) keeps the key order
+	decoded, err = c.Decode([]byte{0xd9, 0xd9, 0xf7, 0xa2, 0x61, 'b', 0x01, 0x61, 'a',
+		0xbf, 0x61, 'd', 0x9f, 0x01, 0x02, 0xff, 0x61, 'c', 0xf6, 0xff})
+	assert.NoError(t, err)
+	assertTree(t, `{"b":1,"a":{"d":[1,2],"c":null}}`, decoded)
+
+	_, err = c.Decode([]byte{0xa2, 0x61, 'b'})
+	assert.Error(t, err)
+	_, err = c.Decode([]byte{0xa0, 0x00})
+	assert.Error(t, err)
+
+	encoded, err := c.Encode(testTree(t, `{"foo":1}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xa1, 0x63, 'f', 'o', 'o', 0x01}, encoded)
+
+	encoded, err = c.Encode(testTree(t, `{"b":1,"a":{"d":2,"c":3}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xa2, 0x61, 'b', 0x01, 0x61, 'a', 0xa2, 0x61, 'd', 0x02, 0x61, 'c', 0x03}, encoded)
+}
+
+func TestMsgpack(t *testing.T) {
+	c := &Msgpack{}
+
+	// {1: bin(0102), "foo": [1, "bar"]}
+	decoded, err := c.Decode([]byte{0x82, 0x01, 0xc4, 0x02, 0x01, 0x02, 0xa3, 'f', 'o', 'o', 0x92, 0x01, 0xa3, 'b', 'a', 'r'})
+	assert.NoError(t, err)
+	assertTree(t, `{"1":"AQI=","foo":[1,"bar"]}`, decoded)
+
+	// {"b": 1, "a": {"d": 2, "c": 3}} keeps the key order
+	decoded, err = c.Decode([]byte{0x82, 0xa1, 'b', 0x01, 0xa1, 'a', 0x82, 0xa1, 'd', 0x02, 0xa1, 'c', 0x03})
+	assert.NoError(t, err)
+	assertTree(t, `{"b":1,"a":{"d":2,"c":3}}`, decoded)
+
+	encoded, err := c.Encode(testTree(t, `{"foo":1}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x81, 0xa3, 'f', 'o', 'o', 0x01}, encoded)
+
+	encoded, err = c.Encode(testTree(t, `{"b":1,"a":{"d":2,"c":3}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x82, 0xa1, 'b', 0x01, 0xa1, 'a', 0x82, 0xa1, 'd', 0x02, 0xa1, 'c', 0x03}, encoded)
+}
+
+func TestBase64(t *testing.T) {
+	c := &Base64{Key: "data"}
+
+	decoded, err := c.Decode([]byte{0x01, 0x02})
+	assert.NoError(t, err)
+	assertTree(t, `{"data":"AQI="}`, decoded)
+
+	encoded, err := c.Encode(decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01, 0x02}, encoded)
+
+	_, err = c.Encode(testTree(t, `{"data":1}`))
+	assert.Error(t, err)
+	_, err = c.Encode(testTree(t, `["AQI="]`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,42 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package codec
+
+import (
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+)
+
+var _ Codec = (*JSON)(nil)
+
+// JSON is a no-op Codec that can be used to select JSON
+// as the output format.
+type JSON struct{}
+
+// ContentType returns the content type of JSON data.
+func (j *JSON) ContentType() string {
+	return ApplicationJSON
+}
+
+// Decode converts JSON data into the tree.
+func (j *JSON) Decode(data []byte) (interface{}, error) {
+	return convert.Decode(data)
+}
+
+// Encode converts the tree into JSON data.
+func (j *JSON) Encode(tree interface{}) ([]byte, error) {
+	return convert.Marshal(tree)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package codec
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var _ Codec = (*Msgpack)(nil)
+
+// Msgpack decodes and encodes MessagePack data.
+type Msgpack struct{}
+
+// ContentType returns the content type of MessagePack encoded data.
+func (m *Msgpack) ContentType() string {
+	return ApplicationMsgpack
+}
+
+// Decode converts MessagePack data into the JSON tree.
+func (m *Msgpack) Decode(data []byte) (interface{}, error) {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	// maps with non-string keys are valid in MessagePack,
+	// the entries are kept in the encoded order
+	decoder.SetMapDecoder(func(d *msgpack.Decoder) (interface{}, error) {
+		n, err := d.DecodeMapLen()
+		if err != nil || n == -1 {
+			return nil, err
+		}
+		m := make(orderedMap, 0)
+		for i := 0; i < n; i++ {
+			key, err := d.DecodeInterface()
+			if err != nil {
+				return nil, err
+			}
+			value, err := d.DecodeInterface()
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, mapEntry{key: key, value: value})
+		}
+		return m, nil
+	})
+
+	tree, err := decoder.DecodeInterface()
+	if err != nil {
+		return nil, err
+	}
+	return jsonTree(tree)
+}
+
+// EncodeMsgpack encodes the map with the entries in their order.
+func (m orderedMap) EncodeMsgpack(e *msgpack.Encoder) error {
+	if err := e.EncodeMapLen(len(m)); err != nil {
+		return err
+	}
+	for _, entry := range m {
+		if err := e.Encode(entry.key); err != nil {
+			return err
+		}
+		if err := e.Encode(entry.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encode converts the JSON tree into MessagePack data.
+func (m *Msgpack) Encode(tree interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.UseCompactInts(true)
+	if err := encoder.Encode(binaryTree(tree)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
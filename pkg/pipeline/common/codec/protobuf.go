@@ -0,0 +1,101 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package codec
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+)
+
+var _ Codec = (*Protobuf)(nil)
+
+// Protobuf decodes and encodes messages of a single type
+// described in the FileDescriptorSet.
+type Protobuf struct {
+	message protoreflect.MessageDescriptor
+}
+
+// NewProtobuf looks up the message type in the serialized
+// FileDescriptorSet and returns a Codec for this type.
+func NewProtobuf(descriptorSet []byte, messageType string) (*Protobuf, error) {
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(descriptorSet, fds); err != nil {
+		return nil, fmt.Errorf("cannot decode descriptor set: %w", err)
+	}
+
+	files, err := protodesc.NewFiles(fds)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load descriptor set: %w", err)
+	}
+
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(messageType))
+	if err != nil {
+		return nil, fmt.Errorf("message %q not found: %w", messageType, err)
+	}
+
+	message, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a message", messageType)
+	}
+
+	return &Protobuf{
+		message: message,
+	}, nil
+}
+
+// ContentType returns the content type of protobuf encoded data.
+func (p *Protobuf) ContentType() string {
+	return ApplicationProtobuf
+}
+
+// Decode converts protobuf message into the JSON tree. Field names
+// are kept as they are declared in the .proto file.
+func (p *Protobuf) Decode(data []byte) (interface{}, error) {
+	message := dynamicpb.NewMessage(p.message)
+	if err := proto.Unmarshal(data, message); err != nil {
+		return nil, err
+	}
+
+	jsonData, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	return convert.Decode(jsonData)
+}
+
+// Encode converts the JSON tree into protobuf message.
+func (p *Protobuf) Encode(tree interface{}) ([]byte, error) {
+	jsonData, err := convert.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	message := dynamicpb.NewMessage(p.message)
+	if err := protojson.Unmarshal(jsonData, message); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(message)
+}
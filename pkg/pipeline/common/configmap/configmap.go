@@ -0,0 +1,43 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configmap
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// MountPath is a directory where the controller mounts ConfigMaps
+// referenced in the Transformation spec.
+var MountPath string = "/etc/transformation/configmaps"
+
+// Path returns the location of the mounted ConfigMap key.
+func Path(name, key string) string {
+	return filepath.Join(MountPath, name, key)
+}
+
+// Read returns the contents of the mounted ConfigMap key.
+func Read(selector corev1.ConfigMapKeySelector) ([]byte, error) {
+	data, err := ioutil.ReadFile(Path(selector.Name, selector.Key))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read ConfigMap %q key %q: %w", selector.Name, selector.Key, err)
+	}
+	return data, nil
+}
@@ -17,6 +17,13 @@ limitations under the License.
 package convert
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -68,7 +75,7 @@ func SliceToMap(path []string, value interface{}) map[string]interface{} {
 // Source map keys are being overwritten by appendix keys if they overlap.
 func MergeJSONWithMap(source, appendix interface{}) interface{} {
 	switch appendixValue := appendix.(type) {
-	case float64, bool, string, nil:
+	case json.Number, float64, bool, string, nil:
 		return appendixValue
 	case []interface{}:
 		sourceInterface, ok := source.([]interface{})
@@ -113,3 +120,473 @@ func MergeJSONWithMap(source, appendix interface{}) interface{} {
 	}
 	return source
 }
+
+// Copy returns a deep copy of the JSON value so that it can be inserted
+// into a document without sharing objects and arrays with its source.
+// Maps are converted to Objects with sorted keys, as encoding/json
+// would write them, and integers are converted to json.Number as if
+// the value was decoded with Decode.
+func Copy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *Object:
+		o := &Object{
+			keys:   make([]string, len(v.keys)),
+			values: make(map[string]interface{}, len(v.values)),
+		}
+		copy(o.keys, v.keys)
+		for k, item := range v.values {
+			o.values[k] = Copy(item)
+		}
+		return o
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		o := &Object{
+			keys:   keys,
+			values: make(map[string]interface{}, len(v)),
+		}
+		for k, item := range v {
+			o.values[k] = Copy(item)
+		}
+		return o
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, item := range v {
+			arr[i] = Copy(item)
+		}
+		return arr
+	case int:
+		return json.Number(strconv.Itoa(v))
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10))
+	case *big.Int:
+		return json.Number(v.String())
+	}
+	return value
+}
+
+// Unmarshal decodes JSON like json.Unmarshal but keeps numbers
+// as json.Number, so that integers above 2^53 are not rounded
+// and unchanged numbers are encoded back as they were.
+func Unmarshal(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		if err == io.EOF {
+			return errors.New("unexpected end of JSON input")
+		}
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("invalid data after top-level value")
+	}
+	return nil
+}
+
+// NumberEqual returns true if both values are JSON numbers,
+// float64 or json.Number, that are equal. Integers are compared
+// exactly, other numbers are compared as float64.
+func NumberEqual(a, b interface{}) bool {
+	x, ok := number(a)
+	if !ok {
+		return false
+	}
+	y, ok := number(b)
+	if !ok {
+		return false
+	}
+	if i, ok := new(big.Int).SetString(string(x), 10); ok {
+		if j, ok := new(big.Int).SetString(string(y), 10); ok {
+			return i.Cmp(j) == 0
+		}
+	}
+	f, err := x.Float64()
+	if err != nil {
+		return false
+	}
+	g, err := y.Float64()
+	if err != nil {
+		return false
+	}
+	return f == g
+}
+
+func number(value interface{}) (json.Number, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		return v, true
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'f', -1, 64)), true
+	}
+	return "", false
+}
+
+// Path is a parsed JSON path.
+type Path struct {
+	source string
+	keys   []pathKey
+}
+
+// pathKey is a path element, the index is -1
+// if the key is not followed by an array index.
+type pathKey struct {
+	name  string
+	index int
+}
+
+// ParsePath parses the dot separated keys that can be followed
+// by the array index, i.e. "foo.bar[1].baz". The key before the
+// index can be empty to address the root array, i.e. "[0].foo".
+// Empty path points to the document root.
+func ParsePath(path string) (Path, error) {
+	p := Path{source: path}
+	for _, name := range strings.Split(path, ".") {
+		key := pathKey{name: name, index: -1}
+		if i := strings.Index(name, "["); i > -1 {
+			if !strings.HasSuffix(name, "]") {
+				return Path{}, fmt.Errorf("path %q: key %q has unterminated array index", path, name)
+			}
+			index, err := strconv.Atoi(name[i+1 : len(name)-1])
+			if err != nil || index < 0 {
+				return Path{}, fmt.Errorf("path %q: key %q has invalid array index", path, name)
+			}
+			key = pathKey{name: name[:i], index: index}
+		}
+		if key.name == "" && key.index == -1 && path != "" {
+			return Path{}, fmt.Errorf("path %q has empty key", path)
+		}
+		p.keys = append(p.keys, key)
+	}
+	return p, nil
+}
+
+// String returns the source of the path.
+func (p Path) String() string {
+	return p.source
+}
+
+// Empty returns true if the path points to the document root.
+func (p Path) Empty() bool {
+	return p.source == ""
+}
+
+// Child returns the path of the key of the Object at the path.
+func (p Path) Child(name string) Path {
+	keys := make([]pathKey, len(p.keys), len(p.keys)+1)
+	copy(keys, p.keys)
+	source := name
+	if p.source != "" {
+		source = p.source + "." + name
+	}
+	return Path{source: source, keys: append(keys, pathKey{name: name, index: -1})}
+}
+
+// Element returns the path of the array element at the path.
+func (p Path) Element(index int) Path {
+	keys := make([]pathKey, len(p.keys), len(p.keys)+1)
+	copy(keys, p.keys)
+	source := fmt.Sprintf("%s[%d]", p.source, index)
+	if last := len(keys) - 1; last >= 0 && keys[last].index == -1 {
+		keys[last].index = index
+		return Path{source: source, keys: keys}
+	}
+	// nested arrays cannot be parsed, but are addressed here
+	return Path{source: source, keys: append(keys, pathKey{index: index})}
+}
+
+// Equal returns true if the paths point to the same value.
+func (p Path) Equal(other Path) bool {
+	if len(p.keys) != len(other.keys) {
+		return false
+	}
+	for i := range p.keys {
+		if p.keys[i] != other.keys[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Map returns the value nested in maps and arrays along the path
+// that can be merged into JSON, see SliceToMap.
+func (p Path) Map(value interface{}) map[string]interface{} {
+	for i := len(p.keys) - 1; i >= 0; i-- {
+		key := p.keys[i]
+		if key.index > -1 {
+			arr := make([]interface{}, key.index+1)
+			arr[key.index] = value
+			value = arr
+		}
+		value = map[string]interface{}{key.name: value}
+	}
+	m, _ := value.(map[string]interface{})
+	return m
+}
+
+// Read returns the value at the path, nil if the path does not exist.
+func (p Path) Read(source interface{}) interface{} {
+	for _, key := range p.keys {
+		if key.name != "" {
+			object, ok := source.(*Object)
+			if !ok {
+				return nil
+			}
+			source, _ = object.Get(key.name)
+		}
+		if key.index > -1 {
+			array, ok := source.([]interface{})
+			if !ok || key.index >= len(array) {
+				return nil
+			}
+			source = array[key.index]
+		}
+	}
+	return source
+}
+
+// Replace overwrites the value at the path if the path exists and
+// reports whether it did. Missing keys are not created.
+func (p Path) Replace(source, value interface{}) bool {
+	if p.Empty() {
+		return false
+	}
+	last := len(p.keys) - 1
+	parent := Path{keys: p.keys[:last]}.Read(source)
+	key := p.keys[last]
+	if key.name != "" {
+		object, ok := parent.(*Object)
+		if !ok {
+			return false
+		}
+		if _, exists := object.Get(key.name); !exists {
+			return false
+		}
+		if key.index == -1 {
+			object.Set(key.name, value)
+			return true
+		}
+		parent, _ = object.Get(key.name)
+	}
+	array, ok := parent.([]interface{})
+	if !ok || key.index >= len(array) {
+		return false
+	}
+	array[key.index] = value
+	return true
+}
+
+// Merge writes the value at the path and returns the new source root.
+// The rules are the same as of MergeJSONWithMap, new keys are appended
+// to the Objects.
+func (p Path) Merge(source, value interface{}) interface{} {
+	return merge(source, p.keys, value)
+}
+
+// Extract removes the value at the path from the source and returns
+// the new source root and the value. Removed array elements are not
+// replaced, the following elements are shifted.
+func (p Path) Extract(source interface{}) (interface{}, interface{}) {
+	if p.Empty() {
+		return source, nil
+	}
+	return extract(source, p.keys)
+}
+
+func merge(source interface{}, keys []pathKey, value interface{}) interface{} {
+	if len(keys) == 0 {
+		return mergeValue(source, value)
+	}
+	key := keys[0]
+
+	var object *Object
+	switch s := source.(type) {
+	case nil:
+		object = NewObject()
+	case *Object:
+		object = s
+	case []interface{}:
+		if key.name != "" {
+			return source
+		}
+	default:
+		return source
+	}
+
+	// empty key of the root array or the empty path
+	if key.name == "" {
+		if object != nil {
+			source = object
+		}
+		return mergeIndex(source, key.index, keys[1:], value)
+	}
+	current, _ := object.Get(key.name)
+	object.Set(key.name, mergeIndex(current, key.index, keys[1:], value))
+	return object
+}
+
+// mergeIndex replaces the array element at the index with the new value
+// at the rest of the path, the source is merged if there is no index.
+func mergeIndex(source interface{}, index int, keys []pathKey, value interface{}) interface{} {
+	if index < 0 {
+		return merge(source, keys, value)
+	}
+	element := build(keys, value)
+	array, _ := source.([]interface{})
+	size := len(array)
+	if index >= size {
+		size = index + 1
+	}
+	result := make([]interface{}, size)
+	copy(result, array)
+	if element != nil {
+		result[index] = element
+	}
+	return result
+}
+
+// build returns the new value at the path.
+func build(keys []pathKey, value interface{}) interface{} {
+	for i := len(keys) - 1; i >= 0; i-- {
+		key := keys[i]
+		if key.index > -1 {
+			array := make([]interface{}, key.index+1)
+			array[key.index] = value
+			value = array
+		}
+		if key.name != "" {
+			object := NewObject()
+			object.Set(key.name, value)
+			value = object
+		}
+	}
+	return value
+}
+
+// mergeValue merges JSON value into the source, see MergeJSONWithMap.
+func mergeValue(source, value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number, float64, bool, string, nil:
+		return v
+	case []interface{}:
+		array, ok := source.([]interface{})
+		if !ok {
+			return v
+		}
+		size := len(array)
+		if len(v) > size {
+			size = len(v)
+		}
+		result := make([]interface{}, size)
+		for i := range result {
+			if i < len(v) && v[i] != nil {
+				result[i] = v[i]
+				continue
+			}
+			if i < len(array) {
+				result[i] = array[i]
+			}
+		}
+		return result
+	case *Object:
+		object, ok := source.(*Object)
+		switch {
+		case source == nil:
+			object = NewObject()
+		case !ok:
+			return source
+		}
+		for _, k := range v.keys {
+			current, _ := object.Get(k)
+			object.Set(k, mergeValue(current, v.values[k]))
+		}
+		return object
+	}
+	return source
+}
+
+func extract(source interface{}, keys []pathKey) (interface{}, interface{}) {
+	key, last := keys[0], len(keys) == 1
+	if key.name == "" {
+		array, ok := source.([]interface{})
+		if !ok || key.index >= len(array) {
+			return source, nil
+		}
+		if last {
+			return removeIndex(array, key.index), array[key.index]
+		}
+		var value interface{}
+		array[key.index], value = extract(array[key.index], keys[1:])
+		return array, value
+	}
+
+	object, ok := source.(*Object)
+	if !ok {
+		return source, nil
+	}
+	current, ok := object.Get(key.name)
+	if !ok {
+		return source, nil
+	}
+	var value interface{}
+	switch {
+	case key.index < 0 && last:
+		object.Delete(key.name)
+		return object, current
+	case key.index < 0:
+		current, value = extract(current, keys[1:])
+		object.Set(key.name, current)
+		return object, value
+	}
+
+	array, ok := current.([]interface{})
+	if !ok || key.index >= len(array) {
+		return source, nil
+	}
+	if last {
+		object.Set(key.name, removeIndex(array, key.index))
+		return object, array[key.index]
+	}
+	array[key.index], value = extract(array[key.index], keys[1:])
+	return object, value
+}
+
+// removeIndex returns the array without the element at the index.
+func removeIndex(array []interface{}, index int) []interface{} {
+	result := make([]interface{}, 0, len(array)-1)
+	result = append(result, array[:index]...)
+	return append(result, array[index+1:]...)
+}
+
+// Plain returns a deep copy of the JSON value with Objects converted
+// into maps, for the libraries that expect values decoded by
+// encoding/json.
+func Plain(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *Object:
+		m := make(map[string]interface{}, len(v.values))
+		for k, item := range v.values {
+			m[k] = Plain(item)
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, item := range v {
+			arr[i] = Plain(item)
+		}
+		return arr
+	}
+	return value
+}
+
+// ParseVariableOrPath parses the path unless the value is the name
+// of a Pipeline variable that starts with "$", empty Path is returned
+// for variables.
+func ParseVariableOrPath(value string) (Path, error) {
+	if strings.HasPrefix(value, "$") {
+		return Path{}, nil
+	}
+	return ParsePath(value)
+}
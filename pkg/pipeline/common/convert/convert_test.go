@@ -18,6 +18,7 @@ package convert
 
 import (
 	"encoding/json"
+	"math/big"
 	"strings"
 	"testing"
 
@@ -120,3 +121,271 @@ func TestMergeJSONWithMap(t *testing.T) {
 		})
 	}
 }
+
+func TestCopy(t *testing.T) {
+	source := map[string]interface{}{
+		"foo": []interface{}{
+			map[string]interface{}{"bar": "baz"},
+		},
+		"int":   42,
+		"int64": int64(-1),
+		"big":   new(big.Int).SetUint64(1 << 63),
+	}
+
+	// maps are converted to Objects with sorted keys
+	result := Copy(source)
+	encoded, err := json.Marshal(result)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, `{"big":9223372036854775808,"foo":[{"bar":"baz"}],"int":42,"int64":-1}`, string(encoded))
+
+	object := Copy(result).(*Object)
+	object.Set("int", "changed")
+	object.Delete("big")
+	item, _ := object.Get("foo")
+	item.([]interface{})[0].(*Object).Set("bar", "changed")
+
+	encoded, err = json.Marshal(result)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, `{"big":9223372036854775808,"foo":[{"bar":"baz"}],"int":42,"int64":-1}`, string(encoded))
+}
+
+func TestParsePath(t *testing.T) {
+	testCases := []struct {
+		path  string
+		valid bool
+	}{
+		{path: "", valid: true},
+		{path: "foo.bar", valid: true},
+		{path: "foo.bar[1].baz", valid: true},
+		{path: "foo.[0].bar", valid: true},
+		{path: "[1].foo", valid: true},
+		{path: "foo..bar"},
+		{path: ".foo"},
+		{path: "foo."},
+		{path: "foo[1"},
+		{path: "foo[]"},
+		{path: "foo[x]"},
+		{path: "foo[-1]"},
+		{path: "foo[1]bar"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			path, err := ParsePath(tc.path)
+			if !tc.valid {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tc.path, path.String())
+			assert.Equal(t, SliceToMap(strings.Split(tc.path, "."), "value"), path.Map("value"))
+		})
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	var value interface{}
+	if !assert.NoError(t, Unmarshal([]byte(`{"id":1234567890123456789,"price":1.10,"tags":[1e3]}`), &value)) {
+		return
+	}
+	assert.Equal(t, map[string]interface{}{
+		"id":    json.Number("1234567890123456789"),
+		"price": json.Number("1.10"),
+		"tags":  []interface{}{json.Number("1e3")},
+	}, value)
+
+	encoded, err := json.Marshal(value)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, `{"id":1234567890123456789,"price":1.10,"tags":[1e3]}`, string(encoded))
+
+	assert.EqualError(t, Unmarshal([]byte(``), &value), "unexpected end of JSON input")
+	assert.EqualError(t, Unmarshal([]byte(`{} {}`), &value), "invalid data after top-level value")
+}
+
+func TestNumberEqual(t *testing.T) {
+	testCases := []struct {
+		a, b  interface{}
+		equal bool
+	}{
+		{json.Number("1234567890123456789"), json.Number("1234567890123456789"), true},
+		{json.Number("1234567890123456789"), json.Number("1234567890123456788"), false},
+		{json.Number("1.10"), 1.1, true},
+		{json.Number("1e3"), json.Number("1000"), true},
+		{json.Number("42"), float64(42), true},
+		{json.Number("42"), "42", false},
+		{json.Number("42"), json.Number("foo"), false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.equal, NumberEqual(tc.a, tc.b), "%v == %v", tc.a, tc.b)
+	}
+}
+
+func TestObject(t *testing.T) {
+	value, err := Decode([]byte(`{"zulu":1,"bravo":{"yankee":true,"alpha":[{"x":null}]},"echo":"e"}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	object, ok := value.(*Object)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, []string{"zulu", "bravo", "echo"}, object.Keys())
+
+	object.Set("zulu", 2)
+	object.Set("alpha", "a")
+	object.Delete("echo")
+	object.Delete("missing")
+
+	encoded, err := json.Marshal(object)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, `{"zulu":2,"bravo":{"yankee":true,"alpha":[{"x":null}]},"alpha":"a"}`, string(encoded))
+
+	// HTML characters are not escaped
+	value, err = Decode([]byte(`{"<a>":"Tom & Jerry","list":["<b>",{"x":"&"}]}`))
+	assert.NoError(t, err)
+	encoded, err = Marshal(value)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"<a>":"Tom & Jerry","list":["<b>",{"x":"&"}]}`, string(encoded))
+
+	_, err = Decode([]byte(`{"foo":`))
+	assert.EqualError(t, err, "unexpected end of JSON input")
+	_, err = Decode([]byte(`[1] 2`))
+	assert.EqualError(t, err, "invalid data after top-level value")
+}
+
+func TestPathMergeAndExtract(t *testing.T) {
+	testCases := []struct {
+		source  string
+		path    string
+		value   interface{}
+		merged  string
+		extract string
+	}{
+		{
+			source:  `{"zulu":1,"bravo":{"yankee":true}}`,
+			path:    "bravo.alpha",
+			value:   "x",
+			merged:  `{"zulu":1,"bravo":{"yankee":true,"alpha":"x"}}`,
+			extract: `{"zulu":1,"bravo":{"yankee":true}}`,
+		}, {
+			source:  `{"zulu":1,"bravo":[1,2]}`,
+			path:    "bravo[3]",
+			value:   "x",
+			merged:  `{"zulu":1,"bravo":[1,2,null,"x"]}`,
+			extract: `{"zulu":1,"bravo":[1,2,null]}`,
+		}, {
+			source:  `{"zulu":1}`,
+			path:    "alpha.list[1].key",
+			value:   "x",
+			merged:  `{"zulu":1,"alpha":{"list":[null,{"key":"x"}]}}`,
+			extract: `{"zulu":1,"alpha":{"list":[null,{}]}}`,
+		}, {
+			source:  `[{"zulu":1},{"bravo":2}]`,
+			path:    "[1].alpha",
+			value:   "x",
+			merged:  `[{"zulu":1},{"alpha":"x"}]`,
+			extract: `[{"zulu":1},{}]`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			source, err := Decode([]byte(tc.source))
+			if !assert.NoError(t, err) {
+				return
+			}
+			path, err := ParsePath(tc.path)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			source = path.Merge(source, tc.value)
+			encoded, err := json.Marshal(source)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tc.merged, string(encoded))
+			assert.Equal(t, tc.value, path.Read(source))
+
+			source, value := path.Extract(source)
+			encoded, err = json.Marshal(source)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tc.extract, string(encoded))
+			assert.Equal(t, tc.value, value)
+		})
+	}
+}
+
+func TestPathEqual(t *testing.T) {
+	testCases := []struct {
+		path  string
+		built Path
+	}{
+		{path: "foo", built: Path{}.Child("foo")},
+		{path: "foo.bar[1].baz", built: Path{}.Child("foo").Child("bar").Element(1).Child("baz")},
+		{path: "[0].foo", built: Path{}.Element(0).Child("foo")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			path, err := ParsePath(tc.path)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.True(t, path.Equal(tc.built))
+			assert.Equal(t, tc.path, tc.built.String())
+		})
+	}
+
+	path, err := ParsePath("foo.bar")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.False(t, path.Equal(Path{}.Child("foo").Element(0).Child("bar")))
+	assert.False(t, path.Equal(Path{}.Child("foo")))
+}
+
+func TestPathReplace(t *testing.T) {
+	testCases := []struct {
+		path     string
+		replaced bool
+		result   string
+	}{
+		{path: "bravo.yankee", replaced: true, result: `{"zulu":1,"bravo":{"yankee":"x"},"list":[1,2]}`},
+		{path: "list[1]", replaced: true, result: `{"zulu":1,"bravo":{"yankee":true},"list":[1,"x"]}`},
+		{path: "list[2]", result: `{"zulu":1,"bravo":{"yankee":true},"list":[1,2]}`},
+		{path: "bravo.alpha", result: `{"zulu":1,"bravo":{"yankee":true},"list":[1,2]}`},
+		{path: "zulu.alpha", result: `{"zulu":1,"bravo":{"yankee":true},"list":[1,2]}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			source, err := Decode([]byte(`{"zulu":1,"bravo":{"yankee":true},"list":[1,2]}`))
+			if !assert.NoError(t, err) {
+				return
+			}
+			path, err := ParsePath(tc.path)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tc.replaced, path.Replace(source, "x"))
+			encoded, err := json.Marshal(source)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tc.result, string(encoded))
+		})
+	}
+}
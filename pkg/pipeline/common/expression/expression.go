@@ -0,0 +1,241 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package expression
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+)
+
+// Names of the variables available in expressions.
+const (
+	// Context is the CE context with extensions.
+	Context = "context"
+	// Data is the CE data decoded into JSON.
+	Data = "data"
+	// Vars holds the Pipeline variables.
+	Vars = "vars"
+)
+
+// Expression is a compiled CEL program.
+type Expression struct {
+	source  string
+	program cel.Program
+}
+
+// Activation maps variable names to their values.
+type Activation map[string]interface{}
+
+// NewActivation combines decoded CE context and data with
+// the Pipeline variables. Missing documents are represented as null.
+func NewActivation(context, data interface{}, variables *storage.Storage) Activation {
+	vars := make(map[string]interface{})
+	if variables != nil {
+		for _, key := range variables.ListKeys() {
+			vars[key] = variables.Get(key)
+		}
+	}
+	return Activation{
+		Context: context,
+		Data:    data,
+		Vars:    vars,
+	}
+}
+
+var env *cel.Env
+
+func init() {
+	var err error
+	env, err = cel.NewEnv(
+		cel.CustomTypeAdapter(jsonAdapter{}),
+		cel.Declarations(
+			decls.NewVar(Context, decls.Dyn),
+			decls.NewVar(Data, decls.Dyn),
+			decls.NewVar(Vars, decls.NewMapType(decls.String, decls.Dyn)),
+		),
+	)
+	if err != nil {
+		panic(fmt.Sprintf("cannot create CEL environment: %v", err))
+	}
+}
+
+// Compile parses and checks CEL expression source.
+func Compile(source string) (*Expression, error) {
+	ast, issues := env.Compile(source)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("cannot compile expression %q: %w", source, issues.Err())
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create program for expression %q: %w", source, err)
+	}
+	return &Expression{
+		source:  source,
+		program: program,
+	}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression and returns its result as
+// a value that can be encoded into JSON.
+func (e *Expression) Eval(activation Activation) (interface{}, error) {
+	out, _, err := e.program.Eval(map[string]interface{}(activation))
+	if err != nil {
+		return nil, fmt.Errorf("cannot evaluate expression %q: %w", e.source, err)
+	}
+	value, err := toJSON(out)
+	if err != nil {
+		return nil, fmt.Errorf("expression %q result is not a JSON value: %w", e.source, err)
+	}
+	return value, nil
+}
+
+// Match evaluates the expression that must return a boolean.
+func (e *Expression) Match(activation Activation) (bool, error) {
+	out, _, err := e.program.Eval(map[string]interface{}(activation))
+	if err != nil {
+		return false, fmt.Errorf("cannot evaluate expression %q: %w", e.source, err)
+	}
+	result, ok := out.(types.Bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q returned %s instead of bool", e.source, out.Type().TypeName())
+	}
+	return bool(result), nil
+}
+
+// jsonAdapter converts the values of JSON trees decoded with
+// json.Number. Numbers written as integers are ints, or uints if
+// they do not fit into int64, and the rest of numbers are doubles.
+type jsonAdapter struct{}
+
+// NativeToValue implements ref.TypeAdapter.
+func (a jsonAdapter) NativeToValue(value interface{}) ref.Val {
+	switch v := value.(type) {
+	case json.Number:
+		return number(v)
+	case *convert.Object:
+		return object{
+			Mapper: types.NewStringInterfaceMap(a, v.Values()),
+			value:  v,
+		}
+	case map[string]interface{}:
+		return types.NewStringInterfaceMap(a, v)
+	case []interface{}:
+		return types.NewDynamicList(a, v)
+	}
+	return types.DefaultTypeAdapter.NativeToValue(value)
+}
+
+// object is CEL map of the Object values.
+type object struct {
+	traits.Mapper
+	value *convert.Object
+}
+
+// Value returns the Object.
+func (o object) Value() interface{} {
+	return o.value
+}
+
+// number returns the CEL value of the number. The type only depends on
+// how the number is written, so that fields have the same type in all events.
+func number(n json.Number) ref.Val {
+	if i, err := n.Int64(); err == nil {
+		return types.Int(i)
+	}
+	if u, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+		return types.Uint(u)
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return types.NewErr("invalid number %s", n)
+	}
+	return types.Double(f)
+}
+
+// toJSON converts the expression result into JSON value, integers
+// are returned as json.Number to keep their precision.
+func toJSON(value ref.Val) (interface{}, error) {
+	// objects and arrays of the documents are copied as they are
+	switch v := value.Value().(type) {
+	case *convert.Object, []interface{}:
+		return convert.Copy(v), nil
+	}
+
+	switch v := value.(type) {
+	case types.Int:
+		return json.Number(strconv.FormatInt(int64(v), 10)), nil
+	case types.Uint:
+		return json.Number(strconv.FormatUint(uint64(v), 10)), nil
+	case types.Double:
+		if math.IsInf(float64(v), 0) || math.IsNaN(float64(v)) {
+			return nil, fmt.Errorf("%v is not a JSON number", float64(v))
+		}
+		return float64(v), nil
+	case traits.Lister:
+		size, ok := v.Size().(types.Int)
+		if !ok {
+			break
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			item, err := toJSON(v.Get(types.Int(i)))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
+		}
+		return list, nil
+	case traits.Mapper:
+		m := make(map[string]interface{})
+		for it := v.Iterator(); it.HasNext() == types.True; {
+			key := it.Next()
+			name, ok := key.(types.String)
+			if !ok {
+				return nil, fmt.Errorf("map key %v is not a string", key)
+			}
+			item, err := toJSON(v.Get(key))
+			if err != nil {
+				return nil, err
+			}
+			m[string(name)] = item
+		}
+		return convert.Copy(m), nil
+	}
+	native, err := value.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return nil, err
+	}
+	return native.(*structpb.Value).AsInterface(), nil
+}
@@ -0,0 +1,29 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystore
+
+import "time"
+
+// KeyStore remembers keys for a limited time. Implementations
+// must be safe for concurrent use.
+type KeyStore interface {
+	// Add records the key for the TTL and returns false
+	// if the key is already recorded and has not expired.
+	Add(key string, ttl time.Duration) (bool, error)
+	// Delete forgets the key.
+	Delete(key string) error
+}
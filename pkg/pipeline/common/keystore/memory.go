@@ -0,0 +1,90 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystore
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+var _ KeyStore = (*Memory)(nil)
+
+// Memory is an in-memory KeyStore that evicts the least
+// recently added keys when its size limit is reached.
+type Memory struct {
+	size int
+
+	mux   sync.Mutex
+	order *list.List
+	keys  map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	expires time.Time
+}
+
+// NewMemory returns an instance of Memory KeyStore
+// that holds up to size keys.
+func NewMemory(size int) *Memory {
+	return &Memory{
+		size:  size,
+		order: list.New(),
+		keys:  make(map[string]*list.Element),
+	}
+}
+
+// Add records the key for the TTL and returns false
+// if the key is already recorded and has not expired.
+func (m *Memory) Add(key string, ttl time.Duration) (bool, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	now := time.Now()
+	if e, ok := m.keys[key]; ok {
+		if now.Before(e.Value.(*memoryEntry).expires) {
+			return false, nil
+		}
+		m.remove(e)
+	}
+
+	for m.order.Len() >= m.size && m.order.Len() > 0 {
+		m.remove(m.order.Back())
+	}
+	m.keys[key] = m.order.PushFront(&memoryEntry{
+		key:     key,
+		expires: now.Add(ttl),
+	})
+	return true, nil
+}
+
+// Delete forgets the key.
+func (m *Memory) Delete(key string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if e, ok := m.keys[key]; ok {
+		m.remove(e)
+	}
+	return nil
+}
+
+func (m *Memory) remove(e *list.Element) {
+	m.order.Remove(e)
+	delete(m.keys, e.Value.(*memoryEntry).key)
+}
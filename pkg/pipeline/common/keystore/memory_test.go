@@ -0,0 +1,52 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	store := NewMemory(2)
+
+	added, err := store.Add("foo", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, added)
+
+	added, err = store.Add("foo", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, added)
+
+	// "foo" is evicted as the oldest key
+	_, _ = store.Add("bar", time.Minute)
+	_, _ = store.Add("baz", time.Minute)
+	added, _ = store.Add("foo", time.Minute)
+	assert.True(t, added)
+
+	assert.NoError(t, store.Delete("foo"))
+	added, _ = store.Add("foo", time.Minute)
+	assert.True(t, added)
+
+	added, _ = store.Add("expiring", time.Millisecond)
+	assert.True(t, added)
+	time.Sleep(5 * time.Millisecond)
+	added, _ = store.Add("expiring", time.Millisecond)
+	assert.True(t, added)
+}
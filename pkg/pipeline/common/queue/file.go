@@ -0,0 +1,365 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// MountPath is a directory where the controller mounts
+// the volume of the event buffer.
+var MountPath string = "/var/lib/transformation/buffer"
+
+// ErrFull is returned when the record does not fit into the queue.
+var ErrFull = errors.New("queue is full")
+
+const (
+	dataFile   = "queue.dat"
+	offsetFile = "queue.offset"
+	lockFile   = "queue.lock"
+
+	// headerSize is the size of the record length and checksum.
+	headerSize = 8
+	// copyBufferSize is the size of the chunks that records
+	// are moved in when the file is compacted.
+	copyBufferSize = 64 << 10
+)
+
+// File is a persistent FIFO queue of records appended to a file.
+// Records are synced to disk before Push returns, the read offset
+// is saved when they are removed, so records are kept until
+// they are processed at least once. The file never grows beyond
+// the size limit: removed records are dropped from it when it is
+// truncated after the last record is removed, or compacted when
+// the removed records take at least as much space as the rest.
+type File struct {
+	maxRecords int
+	maxBytes   int64
+
+	mux     sync.Mutex
+	lock    *os.File
+	data    *os.File
+	offset  string
+	read    int64
+	write   int64
+	records int
+}
+
+// Open claims a subdirectory of the root that is not used by another
+// process and opens the queue stored there. Queues left by stopped
+// processes are claimed first so that their records are not lost.
+func Open(root string, maxRecords int, maxBytes int64) (*File, error) {
+	for i := 0; ; i++ {
+		dir := filepath.Join(root, strconv.Itoa(i))
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, fmt.Errorf("cannot create queue directory: %w", err)
+		}
+		lock, err := os.OpenFile(filepath.Join(dir, lockFile), os.O_CREATE|os.O_RDWR, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open queue lock: %w", err)
+		}
+		if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			lock.Close()
+			if err == syscall.EWOULDBLOCK {
+				continue
+			}
+			return nil, fmt.Errorf("cannot lock queue: %w", err)
+		}
+
+		f, err := open(dir, maxRecords, maxBytes)
+		if err != nil {
+			lock.Close()
+			return nil, err
+		}
+		f.lock = lock
+		return f, nil
+	}
+}
+
+func open(dir string, maxRecords int, maxBytes int64) (*File, error) {
+	data, err := os.OpenFile(filepath.Join(dir, dataFile), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open queue file: %w", err)
+	}
+	f := &File{
+		maxRecords: maxRecords,
+		maxBytes:   maxBytes,
+		data:       data,
+		offset:     filepath.Join(dir, offsetFile),
+	}
+
+	info, err := data.Stat()
+	if err != nil {
+		data.Close()
+		return nil, fmt.Errorf("cannot read queue file: %w", err)
+	}
+	end := info.Size()
+
+	raw, err := ioutil.ReadFile(f.offset)
+	switch {
+	case err == nil && (len(raw) == 8 || len(raw) == 16):
+		f.read = int64(binary.BigEndian.Uint64(raw))
+		if len(raw) == 16 {
+			// the file was compacted but not truncated
+			if compacted := int64(binary.BigEndian.Uint64(raw[8:])); compacted < end {
+				end = compacted
+			}
+		}
+	case err != nil && !os.IsNotExist(err):
+		data.Close()
+		return nil, fmt.Errorf("cannot read queue offset: %w", err)
+	}
+
+	if f.read > end {
+		// the file was truncated before the offset was saved
+		f.read = 0
+	}
+
+	if err := f.recover(end); err != nil {
+		data.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// recover counts the records between the read offset and the end
+// and drops the last one if it was not completely written.
+func (f *File) recover(end int64) error {
+	f.write = f.read
+	for {
+		_, size, err := f.readAt(f.write, end)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// torn write of the process that was stopped
+			break
+		}
+		f.write += size
+		f.records++
+	}
+	if err := f.data.Truncate(f.write); err != nil {
+		return fmt.Errorf("cannot truncate queue file: %w", err)
+	}
+	return f.saveOffset(f.read, 0)
+}
+
+// Push appends the record to the queue.
+func (f *File) Push(record []byte) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	size := int64(headerSize + len(record))
+	if f.records >= f.maxRecords || f.write-f.read+size > f.maxBytes {
+		return ErrFull
+	}
+	if f.write+size > f.maxBytes {
+		if err := f.compact(); err != nil {
+			return err
+		}
+		if f.write+size > f.maxBytes {
+			return ErrFull
+		}
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf, uint32(len(record)))
+	binary.BigEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(record))
+	copy(buf[headerSize:], record)
+	if _, err := f.data.WriteAt(buf, f.write); err != nil {
+		return fmt.Errorf("cannot write queue record: %w", err)
+	}
+	if err := f.data.Sync(); err != nil {
+		return fmt.Errorf("cannot sync queue file: %w", err)
+	}
+	f.write += size
+	f.records++
+	return nil
+}
+
+// Peek returns the first record, nil if the queue is empty.
+func (f *File) Peek() ([]byte, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if f.records == 0 {
+		return nil, nil
+	}
+	record, _, err := f.readAt(f.read, f.write)
+	return record, err
+}
+
+// Pop removes the first record. The queue file is
+// truncated when the last record is removed.
+func (f *File) Pop() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if f.records == 0 {
+		return nil
+	}
+	_, size, err := f.readAt(f.read, f.write)
+	if err != nil {
+		return err
+	}
+
+	read := f.read + size
+	if f.records == 1 {
+		read = 0
+	}
+	if err := f.saveOffset(read, 0); err != nil {
+		return err
+	}
+	f.read = read
+	f.records--
+	if f.records == 0 {
+		f.write = 0
+		if err := f.data.Truncate(0); err != nil {
+			return fmt.Errorf("cannot truncate queue file: %w", err)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of records in the queue.
+func (f *File) Len() int {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.records
+}
+
+// Size returns the size of the records in the queue.
+func (f *File) Size() int64 {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.write - f.read
+}
+
+// Close closes the queue files and releases the directory.
+func (f *File) Close() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	err := f.data.Close()
+	if f.lock != nil {
+		if lockErr := f.lock.Close(); err == nil {
+			err = lockErr
+		}
+	}
+	return err
+}
+
+// compact moves the records to the beginning of the file if the removed
+// records take at least as much space as the rest, so that the records
+// are not overwritten before the new read offset is saved.
+func (f *File) compact() error {
+	size := f.write - f.read
+	if f.read == 0 || f.read < size {
+		return nil
+	}
+
+	buf := make([]byte, copyBufferSize)
+	for moved := int64(0); moved < size; {
+		n, err := f.data.ReadAt(buf[:min(int64(len(buf)), size-moved)], f.read+moved)
+		if err != nil {
+			return fmt.Errorf("cannot compact queue file: %w", err)
+		}
+		if _, err := f.data.WriteAt(buf[:n], moved); err != nil {
+			return fmt.Errorf("cannot compact queue file: %w", err)
+		}
+		moved += int64(n)
+	}
+	if err := f.data.Sync(); err != nil {
+		return fmt.Errorf("cannot sync queue file: %w", err)
+	}
+
+	// the end is saved with the offset, so that the moved records
+	// are not read again if the process stops before truncation
+	if err := f.saveOffset(0, size); err != nil {
+		return err
+	}
+	f.read, f.write = 0, size
+	if err := f.data.Truncate(size); err != nil {
+		return fmt.Errorf("cannot truncate queue file: %w", err)
+	}
+	if err := f.data.Sync(); err != nil {
+		return fmt.Errorf("cannot sync queue file: %w", err)
+	}
+	return f.saveOffset(0, 0)
+}
+
+func min(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// readAt returns the record at the offset and its size with the header.
+// Records must end before the end offset, the length in the header that
+// points beyond it or exceeds the queue size means the record is corrupted.
+func (f *File) readAt(offset, end int64) ([]byte, int64, error) {
+	if offset >= end {
+		return nil, 0, io.EOF
+	}
+	header := make([]byte, headerSize)
+	if _, err := f.data.ReadAt(header, offset); err != nil {
+		return nil, 0, err
+	}
+	length := int64(binary.BigEndian.Uint32(header))
+	if length > f.maxBytes || offset+headerSize+length > end {
+		return nil, 0, fmt.Errorf("queue record at %d is corrupted", offset)
+	}
+	record := make([]byte, length)
+	if _, err := f.data.ReadAt(record, offset+headerSize); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(record) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, 0, fmt.Errorf("queue record at %d is corrupted", offset)
+	}
+	return record, int64(headerSize + len(record)), nil
+}
+
+// saveOffset atomically replaces the read offset file. The end of
+// the records is saved with the offset while the file is compacted,
+// zero end is not saved.
+func (f *File) saveOffset(offset, end int64) error {
+	raw := make([]byte, 8, 16)
+	binary.BigEndian.PutUint64(raw, uint64(offset))
+	if end != 0 {
+		raw = raw[:16]
+		binary.BigEndian.PutUint64(raw[8:], uint64(end))
+	}
+	tmp := f.offset + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return fmt.Errorf("cannot write queue offset: %w", err)
+	}
+	if err := os.Rename(tmp, f.offset); err != nil {
+		return fmt.Errorf("cannot write queue offset: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	root, err := ioutil.TempDir("", "queue")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	q, err := Open(root, 3, 1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	record, err := q.Peek()
+	assert.NoError(t, err)
+	assert.Nil(t, record)
+
+	assert.NoError(t, q.Push([]byte("first")))
+	assert.NoError(t, q.Push([]byte("second")))
+	assert.NoError(t, q.Push([]byte("third")))
+	assert.Equal(t, ErrFull, q.Push([]byte("fourth")))
+	assert.Equal(t, 3, q.Len())
+
+	record, err = q.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, "first", string(record))
+	assert.NoError(t, q.Pop())
+
+	// the directory is locked by the open queue
+	other, err := Open(root, 3, 1024)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, other.Len())
+	assert.NoError(t, other.Close())
+
+	// records survive reopening, the torn write is dropped
+	assert.NoError(t, q.Close())
+	data, err := os.OpenFile(filepath.Join(root, "0", dataFile), os.O_APPEND|os.O_WRONLY, 0600)
+	assert.NoError(t, err)
+	_, err = data.Write([]byte{0, 0, 0, 10, 1, 2})
+	assert.NoError(t, err)
+	assert.NoError(t, data.Close())
+
+	q, err = Open(root, 3, 1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer q.Close()
+	assert.Equal(t, 2, q.Len())
+
+	record, err = q.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(record))
+	assert.NoError(t, q.Pop())
+	record, err = q.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, "third", string(record))
+	assert.NoError(t, q.Pop())
+
+	// the file is truncated when the queue is drained
+	assert.Equal(t, 0, q.Len())
+	assert.Equal(t, int64(0), q.Size())
+	assert.Equal(t, ErrFull, q.Push(make([]byte, 1024)))
+}
+
+func TestFileSize(t *testing.T) {
+	root, err := ioutil.TempDir("", "queue")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	// two records of 8 bytes with their headers
+	q, err := Open(root, 10, 32)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer q.Close()
+
+	assert.NoError(t, q.Push([]byte("record-1")))
+	assert.NoError(t, q.Push([]byte("record-2")))
+	assert.Equal(t, ErrFull, q.Push([]byte("record-3")))
+
+	// removed records free the space before the queue is drained
+	assert.NoError(t, q.Pop())
+	assert.Equal(t, int64(16), q.Size())
+	assert.NoError(t, q.Push([]byte("record-3")))
+	assert.Equal(t, int64(32), q.Size())
+
+	record, err := q.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, "record-2", string(record))
+}
+
+func TestFileCompaction(t *testing.T) {
+	root, err := ioutil.TempDir("", "queue")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	// four records of 8 bytes with their headers
+	q, err := Open(root, 10, 64)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the queue never drains, the file stays within the limit
+	var queued []string
+	pushed := 0
+	push := func() error {
+		record := fmt.Sprintf("record-%d", pushed)
+		if err := q.Push([]byte(record)); err != nil {
+			return err
+		}
+		queued = append(queued, record)
+		pushed++
+		return nil
+	}
+	for round := 0; round < 10; round++ {
+		for push() == nil {
+		}
+		for i := 0; i < 1+round%3 && len(queued) > 1; i++ {
+			record, err := q.Peek()
+			assert.NoError(t, err)
+			assert.Equal(t, queued[0], string(record))
+			assert.NoError(t, q.Pop())
+			queued = queued[1:]
+		}
+		info, err := os.Stat(filepath.Join(root, "0", dataFile))
+		assert.NoError(t, err)
+		assert.True(t, info.Size() <= 64, "file size %d", info.Size())
+	}
+	// removed records are compacted, not truncated with the drained file
+	assert.True(t, pushed > 10, "pushed %d", pushed)
+	assert.Equal(t, len(queued), q.Len())
+	assert.NoError(t, q.Close())
+
+	// the moved records that were not truncated before
+	// the process stopped are not read again
+	q, err = Open(root, 10, 64)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for q.Len() != 0 {
+		assert.NoError(t, q.Pop())
+	}
+	assert.NoError(t, q.Push([]byte("record-a")))
+	assert.NoError(t, q.Push([]byte("record-b")))
+	assert.NoError(t, q.Close())
+
+	data, err := os.OpenFile(filepath.Join(root, "0", dataFile), os.O_APPEND|os.O_WRONLY, 0600)
+	assert.NoError(t, err)
+	_, err = data.Write([]byte{0, 0, 0, 8, 0, 0, 0, 0, 'r', 'e', 'c', 'o', 'r', 'd', '-', 'b'})
+	assert.NoError(t, err)
+	assert.NoError(t, data.Close())
+	f := &File{offset: filepath.Join(root, "0", offsetFile)}
+	assert.NoError(t, f.saveOffset(0, 32))
+
+	q, err = Open(root, 10, 64)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer q.Close()
+	assert.Equal(t, 2, q.Len())
+	assert.Equal(t, int64(32), q.Size())
+}
+
+func TestFileCorruptedLength(t *testing.T) {
+	root, err := ioutil.TempDir("", "queue")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	q, err := Open(root, 10, 1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, q.Push([]byte("first")))
+	assert.NoError(t, q.Close())
+
+	// the length of the torn record is not allocated
+	data, err := os.OpenFile(filepath.Join(root, "0", dataFile), os.O_APPEND|os.O_WRONLY, 0600)
+	assert.NoError(t, err)
+	_, err = data.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 1})
+	assert.NoError(t, err)
+	assert.NoError(t, data.Close())
+
+	q, err = Open(root, 10, 1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer q.Close()
+	assert.Equal(t, 1, q.Len())
+	assert.Equal(t, int64(13), q.Size())
+}
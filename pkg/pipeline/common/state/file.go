@@ -0,0 +1,99 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var _ Store = (*File)(nil)
+
+// bucket is the name of bbolt bucket with the state values.
+var bucket = []byte("state")
+
+// File is a Store that keeps the values in embedded
+// key-value database so that they survive adapter restarts.
+type File struct {
+	db *bolt.DB
+}
+
+// NewFile opens or creates the database file. The file is locked by one
+// process at a time, NewFile fails if the lock is not released in 5 seconds.
+func NewFile(path string) (*File, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("cannot open state file %q: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot create state bucket: %w", err)
+	}
+	return &File{db: db}, nil
+}
+
+// Get returns the value of the key, nil if it is not set.
+func (f *File) Get(key string) (interface{}, error) {
+	var value interface{}
+	err := f.db.View(func(tx *bolt.Tx) error {
+		var err error
+		// decoding copies the value that is only
+		// valid during the transaction
+		value, err = decode(tx.Bucket(bucket).Get([]byte(key)))
+		return err
+	})
+	return value, err
+}
+
+// Set writes the value of the key.
+func (f *File) Set(key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return f.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), raw)
+	})
+}
+
+// Increment adds delta to the numeric value of the key
+// and returns the result.
+func (f *File) Increment(key string, delta json.Number) (json.Number, error) {
+	var result json.Number
+	err := f.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		raw, value, err := increment(key, b.Get([]byte(key)), delta)
+		if err != nil {
+			return err
+		}
+		result = value
+		return b.Put([]byte(key), raw)
+	})
+	return result, err
+}
+
+// Close closes the database file.
+func (f *File) Close() error {
+	return f.db.Close()
+}
@@ -0,0 +1,77 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+var _ Store = (*Memory)(nil)
+
+// Memory is a Store that keeps the values until
+// the adapter is restarted.
+type Memory struct {
+	mux    sync.Mutex
+	values map[string][]byte
+}
+
+// NewMemory returns an instance of Memory Store.
+func NewMemory() *Memory {
+	return &Memory{
+		values: make(map[string][]byte),
+	}
+}
+
+// Get returns the value of the key, nil if it is not set.
+func (m *Memory) Get(key string) (interface{}, error) {
+	m.mux.Lock()
+	raw := m.values[key]
+	m.mux.Unlock()
+	return decode(raw)
+}
+
+// Set writes the value of the key.
+func (m *Memory) Set(key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	m.mux.Lock()
+	m.values[key] = raw
+	m.mux.Unlock()
+	return nil
+}
+
+// Increment adds delta to the numeric value of the key
+// and returns the result.
+func (m *Memory) Increment(key string, delta json.Number) (json.Number, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	raw, result, err := increment(key, m.values[key], delta)
+	if err != nil {
+		return "", err
+	}
+	m.values[key] = raw
+	return result, nil
+}
+
+// Close is a no-op for Memory Store.
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+)
+
+// Store keeps the values that persist across events.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns the value of the key, nil if it is not set.
+	Get(key string) (interface{}, error)
+	// Set writes the value of the key.
+	Set(key string, value interface{}) error
+	// Increment adds delta to the numeric value of the key
+	// and returns the result. Missing keys start from zero.
+	Increment(key string, delta json.Number) (json.Number, error)
+	// Close releases the resources held by the Store.
+	Close() error
+}
+
+// decode returns the value of JSON encoded state entry.
+func decode(raw []byte) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	value, err := convert.Decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode state value: %w", err)
+	}
+	return value, nil
+}
+
+// increment adds delta to JSON encoded number
+// and returns the encoded result.
+func increment(key string, raw []byte, delta json.Number) ([]byte, json.Number, error) {
+	value, err := decode(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	current := json.Number("0")
+	if value != nil {
+		number, ok := value.(json.Number)
+		if !ok {
+			return nil, "", fmt.Errorf("state value %q is not a number", key)
+		}
+		current = number
+	}
+	result, err := Add(current, delta)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot increment state value %q: %w", key, err)
+	}
+	return []byte(result), result, nil
+}
+
+// Add returns the sum of the numbers. Integers are added exactly
+// regardless of their size, other numbers are added as floats.
+func Add(a, b json.Number) (json.Number, error) {
+	x, okX := new(big.Int).SetString(a.String(), 10)
+	y, okY := new(big.Int).SetString(b.String(), 10)
+	if okX && okY {
+		return json.Number(x.Add(x, y).String()), nil
+	}
+
+	fx, err := a.Float64()
+	if err != nil {
+		return "", fmt.Errorf("%q is not a number", a)
+	}
+	fy, err := b.Float64()
+	if err != nil {
+		return "", fmt.Errorf("%q is not a number", b)
+	}
+	raw, err := json.Marshal(fx + fy)
+	if err != nil {
+		return "", err
+	}
+	return json.Number(raw), nil
+}
@@ -0,0 +1,92 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+)
+
+func testStore(t *testing.T, store Store) {
+	value, err := store.Get("missing")
+	assert.NoError(t, err)
+	assert.Nil(t, value)
+
+	assert.NoError(t, store.Set("last", map[string]interface{}{"temperature": 21.5}))
+	value, err = store.Get("last")
+	assert.NoError(t, err)
+	expected := convert.NewObject()
+	expected.Set("temperature", json.Number("21.5"))
+	assert.Equal(t, expected, value)
+
+	counter, err := store.Increment("counter", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, json.Number("1"), counter)
+	counter, err = store.Increment("counter", "2.5")
+	assert.NoError(t, err)
+	assert.Equal(t, json.Number("3.5"), counter)
+
+	// large integers are added exactly
+	counter, err = store.Increment("sequence", "9007199254740993")
+	assert.NoError(t, err)
+	assert.Equal(t, json.Number("9007199254740993"), counter)
+	counter, err = store.Increment("sequence", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, json.Number("9007199254740994"), counter)
+
+	_, err = store.Increment("last", "1")
+	assert.Error(t, err)
+	_, err = store.Increment("counter", "one")
+	assert.Error(t, err)
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory())
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.db")
+
+	store, err := NewFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	testStore(t, store)
+	assert.NoError(t, store.Close())
+
+	// values survive reopening
+	store, err = NewFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer store.Close()
+	counter, err := store.Increment("counter", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, json.Number("4.5"), counter)
+}
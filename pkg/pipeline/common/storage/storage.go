@@ -16,7 +16,12 @@ limitations under the License.
 
 package storage
 
-import "sync"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
 
 // Storage is a simple object that provides thread safe
 // methods to read and write into a map.
@@ -57,3 +62,32 @@ func (s *Storage) ListKeys() []string {
 	}
 	return list
 }
+
+// Expand replaces var keys in the string with their values. Longer
+// keys go first so that "$id" does not replace a part of "$identity".
+func (s *Storage) Expand(template string) string {
+	return s.ExpandFunc(template, nil)
+}
+
+// ExpandFunc is like Expand but passes the values through the escape
+// function if it is not nil. The string is scanned once, so keys that
+// appear in the substituted values are not replaced.
+func (s *Storage) ExpandFunc(template string, escape func(string) string) string {
+	keys := s.ListKeys()
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	var pairs []string
+	for _, key := range keys {
+		if !strings.Contains(template, key) {
+			continue
+		}
+		value := fmt.Sprint(s.Get(key))
+		if escape != nil {
+			value = escape(value)
+		}
+		pairs = append(pairs, key, value)
+	}
+	if len(pairs) == 0 {
+		return template
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
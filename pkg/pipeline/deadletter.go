@@ -0,0 +1,118 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"knative.dev/pkg/logging"
+)
+
+const (
+	// deadLetterErrorExtension is the extension of dead-lettered
+	// events with the reason they could not be processed.
+	deadLetterErrorExtension = "deadlettererror"
+	// deadLetterOperationExtension is the extension of dead-lettered
+	// events with the name of the failed operation.
+	deadLetterOperationExtension = "deadletteroperation"
+)
+
+// deadLetterError is returned for events that must be sent
+// to the dead letter sink instead of being rejected.
+type deadLetterError struct {
+	event cloudevents.Event
+	err   error
+}
+
+func (e *deadLetterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *deadLetterError) Unwrap() error {
+	return e.err
+}
+
+// rejectError is returned for events that must be rejected
+// even if the dead letter sink is set.
+type rejectError struct {
+	err error
+}
+
+func (e *rejectError) Error() string {
+	return e.err.Error()
+}
+
+func (e *rejectError) Unwrap() error {
+	return e.err
+}
+
+// operationError is returned by the Pipeline when one
+// of its Transformers fails.
+type operationError struct {
+	operation string
+	err       error
+}
+
+func (e *operationError) Error() string {
+	return fmt.Sprintf("%s: %v", e.operation, e.err)
+}
+
+func (e *operationError) Unwrap() error {
+	return e.err
+}
+
+// DeadLetterSink sets the destination of events that could not be processed.
+func DeadLetterSink(uri string) Option {
+	return func(h *Handler) error {
+		h.deadLetterSink = uri
+		return nil
+	}
+}
+
+// deadLetter sends the event that could not be processed to the dead
+// letter sink and acknowledges it. Events are annotated with the error
+// unless the error carries its own event. Rejected events and errors
+// of the Handler without dead letter sink are returned as is.
+func (t *Handler) deadLetter(ctx context.Context, event cloudevents.Event, err error) error {
+	var rejErr *rejectError
+	if t.deadLetterSink == "" || errors.As(err, &rejErr) {
+		return err
+	}
+
+	var dlErr *deadLetterError
+	if errors.As(err, &dlErr) {
+		event = dlErr.event
+	} else {
+		event = event.Clone()
+		event.SetExtension(deadLetterErrorExtension, err.Error())
+		var opErr *operationError
+		if errors.As(err, &opErr) {
+			event.SetExtension(deadLetterOperationExtension, opErr.operation)
+		}
+	}
+
+	logging.FromContext(ctx).Info("Sending event to the dead letter sink")
+	ctx = cloudevents.ContextWithTarget(ctx, t.deadLetterSink)
+	if result := t.client.Send(ctx, event); !cloudevents.IsACK(result) {
+		return fmt.Errorf("cannot send event to the dead letter sink: %w", result)
+	}
+	return nil
+}
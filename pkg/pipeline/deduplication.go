@@ -0,0 +1,124 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"fmt"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/expression"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/keystore"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+)
+
+const (
+	defaultDeduplicationWindow = 10 * time.Minute
+	defaultDeduplicationSize   = 10000
+)
+
+// deduplicator detects events with the recently seen keys.
+type deduplicator struct {
+	path       convert.Path
+	expression *expression.Expression
+	window     time.Duration
+	store      keystore.KeyStore
+}
+
+// Deduplication drops the events that were received within
+// the time window. Keys are kept in memory.
+func Deduplication(d *v1alpha1.Deduplication) Option {
+	return func(h *Handler) error {
+		if d == nil {
+			return nil
+		}
+		if d.Path != "" && d.Expression != "" {
+			return fmt.Errorf("deduplication path and expression are mutually exclusive")
+		}
+
+		path, err := convert.ParsePath(d.Path)
+		if err != nil {
+			return fmt.Errorf("deduplication: %w", err)
+		}
+
+		dedup := &deduplicator{
+			path:   path,
+			window: defaultDeduplicationWindow,
+		}
+		if d.Window != nil {
+			dedup.window = d.Window.Duration
+		}
+		if d.Expression != "" {
+			if dedup.expression, err = expression.Compile(d.Expression); err != nil {
+				return fmt.Errorf("deduplication: %w", err)
+			}
+		}
+		size := d.Size
+		if size <= 0 {
+			size = defaultDeduplicationSize
+		}
+		dedup.store = keystore.NewMemory(size)
+
+		h.deduplicator = dedup
+		return nil
+	}
+}
+
+// key returns the event key, empty if the configured
+// path does not exist in CE Data.
+func (d *deduplicator) key(event cloudevents.Event, documents eventDocuments, variables *storage.Storage) (string, error) {
+	var value interface{}
+	switch {
+	case d.expression != nil:
+		var err error
+		activation := expression.NewActivation(documents.context, documents.data, variables)
+		if value, err = d.expression.Eval(activation); err != nil {
+			return "", err
+		}
+	case !d.path.Empty():
+		value = d.path.Read(documents.data)
+	default:
+		return event.Source() + "/" + event.ID(), nil
+	}
+	if value == nil {
+		return "", nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// check records the event key and returns true if it was recorded
+// before. Events without the key are never considered duplicates.
+func (d *deduplicator) check(event cloudevents.Event, documents eventDocuments, variables *storage.Storage) (string, bool, error) {
+	key, err := d.key(event, documents, variables)
+	if err != nil || key == "" {
+		return "", false, err
+	}
+	added, err := d.store.Add(key, d.window)
+	if err != nil {
+		return "", false, err
+	}
+	return key, !added, nil
+}
+
+// forget removes the key of the event that was not processed
+// so that its redelivery is not dropped.
+func (d *deduplicator) forget(key string) error {
+	return d.store.Delete(key)
+}
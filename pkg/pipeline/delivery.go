@@ -0,0 +1,293 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+
+	"knative.dev/pkg/logging"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+)
+
+const (
+	defaultBackoffDelay     = time.Second
+	defaultFailureThreshold = 5
+	defaultOpenDuration     = 30 * time.Second
+
+	// maxBackoffDelay caps the growing delays of the retries
+	// unless the delay before the first retry is longer.
+	maxBackoffDelay = 5 * time.Minute
+	// maxBackoffShift keeps the exponential delay multiplier
+	// within the range of time.Duration.
+	maxBackoffShift = 62
+)
+
+// errCircuitOpen is returned for deliveries that are
+// not attempted while the circuit breaker is open.
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// sendFunc makes a single delivery attempt of the event.
+type sendFunc func(context.Context, cloudevents.Event) error
+
+// deliveryPolicy retries failed deliveries to the sink.
+type deliveryPolicy struct {
+	retry          int
+	linear         bool
+	delay          time.Duration
+	timeout        time.Duration
+	retryableCodes map[int]bool
+
+	breaker *circuitBreaker
+}
+
+// Delivery sets the retries of failed deliveries to the sink.
+// Events are sent once by default.
+func Delivery(d *v1alpha1.Delivery) Option {
+	return func(h *Handler) error {
+		if d == nil {
+			return nil
+		}
+		if d.Retry < 0 {
+			return fmt.Errorf("delivery retry must not be negative")
+		}
+
+		policy := &deliveryPolicy{
+			retry: int(d.Retry),
+			delay: defaultBackoffDelay,
+		}
+		switch d.BackoffPolicy {
+		case "", v1alpha1.BackoffPolicyExponential:
+		case v1alpha1.BackoffPolicyLinear:
+			policy.linear = true
+		default:
+			return fmt.Errorf("backoff policy %q is not supported", d.BackoffPolicy)
+		}
+		if d.BackoffDelay != nil {
+			policy.delay = d.BackoffDelay.Duration
+		}
+		if d.Timeout != nil {
+			policy.timeout = d.Timeout.Duration
+		}
+		if len(d.RetryableCodes) != 0 {
+			policy.retryableCodes = make(map[int]bool, len(d.RetryableCodes))
+			for _, code := range d.RetryableCodes {
+				policy.retryableCodes[code] = true
+			}
+		}
+		if cb := d.CircuitBreaker; cb != nil {
+			policy.breaker = &circuitBreaker{
+				threshold: cb.FailureThreshold,
+				duration:  defaultOpenDuration,
+			}
+			if policy.breaker.threshold <= 0 {
+				policy.breaker.threshold = defaultFailureThreshold
+			}
+			if cb.OpenDuration != nil {
+				policy.breaker.duration = cb.OpenDuration.Duration
+			}
+		}
+
+		h.delivery = policy
+		return nil
+	}
+}
+
+// send delivers the event to the sink in the context.
+func (t *Handler) send(ctx context.Context, event cloudevents.Event) error {
+	ctx, span := trace.StartSpan(ctx, sendSpanName, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	var result error
+	if t.delivery == nil {
+		result = t.sendOnce(ctx, event)
+	} else {
+		result = t.delivery.send(ctx, t.sendOnce, event)
+	}
+	spanError(span, result)
+	return result
+}
+
+// sendOnce makes a single delivery attempt and reports its response code.
+func (t *Handler) sendOnce(ctx context.Context, event cloudevents.Event) error {
+	result := t.client.Send(ctx, event)
+	t.stats.reportDelivery(result)
+	return result
+}
+
+// send delivers the event, retrying failed attempts with backoff.
+// The circuit breaker is checked before each attempt, so that the
+// retries stop as soon as the circuit is opened.
+func (d *deliveryPolicy) send(ctx context.Context, send sendFunc, event cloudevents.Event) error {
+	var result error
+	for attempt := 0; ; attempt++ {
+		if d.breaker != nil && !d.breaker.allow(time.Now()) {
+			return errCircuitOpen
+		}
+		result = d.attempt(ctx, send, event)
+		if d.breaker != nil && d.breaker.record(cloudevents.IsACK(result), time.Now()) {
+			logging.FromContext(ctx).Warnf("Opening circuit breaker for %s after %d failed delivery attempts",
+				d.breaker.duration, d.breaker.threshold)
+		}
+		if cloudevents.IsACK(result) || attempt == d.retry || !d.retryable(result) {
+			break
+		}
+
+		backoff := d.backoff(attempt + 1)
+		logging.FromContext(ctx).Infow("Delivery failed, retrying in "+backoff.String(), zap.Error(result))
+		if err := wait(ctx, backoff); err != nil {
+			result = err
+			break
+		}
+	}
+
+	if cloudevents.IsACK(result) {
+		return nil
+	}
+	return result
+}
+
+func (d *deliveryPolicy) attempt(ctx context.Context, send sendFunc, event cloudevents.Event) error {
+	if d.timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+	return send(ctx, event)
+}
+
+// wait blocks for the duration or until the context is done.
+func wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryable returns true if the failed delivery should be retried.
+func (d *deliveryPolicy) retryable(result error) bool {
+	return retryable(result, d.retryableCodes)
+}
+
+// unavailable returns true if the delivery failed because
+// the sink is unavailable rather than the event was refused.
+func (t *Handler) unavailable(result error) bool {
+	if t.delivery != nil {
+		return t.delivery.retryable(result)
+	}
+	return retryable(result, nil)
+}
+
+// retryable returns true for connection errors and for the response
+// codes, 408, 429 and 5xx if the codes are not set.
+func retryable(result error, codes map[int]bool) bool {
+	var httpResult *cehttp.Result
+	if !errors.As(result, &httpResult) {
+		// the sink did not respond
+		return true
+	}
+	code := httpResult.StatusCode
+	if codes != nil {
+		return codes[code]
+	}
+	return code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+}
+
+// backoff returns the delay before the retry with the given number,
+// the delay is capped at maxBackoffDelay.
+func (d *deliveryPolicy) backoff(retry int) time.Duration {
+	if d.delay <= 0 {
+		return 0
+	}
+	limit := maxBackoffDelay
+	if d.delay > limit {
+		limit = d.delay
+	}
+
+	multiplier := time.Duration(retry)
+	if !d.linear {
+		if retry-1 > maxBackoffShift {
+			return limit
+		}
+		multiplier = 1 << uint(retry-1)
+	}
+	if multiplier > limit/d.delay {
+		return limit
+	}
+	return d.delay * multiplier
+}
+
+// circuitBreaker fails deliveries without calling the sink after
+// the number of consecutive failed attempts, until the trial
+// attempt made after the open duration succeeds.
+type circuitBreaker struct {
+	threshold int
+	duration  time.Duration
+
+	mux       sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+// allow returns true if the delivery attempt can be made.
+func (c *circuitBreaker) allow(now time.Time) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.failures < c.threshold {
+		return true
+	}
+	if c.trial || now.Before(c.openUntil) {
+		return false
+	}
+	c.trial = true
+	return true
+}
+
+// record updates the circuit state with the attempt result
+// and returns true if the circuit is opened.
+func (c *circuitBreaker) record(success bool, now time.Time) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.trial = false
+	if success {
+		c.failures = 0
+		return false
+	}
+	c.failures++
+	if c.failures < c.threshold {
+		return false
+	}
+	c.openUntil = now.Add(c.duration)
+	return c.failures == c.threshold
+}
@@ -0,0 +1,220 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/codec"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/configmap"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+)
+
+// defaultWrapKey is a JSON key that holds wrapped unsupported CE Data.
+const defaultWrapKey = "data"
+
+// format pairs the decoder of incoming CE Data with an optional
+// encoder of transformed data, which is encoded as JSON if it is not
+// set. Zero value format passes JSON as is.
+type format struct {
+	decoder codec.Codec
+	encoder codec.Codec
+
+	// pass is set if CE Data must not be transformed.
+	pass bool
+}
+
+// defaultFormats returns the formats that do not need a schema.
+func defaultFormats() []format {
+	return []format{
+		{decoder: &codec.CBOR{}},
+		{decoder: &codec.Msgpack{}},
+	}
+}
+
+// Encoding loads schemas of binary CE Data formats and selects
+// the format of transformed data.
+func Encoding(e *v1alpha1.Encoding) Option {
+	return func(h *Handler) error {
+		if e == nil {
+			return nil
+		}
+		outputs := []codec.Codec{&codec.JSON{}, &codec.CBOR{}, &codec.Msgpack{}}
+
+		if e.Protobuf != nil {
+			f, err := protobufFormat(e.Protobuf)
+			if err != nil {
+				return fmt.Errorf("protobuf encoding: %w", err)
+			}
+			h.formats = append(h.formats, f)
+			outputs = append(outputs, schemaOutput(f))
+		}
+		if e.Avro != nil {
+			f, err := avroFormat(e.Avro)
+			if err != nil {
+				return fmt.Errorf("avro encoding: %w", err)
+			}
+			h.formats = append(h.formats, f)
+			outputs = append(outputs, schemaOutput(f))
+		}
+		if e.Unsupported != nil {
+			f, err := unsupportedFormat(e.Unsupported)
+			if err != nil {
+				return err
+			}
+			h.fallback = f
+		}
+
+		if e.Output == "" {
+			return nil
+		}
+		for _, c := range outputs {
+			if codec.Match(c, e.Output) {
+				h.output = c
+				return nil
+			}
+		}
+		return fmt.Errorf("output content type %q is not supported", e.Output)
+	}
+}
+
+func protobufFormat(p *v1alpha1.ProtobufSchema) (format, error) {
+	descriptorSet, err := configmap.Read(p.DescriptorSet)
+	if err != nil {
+		return format{}, err
+	}
+
+	decoder, err := codec.NewProtobuf(descriptorSet, p.MessageType)
+	if err != nil {
+		return format{}, err
+	}
+	f := format{decoder: decoder}
+
+	if p.OutputMessageType != "" {
+		if f.encoder, err = codec.NewProtobuf(descriptorSet, p.OutputMessageType); err != nil {
+			return format{}, err
+		}
+	}
+	return f, nil
+}
+
+func avroFormat(a *v1alpha1.AvroSchema) (format, error) {
+	schema, err := configmap.Read(a.Schema)
+	if err != nil {
+		return format{}, err
+	}
+
+	decoder, err := codec.NewAvro(schema)
+	if err != nil {
+		return format{}, err
+	}
+	f := format{decoder: decoder}
+
+	if a.OutputSchema != nil {
+		outputSchema, err := configmap.Read(*a.OutputSchema)
+		if err != nil {
+			return format{}, err
+		}
+		if f.encoder, err = codec.NewAvro(outputSchema); err != nil {
+			return format{}, err
+		}
+	}
+	return f, nil
+}
+
+func unsupportedFormat(u *v1alpha1.UnsupportedData) (*format, error) {
+	switch u.Policy {
+	case v1alpha1.UnsupportedDataReject, "":
+		return nil, nil
+	case v1alpha1.UnsupportedDataPass:
+		return &format{pass: true}, nil
+	case v1alpha1.UnsupportedDataWrap:
+		key := u.Key
+		if key == "" {
+			key = defaultWrapKey
+		}
+		return &format{decoder: &codec.Base64{Key: key}}, nil
+	}
+	return nil, fmt.Errorf("unsupported data policy %q is not valid", u.Policy)
+}
+
+// dataFormat returns the format of CE Data with the given content type.
+func (t *Handler) dataFormat(contentType string) (format, bool) {
+	// HTTPTargets sets content type from HTTP headers, i.e.:
+	// "datacontenttype: application/json; charset=utf-8"
+	// so we must use "contains" instead of strict equality
+	if strings.Contains(contentType, cloudevents.ApplicationJSON) {
+		return format{}, true
+	}
+	for _, f := range t.formats {
+		if codec.Match(f.decoder, contentType) {
+			return f, true
+		}
+	}
+	if t.fallback != nil {
+		return *t.fallback, true
+	}
+	return format{}, false
+}
+
+// decode converts CE Data into the JSON tree. Empty JSON data
+// and data that is passed as is are decoded as nil.
+func (f format) decode(data []byte) (interface{}, error) {
+	if f.pass {
+		return nil, nil
+	}
+	if f.decoder != nil {
+		return f.decoder.Decode(data)
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return convert.Decode(data)
+}
+
+// schemaOutput returns the Codec that encodes transformed data when the
+// output content type of the schema format is selected, the one of the
+// output schema if it is set, the one of the input schema otherwise.
+func schemaOutput(f format) codec.Codec {
+	if f.encoder != nil {
+		return f.encoder
+	}
+	return f.decoder
+}
+
+// encodeData converts the transformed JSON tree into the output format
+// and returns its content type. Data is encoded with the output content
+// type if it is set, with the output schema of the format if it has one,
+// and as JSON otherwise, so binary data is not encoded back by default.
+func (t *Handler) encodeData(f format, tree interface{}) (string, []byte, error) {
+	encoder := f.encoder
+	if t.output != nil {
+		encoder = t.output
+	}
+	if encoder == nil {
+		encoder = &codec.JSON{}
+	}
+	encoded, err := encoder.Encode(tree)
+	if err != nil {
+		return "", nil, err
+	}
+	return encoder.ContentType(), encoded, nil
+}
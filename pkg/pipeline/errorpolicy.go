@@ -0,0 +1,69 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+)
+
+// transformationErrorsExtension is the extension of transformed
+// events with the errors of the operations that did not fail them.
+const transformationErrorsExtension = "transformationerrors"
+
+// OnError sets the default error policy of the operations.
+func OnError(policy string) Option {
+	return func(h *Handler) error {
+		if policy == "" {
+			return nil
+		}
+		if err := validateErrorPolicy(policy); err != nil {
+			return err
+		}
+		h.ContextPipeline.onError = policy
+		h.DataPipeline.onError = policy
+		return nil
+	}
+}
+
+func validateErrorPolicy(policy string) error {
+	switch policy {
+	case "", v1alpha1.OnErrorFail, v1alpha1.OnErrorSkip, v1alpha1.OnErrorContinue:
+		return nil
+	}
+	return fmt.Errorf("error policy %q is not supported", policy)
+}
+
+// annotateErrors adds the JSON array of error messages to the event.
+func annotateErrors(event *cloudevents.Event, errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	value, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+	return event.Context.SetExtension(transformationErrorsExtension, string(value))
+}
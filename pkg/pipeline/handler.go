@@ -19,14 +19,24 @@ package pipeline
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"strings"
+	"time"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+
+	"knative.dev/pkg/logging"
 
 	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/codec"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/expression"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/state"
 	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/k8slookup"
 )
 
 // Handler contains Pipelines for CE transformations and CloudEvents client.
@@ -34,9 +44,27 @@ type Handler struct {
 	ContextPipeline *Pipeline
 	DataPipeline    *Pipeline
 
+	formats  []format
+	fallback *format
+	output   codec.Codec
+
+	validator      *validator
+	deadLetterSink string
+	deduplicator   *deduplicator
+	rateLimiter    *rateLimiter
+	sampler        *sampler
+	delivery       *deliveryPolicy
+	buffer         *buffer
+	state          state.Store
+	stats          *statsReporter
+	payloads       *payloadLogger
+
 	client cloudevents.Client
 }
 
+// Option sets optional Handler parameters.
+type Option func(*Handler) error
+
 // ceContext represents CloudEvents context structure but with exported Extensions.
 type ceContext struct {
 	*cloudevents.EventContextV1 `json:",inline"`
@@ -44,68 +72,246 @@ type ceContext struct {
 }
 
 // NewHandler creates Handler instance.
-func NewHandler(context, data []v1alpha1.Transform) (Handler, error) {
-	contextPipeline, err := newPipeline(context)
-	if err != nil {
+func NewHandler(context, data []v1alpha1.Transform, opts ...Option) (Handler, error) {
+	if err := registerViews(); err != nil {
 		return Handler{}, err
 	}
 
-	dataPipeline, err := newPipeline(data)
-	if err != nil {
-		return Handler{}, err
+	contextPipeline, contextErrs := newPipeline(expression.Context, context)
+	dataPipeline, dataErrs := newPipeline(expression.Data, data)
+	if errs := append(contextErrs, dataErrs...); len(errs) != 0 {
+		for _, p := range []*Pipeline{contextPipeline, dataPipeline} {
+			if p != nil {
+				_ = p.close()
+			}
+		}
+		return Handler{}, errs
 	}
 
 	sharedVars := storage.New()
 	contextPipeline.setStorage(sharedVars)
 	dataPipeline.setStorage(sharedVars)
 
-	ceClient, err := cloudevents.NewDefaultClient()
+	sharedState := state.NewMemory()
+	contextPipeline.setState(sharedState)
+	dataPipeline.setState(sharedState)
+
+	kubernetes := k8slookup.NewClient("", nil, nil)
+	contextPipeline.setKubernetes(kubernetes)
+	dataPipeline.setKubernetes(kubernetes)
+
+	reporter := &statsReporter{}
+	contextPipeline.stats = reporter
+	dataPipeline.stats = reporter
+
+	ceClient, err := newClient()
 	if err != nil {
+		_ = contextPipeline.close()
+		_ = dataPipeline.close()
 		return Handler{}, err
 	}
 
-	return Handler{
+	handler := Handler{
 		ContextPipeline: contextPipeline,
 		DataPipeline:    dataPipeline,
 
+		formats:  defaultFormats(),
+		state:    sharedState,
+		stats:    reporter,
+		payloads: &payloadLogger{percentage: 100},
+
 		client: ceClient,
-	}, nil
+	}
+
+	for _, opt := range opts {
+		if err := opt(&handler); err != nil {
+			_ = handler.close()
+			return Handler{}, err
+		}
+	}
+
+	return handler, nil
 }
 
 // Start runs CloudEvent receiver and applies transformation Pipeline
 // on incoming events.
 func (t *Handler) Start(ctx context.Context, sink string) error {
-	log.Println("Starting CloudEvent receiver")
+	logger := logging.FromContext(ctx)
+	logger.Debugw("Loaded transformations",
+		zap.Strings("context", t.ContextPipeline.steps()),
+		zap.Strings("data", t.DataPipeline.steps()),
+	)
+	logger.Info("Starting CloudEvent receiver")
 	var receiver interface{}
 	receiver = t.receiveAndReply
 	if sink != "" {
 		ctx = cloudevents.ContextWithTarget(ctx, sink)
 		receiver = t.receiveAndSend
 	}
+	// buffered events are replayed until the receiver stops
+	ctx, cancel := context.WithCancel(ctx)
+	replayed := make(chan struct{})
+	if sink != "" && t.buffer != nil {
+		go func() {
+			defer close(replayed)
+			t.replay(ctx)
+		}()
+	} else {
+		close(replayed)
+	}
+
+	err := t.client.StartReceiver(ctx, receiver)
+	cancel()
+	<-replayed
 
-	return t.client.StartReceiver(ctx, receiver)
+	if err := t.close(); err != nil {
+		logger.Errorw("Cannot close transformations", zap.Error(err))
+	}
+	if err := t.state.Close(); err != nil {
+		logger.Errorw("Cannot close state store", zap.Error(err))
+	}
+	if t.buffer != nil {
+		if err := t.buffer.queue.Close(); err != nil {
+			logger.Errorw("Cannot close event buffer", zap.Error(err))
+		}
+	}
+	return err
 }
 
-func (t *Handler) receiveAndReply(event cloudevents.Event) (*cloudevents.Event, error) {
-	return t.applyTransformations(event)
+// close releases the resources held by the Pipelines.
+func (t *Handler) close() error {
+	contextErr := t.ContextPipeline.close()
+	if err := t.DataPipeline.close(); err != nil {
+		return err
+	}
+	return contextErr
 }
 
-func (t *Handler) receiveAndSend(ctx context.Context, event cloudevents.Event) error {
-	result, err := t.applyTransformations(event)
+func (t *Handler) receiveAndReply(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, error) {
+	start := time.Now()
+	ctx = logging.WithLogger(ctx, eventLogger(ctx, event))
+	ctx, span := startSpan(ctx, receiveSpanName, event)
+	defer span.End()
+
+	original := t.original(event)
+	result, key, err := t.transform(ctx, event)
+	t.stats.reportLatency(original.Type(), result, err, start)
 	if err != nil {
+		spanError(span, err)
+		if err := t.deadLetter(ctx, original, err); err != nil {
+			t.forgetDuplicate(ctx, key)
+			return nil, err
+		}
+		return nil, nil
+	}
+	if result != nil {
+		propagateTrace(ctx, result)
+	}
+	return result, nil
+}
+
+func (t *Handler) receiveAndSend(ctx context.Context, event cloudevents.Event) error {
+	start := time.Now()
+	ctx = logging.WithLogger(ctx, eventLogger(ctx, event))
+	ctx, span := startSpan(ctx, receiveSpanName, event)
+	defer span.End()
+
+	original := t.original(event)
+	result, key, err := t.transform(ctx, event)
+	defer t.stats.reportLatency(original.Type(), result, err, start)
+	if err := t.forward(ctx, span, original, result, err); err != nil {
+		// the event is redelivered and must not be dropped as duplicate
+		t.forgetDuplicate(ctx, key)
 		return err
 	}
-	return t.client.Send(ctx, *result)
+	return nil
+}
+
+// forward sends the transformed event to the sink, buffers it if the sink
+// is unavailable or sends the failed event to the dead letter sink.
+func (t *Handler) forward(ctx context.Context, span *trace.Span, original cloudevents.Event, result *cloudevents.Event, err error) error {
+	if err != nil {
+		spanError(span, err)
+		return t.deadLetter(ctx, original, err)
+	}
+	if result == nil {
+		return nil
+	}
+	propagateTrace(ctx, result)
+	if t.buffer != nil && t.buffer.pending() {
+		// buffered events are replayed first, they are removed
+		// from the buffer only after they are delivered
+		return t.bufferEvent(ctx, *result)
+	}
+	if sendResult := t.send(ctx, *result); !cloudevents.IsACK(sendResult) {
+		logging.FromContext(ctx).Errorw("Cannot deliver event", zap.Error(sendResult))
+		spanError(span, sendResult)
+		if t.buffer != nil && t.unavailable(sendResult) {
+			return t.bufferEvent(ctx, *result)
+		}
+		return t.deadLetter(ctx, *result, fmt.Errorf("cannot deliver event: %w", sendResult))
+	}
+	return nil
+}
+
+// transform applies the transformations and reports their result.
+func (t *Handler) transform(ctx context.Context, event cloudevents.Event) (*cloudevents.Event, string, error) {
+	eventType := event.Type()
+	t.stats.reportReceived(eventType)
+	result, key, err := t.transformEvent(ctx, event)
+	t.stats.reportProcessed(eventType, result, err)
+	return result, key, err
+}
+
+// forgetDuplicate removes the deduplication key of the event
+// that was not delivered.
+func (t *Handler) forgetDuplicate(ctx context.Context, key string) {
+	if t.deduplicator == nil || key == "" {
+		return
+	}
+	if err := t.deduplicator.forget(key); err != nil {
+		logging.FromContext(ctx).Errorw("Cannot remove deduplication key", zap.Error(err))
+	}
 }
 
-func (t *Handler) applyTransformations(event cloudevents.Event) (*cloudevents.Event, error) {
-	log.Printf("Received %q event", event.Type())
-	// HTTPTargets sets content type from HTTP headers, i.e.:
-	// "datacontenttype: application/json; charset=utf-8"
-	// so we must use "contains" instead of strict equality
-	if !strings.Contains(event.DataContentType(), cloudevents.ApplicationJSON) {
-		log.Printf("CE Content Type %q is not supported", event.DataContentType())
-		return nil, fmt.Errorf("CE Content Type %q is not supported", event.DataContentType())
+// original returns a copy of the received event that is sent to the dead
+// letter sink if the event fails, transformations modify its context in place.
+func (t *Handler) original(event cloudevents.Event) cloudevents.Event {
+	if t.deadLetterSink == "" {
+		return event
+	}
+	return event.Clone()
+}
+
+// transformEvent applies the transformations and returns the transformed
+// event with its deduplication key.
+func (t *Handler) transformEvent(ctx context.Context, event cloudevents.Event) (_ *cloudevents.Event, key string, err error) {
+	logger := logging.FromContext(ctx)
+	logger.Debug("Received event")
+	if t.sampler != nil && !t.sampler.sample(ctx, event) {
+		return nil, key, nil
+	}
+
+	dataFormat, supported := t.dataFormat(event.DataContentType())
+	if !supported {
+		logger.Errorf("CE Content Type %q is not supported", event.DataContentType())
+		return nil, key, fmt.Errorf("CE Content Type %q is not supported", event.DataContentType())
+	}
+
+	// CE context and data are decoded once and shared by the operations
+	eventData, err := dataFormat.decode(event.Data())
+	if err != nil {
+		logger.Errorw("Cannot decode CE data", zap.Error(err))
+		return nil, key, fmt.Errorf("cannot decode CE data: %w", err)
+	}
+	if !dataFormat.pass {
+		t.payloads.log(ctx, "Payload before transformation", event, eventData)
+	}
+
+	if t.validator != nil && !dataFormat.pass {
+		if err := t.validator.enforce(ctx, validate(t.validator.input, eventData), &event); err != nil {
+			return nil, key, err
+		}
 	}
 
 	localContext := ceContext{
@@ -113,46 +319,150 @@ func (t *Handler) applyTransformations(event cloudevents.Event) (*cloudevents.Ev
 		Extensions:     event.Context.AsV1().GetExtensions(),
 	}
 
-	localContextBytes, err := json.Marshal(localContext)
+	contextDocument, err := decodeDocument(localContext)
 	if err != nil {
-		log.Printf("Cannot encode CE context: %v", err)
-		return nil, fmt.Errorf("cannot encode CE context: %w", err)
+		logger.Errorw("Cannot encode CE context", zap.Error(err))
+		return nil, key, fmt.Errorf("cannot encode CE context: %w", err)
 	}
 
+	documents := eventDocuments{context: contextDocument, data: eventData}
+
+	// errors of the operations that did not fail the event
+	var ignored []error
+
 	// Run init step such as load Pipeline variables first
-	t.ContextPipeline.initStep(localContextBytes)
-	t.DataPipeline.initStep(event.Data())
+	errs, err := t.ContextPipeline.initStep(ctx, documents.context, documents)
+	ignored = append(ignored, errs...)
+	if err == nil && !dataFormat.pass {
+		errs, err = t.DataPipeline.initStep(ctx, documents.data, documents)
+		ignored = append(ignored, errs...)
+	}
+	if errors.Is(err, transformer.ErrDropEvent) {
+		logger.Debug("Dropping event")
+		return nil, key, nil
+	}
+	if err != nil {
+		logger.Errorw("Cannot apply init step", zap.Error(err))
+		return nil, key, fmt.Errorf("cannot apply init step: %w", err)
+	}
+
+	if t.deduplicator != nil {
+		var seen bool
+		key, seen, err = t.deduplicator.check(event, documents, t.ContextPipeline.variables)
+		if err != nil {
+			logger.Errorw("Cannot check if event is duplicate", zap.Error(err))
+			return nil, "", fmt.Errorf("cannot check if event is duplicate: %w", err)
+		}
+		if seen {
+			logger.Debugf("Dropping duplicate event %q", key)
+			return nil, "", nil
+		}
+	}
+
+	// duplicates are dropped before they take the rate limit tokens
+	if t.rateLimiter != nil {
+		limitErr := t.rateLimiter.check(ctx, documents)
+		if errors.Is(limitErr, transformer.ErrDropEvent) {
+			return nil, key, nil
+		}
+		if limitErr != nil {
+			return nil, key, limitErr
+		}
+	}
 
 	// CE Context transformation
-	localContextBytes, err = t.ContextPipeline.apply(localContextBytes)
+	documents.context, errs, err = t.ContextPipeline.apply(ctx, documents.context, documents)
+	ignored = append(ignored, errs...)
+	if errors.Is(err, transformer.ErrDropEvent) {
+		logger.Debug("Dropping event")
+		return nil, key, nil
+	}
 	if err != nil {
-		log.Printf("Cannot apply transformation on CE context: %v", err)
-		return nil, fmt.Errorf("cannot apply transformation on CE context: %w", err)
+		logger.Errorw("Cannot apply transformation on CE context", zap.Error(err))
+		return nil, key, fmt.Errorf("cannot apply transformation on CE context: %w", err)
 	}
 
+	localContextBytes, err := convert.Marshal(documents.context)
+	if err != nil {
+		logger.Errorw("Cannot encode CE new context", zap.Error(err))
+		return nil, key, fmt.Errorf("cannot encode CE new context: %w", err)
+	}
 	if err := json.Unmarshal(localContextBytes, &localContext); err != nil {
-		log.Printf("Cannot decode CE new context: %v", err)
-		return nil, fmt.Errorf("cannot decode CE new context: %w", err)
+		logger.Errorw("Cannot decode CE new context", zap.Error(err))
+		return nil, key, fmt.Errorf("cannot decode CE new context: %w", err)
 	}
 	event.Context = localContext
 	for k, v := range localContext.Extensions {
 		if err := event.Context.SetExtension(k, v); err != nil {
-			log.Printf("Cannot set CE extension: %v", err)
-			return nil, fmt.Errorf("cannot set CE extension: %w", err)
+			logger.Errorw("Cannot set CE extension", zap.Error(err))
+			return nil, key, fmt.Errorf("cannot set CE extension: %w", err)
+		}
+	}
+
+	if dataFormat.pass {
+		if err := annotateErrors(&event, ignored); err != nil {
+			logger.Errorw("Cannot set CE extension", zap.Error(err))
+			return nil, key, fmt.Errorf("cannot set CE extension: %w", err)
 		}
+		logger.Debug("Sending event with unsupported data as is")
+		return &event, key, nil
 	}
 
 	// CE Data transformation
-	data, err := t.DataPipeline.apply(event.Data())
+	documents.data, errs, err = t.DataPipeline.apply(ctx, documents.data, documents)
+	ignored = append(ignored, errs...)
+	if errors.Is(err, transformer.ErrDropEvent) {
+		logger.Debug("Dropping event")
+		return nil, key, nil
+	}
 	if err != nil {
-		log.Printf("Cannot apply transformation on CE data: %v", err)
-		return nil, fmt.Errorf("cannot apply transformation on CE data: %w", err)
+		logger.Errorw("Cannot apply transformation on CE data", zap.Error(err))
+		return nil, key, fmt.Errorf("cannot apply transformation on CE data: %w", err)
+	}
+
+	t.payloads.log(ctx, "Payload after transformation", event, documents.data)
+
+	var validationErr error
+	if t.validator != nil {
+		validationErr = validate(t.validator.output, documents.data)
+	}
+
+	// empty data that has not been set by the operations stays empty
+	contentType, data := cloudevents.ApplicationJSON, event.Data()
+	if len(data) != 0 || documents.data != nil {
+		if contentType, data, err = t.encodeData(dataFormat, documents.data); err != nil {
+			logger.Errorw("Cannot encode CE data", zap.Error(err))
+			return nil, key, fmt.Errorf("cannot encode CE data: %w", err)
+		}
+	}
+	if err = event.SetData(contentType, data); err != nil {
+		logger.Errorw("Cannot set data", zap.Error(err))
+		return nil, key, fmt.Errorf("cannot set data: %w", err)
 	}
-	if err = event.SetData(cloudevents.ApplicationJSON, data); err != nil {
-		log.Printf("Cannot set data: %v", err)
-		return nil, fmt.Errorf("cannot set data: %w", err)
+
+	if err := annotateErrors(&event, ignored); err != nil {
+		logger.Errorw("Cannot set CE extension", zap.Error(err))
+		return nil, key, fmt.Errorf("cannot set CE extension: %w", err)
+	}
+
+	if t.validator != nil {
+		if t.validator.outputID != "" {
+			event.SetDataSchema(t.validator.outputID)
+		}
+		if err := t.validator.enforce(ctx, validationErr, &event); err != nil {
+			return nil, key, err
+		}
 	}
 
-	log.Printf("Sending %q event", event.Type())
-	return &event, nil
+	logger.Debug("Sending event")
+	return &event, key, nil
+}
+
+// decodeDocument returns the value decoded into a JSON tree.
+func decodeDocument(value interface{}) (interface{}, error) {
+	raw, err := convert.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return convert.Decode(raw)
 }
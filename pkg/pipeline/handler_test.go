@@ -19,13 +19,47 @@ package pipeline
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/extensions"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
 	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"knative.dev/pkg/logging"
 
 	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/configmap"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/queue"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/k8slookup"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/lookup"
 )
 
 var availableTransformations = []v1alpha1.Transform{
@@ -40,6 +74,26 @@ func TestNewHandler(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestInvalidPaths(t *testing.T) {
+	_, err := NewHandler([]v1alpha1.Transform{{
+		Operation: "add",
+		Paths:     []v1alpha1.Path{{Key: "foo..bar", Value: "baz"}},
+	}}, []v1alpha1.Transform{{
+		Operation: "shift",
+		Paths:     []v1alpha1.Path{{Key: "foo:bar"}, {Key: "foo"}},
+	}, {
+		Operation: "rename",
+	}, {
+		Operation: "store",
+		Paths:     []v1alpha1.Path{{Key: "$foo", Value: "foo[x]"}, {Key: "$bar", Value: "bar[1]"}},
+	}})
+	assert.EqualError(t, err, "invalid transformations: "+
+		`context[0].paths[0]: transformation "add": path "foo..bar" has empty key; `+
+		`data[0].paths[1]: transformation "shift": key "foo" must be the old and the new path separated by ":"; `+
+		`data[1]: transformation "rename" not found; `+
+		`data[2].paths[0]: transformation "store": path "foo[x]": key "foo[x]" has invalid array index`)
+}
+
 func TestStart(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -90,7 +144,7 @@ func TestReceiveAndTransform(t *testing.T) {
 			name: "Add operation",
 			originalEvent: setData(t, newEvent(),
 				json.RawMessage(`{"foo":"bar","blah":[{"bleh":"huh?"}]}`)),
-			expectedEventData: `{"blah":[{"bleh":"no"},null,{"foo":"42"}],"foo":"baz","message":"Hello World!","object":{"message":"hey","slice":[null,"sup"]}}`,
+			expectedEventData: `{"foo":"baz","blah":[{"bleh":"no"},null,{"foo":"42"}],"message":"Hello World!","object":{"message":"hey","slice":[null,"sup"]}}`,
 			data: []v1alpha1.Transform{
 				{
 					Operation: "add",
@@ -215,6 +269,104 @@ func TestReceiveAndTransform(t *testing.T) {
 					},
 				},
 			},
+		}, {
+			name: "Store object, modify the source and add a copy",
+			originalEvent: setData(t, newEvent(),
+				json.RawMessage(`{"object":{"foo":"bar"}}`)),
+			expectedEventData: `{"object":{"foo":"baz"},"copy":{"foo":"qux"},"second":{"foo":"bar"}}`,
+			data: []v1alpha1.Transform{
+				{
+					Operation: "store",
+					Paths: []v1alpha1.Path{
+						{
+							Key:   "$object",
+							Value: "object",
+						},
+					},
+				}, {
+					Operation: "add",
+					Paths: []v1alpha1.Path{
+						{
+							Key:   "object.foo",
+							Value: "baz",
+						}, {
+							Key:   "copy",
+							Value: "$object",
+						}, {
+							Key:   "copy.foo",
+							Value: "qux",
+						}, {
+							Key:   "second",
+							Value: "$object",
+						},
+					},
+				},
+			},
+		}, {
+			name: "Keep the order of keys",
+			originalEvent: setData(t, newEvent(),
+				json.RawMessage(`{"zulu":1,"bravo":{"yankee":true,"alpha":"x"},"mike":[{"kilo":2,"charlie":3}],"echo":"e"}`)),
+			expectedEventData: `{"bravo":{"yankee":true,"alpha":"x","new":"value"},"mike":[{"charlie":3}],"echo":"e","moved":1}`,
+			data: []v1alpha1.Transform{
+				{
+					Operation: "add",
+					Paths: []v1alpha1.Path{
+						{
+							Key:   "bravo.new",
+							Value: "value",
+						},
+					},
+				}, {
+					Operation: "shift",
+					Paths: []v1alpha1.Path{
+						{
+							Key: "zulu:moved",
+						},
+					},
+				}, {
+					Operation: "delete",
+					Paths: []v1alpha1.Path{
+						{
+							Key: "mike[0].kilo",
+						},
+					},
+				},
+			},
+		}, {
+			name: "Numbers keep their precision and format",
+			originalEvent: setData(t, newEvent(),
+				json.RawMessage(`{"id":1234567890123456789,"price":1.10,"qty":2,"total":2.2e1,"parent":{"id":1234567890123456788}}`)),
+			expectedEventData: `{"id":1234567890123456789,"price":1.10,"total":2.2e1,"parent":{},"user":{"id":1234567890123456789}}`,
+			data: []v1alpha1.Transform{
+				{
+					Operation: "store",
+					Paths: []v1alpha1.Path{
+						{
+							Key:   "$id",
+							Value: "id",
+						},
+					},
+				}, {
+					Operation: "add",
+					Paths: []v1alpha1.Path{
+						{
+							Key:   "user.id",
+							Value: "$id",
+						},
+					},
+				}, {
+					Operation: "delete",
+					Paths: []v1alpha1.Path{
+						{
+							// the number differs from "id" in the last digit
+							Value: "1234567890123456788",
+						}, {
+							Key:   "qty",
+							Value: "2.0",
+						},
+					},
+				},
+			},
 		},
 	}
 
@@ -223,10 +375,1982 @@ func TestReceiveAndTransform(t *testing.T) {
 			pipeline, err := NewHandler([]v1alpha1.Transform{}, tc.data)
 			assert.NoError(t, err)
 
-			transformedEvent, err := pipeline.applyTransformations(tc.originalEvent)
+			transformedEvent, _, err := pipeline.transform(context.Background(), tc.originalEvent)
 			assert.NoError(t, err)
 
 			assert.Equal(t, tc.expectedEventData, string(transformedEvent.Data()))
 		})
 	}
 }
+
+func TestDataEncoding(t *testing.T) {
+	testCases := []struct {
+		name                string
+		encoding            *v1alpha1.Encoding
+		contentType         string
+		data                []byte
+		expectedContentType string
+		expectedData        []byte
+	}{
+		{
+			name:                "CBOR to JSON",
+			contentType:         "application/cbor",
+			data:                []byte{0xa1, 0x63, 'f', 'o', 'o', 0x63, 'b', 'a', 'r'},
+			expectedContentType: cloudevents.ApplicationJSON,
+			expectedData:        []byte(`{"foo":"bar","new":"value"}`),
+		}, {
+			name:                "JSON to MessagePack",
+			encoding:            &v1alpha1.Encoding{Output: "application/msgpack"},
+			contentType:         cloudevents.ApplicationJSON,
+			data:                []byte(`{"foo":"bar"}`),
+			expectedContentType: "application/msgpack",
+			expectedData:        []byte{0x82, 0xa3, 'f', 'o', 'o', 0xa3, 'b', 'a', 'r', 0xa3, 'n', 'e', 'w', 0xa5, 'v', 'a', 'l', 'u', 'e'},
+		}, {
+			name: "Wrap unsupported data",
+			encoding: &v1alpha1.Encoding{
+				Unsupported: &v1alpha1.UnsupportedData{
+					Policy: v1alpha1.UnsupportedDataWrap,
+					Key:    "raw",
+				},
+			},
+			contentType:         "text/plain",
+			data:                []byte("hello"),
+			expectedContentType: cloudevents.ApplicationJSON,
+			expectedData:        []byte(`{"raw":"aGVsbG8=","new":"value"}`),
+		}, {
+			name: "Pass unsupported data",
+			encoding: &v1alpha1.Encoding{
+				Unsupported: &v1alpha1.UnsupportedData{
+					Policy: v1alpha1.UnsupportedDataPass,
+				},
+			},
+			contentType:         "text/plain",
+			data:                []byte("hello"),
+			expectedContentType: "text/plain",
+			expectedData:        []byte("hello"),
+		},
+	}
+
+	data := []v1alpha1.Transform{
+		{
+			Operation: "add",
+			Paths: []v1alpha1.Path{
+				{
+					Key:   "new",
+					Value: "value",
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline, err := NewHandler([]v1alpha1.Transform{}, data, Encoding(tc.encoding))
+			assert.NoError(t, err)
+
+			event := newEvent()
+			assert.NoError(t, event.SetData(tc.contentType, tc.data))
+
+			transformedEvent, _, err := pipeline.transform(context.Background(), event)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tc.expectedContentType, transformedEvent.DataContentType())
+			assert.Equal(t, tc.expectedData, transformedEvent.Data())
+		})
+	}
+}
+
+func TestValidation(t *testing.T) {
+	schema := &v1alpha1.JSONSchema{
+		Inline: `{"$id": "https://example.com/test.json", "type": "object", "required": ["foo"]}`,
+	}
+
+	testCases := []struct {
+		name       string
+		policy     string
+		data       string
+		expectErr  bool
+		deadLetter bool
+		annotation bool
+	}{
+		{
+			name:   "Valid data",
+			policy: v1alpha1.ValidationReject,
+			data:   `{"foo":"bar"}`,
+		}, {
+			name:      "Reject invalid data",
+			policy:    v1alpha1.ValidationReject,
+			data:      `{"bar":"foo"}`,
+			expectErr: true,
+		}, {
+			name:       "Dead letter invalid data",
+			policy:     v1alpha1.ValidationDeadLetter,
+			data:       `{"bar":"foo"}`,
+			expectErr:  true,
+			deadLetter: true,
+		}, {
+			name:       "Annotate invalid data",
+			policy:     v1alpha1.ValidationAnnotate,
+			data:       `{"bar":"foo"}`,
+			annotation: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline, err := NewHandler([]v1alpha1.Transform{}, []v1alpha1.Transform{},
+				Validation(&v1alpha1.Validation{
+					Input:  schema,
+					Output: schema,
+					Policy: tc.policy,
+				}),
+			)
+			assert.NoError(t, err)
+
+			transformedEvent, _, err := pipeline.transform(context.Background(), setData(t, newEvent(), json.RawMessage(tc.data)))
+			if tc.expectErr {
+				assert.Error(t, err)
+				var dlErr *deadLetterError
+				assert.Equal(t, tc.deadLetter, errors.As(err, &dlErr))
+				return
+			}
+			assert.NoError(t, err)
+
+			assert.Equal(t, "https://example.com/test.json", transformedEvent.DataSchema())
+			_, annotated := transformedEvent.Extensions()[validationErrorExtension]
+			assert.Equal(t, tc.annotation, annotated)
+		})
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	testCases := []struct {
+		name         string
+		context      []v1alpha1.Transform
+		data         []v1alpha1.Transform
+		originalData json.RawMessage
+		expectedType string
+		expectedData json.RawMessage
+		expectErr    bool
+	}{
+		{
+			name: "Compute values from context, data and variables",
+			context: []v1alpha1.Transform{{
+				Operation: "store",
+				Paths:     []v1alpha1.Path{{Key: "$source", Value: "source"}},
+			}},
+			data: []v1alpha1.Transform{{
+				Operation: "compute",
+				Paths: []v1alpha1.Path{
+					{Key: "total", Value: "data.items[0].price * double(data.items[0].qty) + double(data.items[1].price)"},
+					{Key: "origin", Value: `context.type + "/" + vars["$source"]`},
+					{Key: "big", Value: "data.items.exists(i, i.price > 10)"},
+				},
+			}},
+			originalData: json.RawMessage(`{"items":[{"price":2.5,"qty":2},{"price":20,"qty":1}]}`),
+			expectedType: "test",
+			expectedData: json.RawMessage(`{"items":[{"price":2.5,"qty":2},{"price":20,"qty":1}],"total":25,"origin":"test/test","big":true}`),
+		}, {
+			name: "Conditional operations",
+			context: []v1alpha1.Transform{{
+				Operation: "add",
+				Condition: "data.amount > 100",
+				Paths:     []v1alpha1.Path{{Key: "type", Value: "large.order"}},
+			}, {
+				Operation: "add",
+				Condition: "data.amount <= 100",
+				Paths:     []v1alpha1.Path{{Key: "type", Value: "small.order"}},
+			}},
+			data: []v1alpha1.Transform{{
+				Operation: "delete",
+				Condition: `context.type == "large.order"`,
+				Paths:     []v1alpha1.Path{{Key: "amount"}},
+			}},
+			originalData: json.RawMessage(`{"amount":150}`),
+			expectedType: "large.order",
+			expectedData: json.RawMessage(`{}`),
+		}, {
+			name: "Big integers",
+			data: []v1alpha1.Transform{{
+				Operation: "compute",
+				Condition: "data.id == 1234567890123456789 && data.price > 1",
+				Paths: []v1alpha1.Path{
+					{Key: "next", Value: "data.id + 1"},
+					{Key: "parent", Value: "data.parent"},
+					{Key: "total", Value: "data.price * 2.0"},
+				},
+			}},
+			originalData: json.RawMessage(`{"id":1234567890123456789,"price":1.10,"parent":{"id":1234567890123456788}}`),
+			expectedType: "test",
+			expectedData: json.RawMessage(`{"id":1234567890123456789,"price":1.10,"parent":{"id":1234567890123456788},"next":1234567890123456790,"total":2.2}`),
+		}, {
+			name: "Numbers are typed as they are written",
+			data: []v1alpha1.Transform{{
+				Operation: "compute",
+				Paths: []v1alpha1.Path{
+					{Key: "next", Value: "data.count + 1"},
+					{Key: "double", Value: "data.ratio * 2.0"},
+					{Key: "types", Value: "type(data.count) == int && type(data.ratio) == double"},
+				},
+			}},
+			originalData: json.RawMessage(`{"count":41,"ratio":1.0}`),
+			expectedType: "test",
+			expectedData: json.RawMessage(`{"count":41,"ratio":1.0,"next":42,"double":2,"types":true}`),
+		}, {
+			name: "Condition is not bool",
+			data: []v1alpha1.Transform{{
+				Operation: "delete",
+				Condition: "data.amount",
+				Paths:     []v1alpha1.Path{{Key: "amount"}},
+			}},
+			originalData: json.RawMessage(`{"amount":150}`),
+			expectErr:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline, err := NewHandler(tc.context, tc.data)
+			assert.NoError(t, err)
+
+			transformedEvent, _, err := pipeline.transform(context.Background(), setData(t, newEvent(), tc.originalData))
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			assert.Equal(t, tc.expectedType, transformedEvent.Type())
+			assert.Equal(t, []byte(tc.expectedData), transformedEvent.Data())
+		})
+	}
+}
+
+func TestInvalidExpressions(t *testing.T) {
+	_, err := NewHandler(nil, []v1alpha1.Transform{{
+		Operation: "compute",
+		Paths:     []v1alpha1.Path{{Key: "foo", Value: "data.foo +"}},
+	}})
+	assert.Error(t, err)
+
+	_, err = NewHandler([]v1alpha1.Transform{{
+		Operation: "add",
+		Condition: "unknown.foo",
+		Paths:     []v1alpha1.Path{{Key: "foo", Value: "bar"}},
+	}}, nil)
+	assert.Error(t, err)
+}
+
+func TestJQ(t *testing.T) {
+	testCases := []struct {
+		name         string
+		context      []v1alpha1.Transform
+		data         []v1alpha1.Transform
+		originalData json.RawMessage
+		expectedType string
+		expectedData json.RawMessage
+		dropped      bool
+		expectErr    bool
+	}{
+		{
+			name: "Replace data",
+			data: []v1alpha1.Transform{{
+				Operation: "jq",
+				Paths:     []v1alpha1.Path{{Value: "{id: .order.id, names: [.items[].name]}"}},
+			}},
+			originalData: json.RawMessage(`{"order":{"id":1},"items":[{"name":"foo"},{"name":"bar"}]}`),
+			expectedType: "test",
+			expectedData: json.RawMessage(`{"id":1,"names":["foo","bar"]}`),
+		}, {
+			name: "Write result to path",
+			data: []v1alpha1.Transform{{
+				Operation: "jq",
+				Paths:     []v1alpha1.Path{{Key: "summary.count", Value: ".items | length"}},
+			}},
+			originalData: json.RawMessage(`{"items":[1,2,3]}`),
+			expectedType: "test",
+			expectedData: json.RawMessage(`{"items":[1,2,3],"summary":{"count":3}}`),
+		}, {
+			name: "Collect multiple results",
+			data: []v1alpha1.Transform{{
+				Operation: "jq",
+				Paths:     []v1alpha1.Path{{Value: "[.items[] | select(. > 1)]"}},
+			}},
+			originalData: json.RawMessage(`{"items":[1,2,3]}`),
+			expectedType: "test",
+			expectedData: json.RawMessage(`[2,3]`),
+		}, {
+			name: "Multiple results",
+			data: []v1alpha1.Transform{{
+				Operation: "jq",
+				Paths:     []v1alpha1.Path{{Key: "large", Value: ".items[] | select(. > 1)"}},
+			}},
+			originalData: json.RawMessage(`{"items":[1,2,3]}`),
+			expectErr:    true,
+		}, {
+			name: "Big integers and unchanged input",
+			data: []v1alpha1.Transform{{
+				Operation: "jq",
+				Paths:     []v1alpha1.Path{{Key: "next", Value: ".id + 1"}},
+			}},
+			originalData: json.RawMessage(`{"id":1234567890123456789,"price":1.10}`),
+			expectedType: "test",
+			expectedData: json.RawMessage(`{"id":1234567890123456789,"price":1.10,"next":1234567890123456790}`),
+		}, {
+			name: "Transform context",
+			context: []v1alpha1.Transform{{
+				Operation: "jq",
+				Paths:     []v1alpha1.Path{{Value: `.type = "jq." + .type`}},
+			}},
+			originalData: json.RawMessage(`{}`),
+			expectedType: "jq.test",
+			expectedData: json.RawMessage(`{}`),
+		}, {
+			name: "Drop event",
+			data: []v1alpha1.Transform{{
+				Operation: "jq",
+				Paths:     []v1alpha1.Path{{Value: "select(.important)"}},
+			}},
+			originalData: json.RawMessage(`{"important":false}`),
+			dropped:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline, err := NewHandler(tc.context, tc.data)
+			assert.NoError(t, err)
+
+			transformedEvent, _, err := pipeline.transform(context.Background(), setData(t, newEvent(), tc.originalData))
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if tc.dropped {
+				assert.Nil(t, transformedEvent)
+				return
+			}
+
+			assert.Equal(t, tc.expectedType, transformedEvent.Type())
+			assert.Equal(t, []byte(tc.expectedData), transformedEvent.Data())
+		})
+	}
+
+	_, err := NewHandler(nil, []v1alpha1.Transform{{
+		Operation: "jq",
+		Paths:     []v1alpha1.Path{{Value: ".foo |"}},
+	}})
+	assert.Error(t, err)
+}
+
+func TestScript(t *testing.T) {
+	testCases := []struct {
+		name         string
+		context      []v1alpha1.Transform
+		data         []v1alpha1.Transform
+		originalData json.RawMessage
+		expectedType string
+		expectedData json.RawMessage
+		dropped      bool
+		expectErr    bool
+	}{
+		{
+			name: "Transform data with context and variables",
+			context: []v1alpha1.Transform{{
+				Operation: "script",
+				Paths: []v1alpha1.Path{{Value: `
+function transform(event) {
+  event.vars["$originalType"] = event.context.type;
+  event.context.type = "script." + event.context.type;
+  return event;
+}`}},
+			}},
+			data: []v1alpha1.Transform{{
+				Operation: "script",
+				Paths: []v1alpha1.Path{{Key: "reshape", Value: `
+const codes = {US: "United States", DE: "Germany"};
+function reshape(event) {
+  const names = [];
+  for (const item of event.data.items) {
+    if (item.qty > 0) names.push(item.name.toUpperCase());
+  }
+  return {data: {names: names, country: codes[event.data.country], type: event.vars["$originalType"]}};
+}`}},
+			}},
+			originalData: json.RawMessage(`{"country":"DE","items":[{"name":"foo","qty":1},{"name":"bar","qty":0}]}`),
+			expectedType: "script.test",
+			expectedData: json.RawMessage(`{"names":["FOO"],"country":"Germany","type":"test"}`),
+		}, {
+			name: "Drop event",
+			data: []v1alpha1.Transform{{
+				Operation: "script",
+				Paths:     []v1alpha1.Path{{Value: `function transform(event) { return null; }`}},
+			}},
+			originalData: json.RawMessage(`{}`),
+			dropped:      true,
+		}, {
+			name: "Large integers",
+			data: []v1alpha1.Transform{{
+				Operation: "script",
+				Paths:     []v1alpha1.Path{{Value: `function transform(event) { event.data.copy = event.data.id; return event; }`}},
+			}},
+			originalData: json.RawMessage(`{"id":9007199254740993}`),
+			expectedData: json.RawMessage(`{"id":9007199254740993,"copy":9007199254740993}`),
+			expectedType: "test",
+		}, {
+			name: "Endless loop",
+			data: []v1alpha1.Transform{{
+				Operation: "script",
+				Paths:     []v1alpha1.Path{{Value: `function transform(event) { for (;;) {} }`}},
+				Script:    &v1alpha1.ScriptLimits{Timeout: &metav1.Duration{Duration: 100 * time.Millisecond}},
+			}},
+			originalData: json.RawMessage(`{}`),
+			expectErr:    true,
+		}, {
+			name: "Endless recursion",
+			data: []v1alpha1.Transform{{
+				Operation: "script",
+				Paths:     []v1alpha1.Path{{Value: `function transform(event) { return transform(event); }`}},
+			}},
+			originalData: json.RawMessage(`{}`),
+			expectErr:    true,
+		}, {
+			name: "No host access",
+			data: []v1alpha1.Transform{{
+				Operation: "script",
+				Paths:     []v1alpha1.Path{{Value: `function transform(event) { return require("fs"); }`}},
+			}},
+			originalData: json.RawMessage(`{}`),
+			expectErr:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline, err := NewHandler(tc.context, tc.data)
+			assert.NoError(t, err)
+
+			transformedEvent, _, err := pipeline.transform(context.Background(), setData(t, newEvent(), tc.originalData))
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if tc.dropped {
+				assert.Nil(t, transformedEvent)
+				return
+			}
+
+			assert.Equal(t, tc.expectedType, transformedEvent.Type())
+			assert.Equal(t, []byte(tc.expectedData), transformedEvent.Data())
+		})
+	}
+
+	_, err := NewHandler(nil, []v1alpha1.Transform{{
+		Operation: "script",
+		Paths:     []v1alpha1.Path{{Value: "function transform(event) {"}},
+	}})
+	assert.Error(t, err)
+}
+
+func TestWasm(t *testing.T) {
+	module, err := ioutil.ReadFile("testdata/upper.wasm")
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		path         v1alpha1.Path
+		expectedData json.RawMessage
+		dropped      bool
+		expectErr    bool
+	}{
+		{
+			name:         "Module from file",
+			path:         v1alpha1.Path{Value: "testdata/upper.wasm"},
+			expectedData: json.RawMessage(`{"FOO":"BAR"}`),
+		}, {
+			name:         "Inline module",
+			path:         v1alpha1.Path{Key: "transform", Value: string(module)},
+			expectedData: json.RawMessage(`{"FOO":"BAR"}`),
+		}, {
+			name:    "Drop event",
+			path:    v1alpha1.Path{Key: "drop", Value: string(module)},
+			dropped: true,
+		}, {
+			name:      "Execution timeout",
+			path:      v1alpha1.Path{Key: "loop", Value: string(module)},
+			expectErr: true,
+		}, {
+			name:      "Memory limit",
+			path:      v1alpha1.Path{Key: "grow", Value: string(module)},
+			expectErr: true,
+		},
+	}
+
+	limits := &v1alpha1.WasmLimits{
+		Timeout:  &metav1.Duration{Duration: 100 * time.Millisecond},
+		PoolSize: 2,
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline, err := NewHandler(nil, []v1alpha1.Transform{{
+				Operation: "wasm",
+				Paths:     []v1alpha1.Path{tc.path},
+				Wasm:      limits,
+			}})
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer pipeline.close()
+
+			for i := 0; i < limits.PoolSize+1; i++ {
+				transformedEvent, _, err := pipeline.transform(context.Background(), setData(t, newEvent(), json.RawMessage(`{"foo":"bar"}`)))
+				if tc.expectErr {
+					assert.Error(t, err)
+					continue
+				}
+				assert.NoError(t, err)
+				if tc.dropped {
+					assert.Nil(t, transformedEvent)
+					continue
+				}
+				assert.Equal(t, []byte(tc.expectedData), transformedEvent.Data())
+			}
+		})
+	}
+
+	_, err = NewHandler(nil, []v1alpha1.Transform{{
+		Operation: "wasm",
+		Paths:     []v1alpha1.Path{{Key: "missing", Value: string(module)}},
+	}})
+	assert.Error(t, err)
+}
+
+func TestLookup(t *testing.T) {
+	defaultValue := "unknown"
+	table := map[string]string{
+		"1":       "low",
+		"2":       "high",
+		"octocat": "U123",
+	}
+
+	testCases := []struct {
+		name         string
+		context      []v1alpha1.Transform
+		data         []v1alpha1.Transform
+		originalData json.RawMessage
+		expectedData json.RawMessage
+		dropped      bool
+	}{
+		{
+			name: "Replace value",
+			data: []v1alpha1.Transform{{
+				Operation: "lookup",
+				Paths:     []v1alpha1.Path{{Key: "severity"}},
+				Lookup:    &v1alpha1.LookupTable{Table: table},
+			}},
+			originalData: json.RawMessage(`{"severity":2}`),
+			expectedData: json.RawMessage(`{"severity":"high"}`),
+		}, {
+			name: "Variable to path",
+			context: []v1alpha1.Transform{{
+				Operation: "store",
+				Paths:     []v1alpha1.Path{{Key: "$user", Value: "subject"}},
+			}},
+			data: []v1alpha1.Transform{{
+				Operation: "lookup",
+				Paths:     []v1alpha1.Path{{Key: "$user", Value: "slack.user"}},
+				Lookup:    &v1alpha1.LookupTable{Table: table},
+			}},
+			originalData: json.RawMessage(`{}`),
+			expectedData: json.RawMessage(`{"slack":{"user":"U123"}}`),
+		}, {
+			name: "Keep missing value",
+			data: []v1alpha1.Transform{{
+				Operation: "lookup",
+				Paths:     []v1alpha1.Path{{Key: "severity"}},
+				Lookup:    &v1alpha1.LookupTable{Table: table},
+			}},
+			originalData: json.RawMessage(`{"severity":3}`),
+			expectedData: json.RawMessage(`{"severity":3}`),
+		}, {
+			name: "Default value",
+			data: []v1alpha1.Transform{{
+				Operation: "lookup",
+				Paths:     []v1alpha1.Path{{Key: "severity", Value: "level"}},
+				Lookup:    &v1alpha1.LookupTable{Table: table, Default: &defaultValue},
+			}},
+			originalData: json.RawMessage(`{}`),
+			expectedData: json.RawMessage(`{"level":"unknown"}`),
+		}, {
+			name: "Drop on miss",
+			data: []v1alpha1.Transform{{
+				Operation: "lookup",
+				Paths:     []v1alpha1.Path{{Key: "severity"}},
+				Lookup:    &v1alpha1.LookupTable{Table: table, DropOnMiss: true},
+			}},
+			originalData: json.RawMessage(`{"severity":3}`),
+			dropped:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline, err := NewHandler(tc.context, tc.data)
+			assert.NoError(t, err)
+
+			event := newEvent()
+			event.SetSubject("octocat")
+			transformedEvent, _, err := pipeline.transform(context.Background(), setData(t, event, tc.originalData))
+			assert.NoError(t, err)
+			if tc.dropped {
+				assert.Nil(t, transformedEvent)
+				return
+			}
+			assert.Equal(t, []byte(tc.expectedData), transformedEvent.Data())
+		})
+	}
+}
+
+func TestLookupConfigMapReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configmaps")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	defer func(path string) { configmap.MountPath = path }(configmap.MountPath)
+	configmap.MountPath = dir
+	defer func(interval time.Duration) { lookup.ReloadInterval = interval }(lookup.ReloadInterval)
+	lookup.ReloadInterval = 0
+
+	file := configmap.Path("regions", "regions.yaml")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+	assert.NoError(t, ioutil.WriteFile(file, []byte("us: United States\n"), 0644))
+
+	pipeline, err := NewHandler(nil, []v1alpha1.Transform{{
+		Operation: "lookup",
+		Paths:     []v1alpha1.Path{{Key: "region"}},
+		Lookup: &v1alpha1.LookupTable{
+			Table: map[string]string{"us": "USA", "de": "DE"},
+			ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "regions"},
+				Key:                  "regions.yaml",
+			},
+		},
+	}})
+	assert.NoError(t, err)
+
+	transformedEvent, _, err := pipeline.transform(context.Background(), setData(t, newEvent(), json.RawMessage(`{"region":"us"}`)))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`{"region":"United States"}`), transformedEvent.Data())
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte(`{"us": "America", "de": "Germany"}`), 0644))
+	assert.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Minute)))
+
+	transformedEvent, _, err = pipeline.transform(context.Background(), setData(t, newEvent(), json.RawMessage(`{"region":"de"}`)))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`{"region":"Germany"}`), transformedEvent.Data())
+}
+
+func TestEnrich(t *testing.T) {
+	var requests, failures int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Query().Get("fail") != "" && atomic.AddInt32(&failures, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"path":"` + r.URL.Path + `","issue":{"title":"Bug","labels":["p1"]}}`))
+	}))
+	defer server.Close()
+
+	ttl := metav1.Duration{Duration: time.Minute}
+	store := v1alpha1.Transform{
+		Operation: "store",
+		Paths:     []v1alpha1.Path{{Key: "$issue", Value: "number"}},
+	}
+
+	testCases := []struct {
+		name             string
+		request          v1alpha1.EnrichRequest
+		paths            []v1alpha1.Path
+		expectedData     json.RawMessage
+		expectedRequests int32
+		expectErr        bool
+	}{
+		{
+			name: "Response to data path",
+			request: v1alpha1.EnrichRequest{
+				URL:     server.URL + "/issues/$issue",
+				Headers: map[string]string{"Authorization": "Bearer token"},
+			},
+			paths:            []v1alpha1.Path{{Key: "details"}},
+			expectedData:     json.RawMessage(`{"number":42,"details":{"path":"/issues/42","issue":{"title":"Bug","labels":["p1"]}}}`),
+			expectedRequests: 1,
+		}, {
+			name: "Cached response paths",
+			request: v1alpha1.EnrichRequest{
+				URL:      server.URL + "/issues/$issue",
+				Headers:  map[string]string{"Authorization": "Bearer token"},
+				CacheTTL: &ttl,
+			},
+			paths: []v1alpha1.Path{
+				{Key: "title", Value: "issue.title"},
+				{Key: "$labels", Value: "issue.labels"},
+			},
+			expectedData:     json.RawMessage(`{"number":42,"title":"Bug"}`),
+			expectedRequests: 1,
+		}, {
+			name: "Retry failed request",
+			request: v1alpha1.EnrichRequest{
+				URL:     server.URL + "/issues/$issue?fail=true",
+				Headers: map[string]string{"Authorization": "Bearer token"},
+				Retries: 2,
+			},
+			paths:            []v1alpha1.Path{{Key: "title", Value: "issue.title"}},
+			expectedData:     json.RawMessage(`{"number":42,"title":"Bug"}`),
+			expectedRequests: 2,
+		}, {
+			name: "Client error",
+			request: v1alpha1.EnrichRequest{
+				URL:     server.URL + "/issues/$issue",
+				Retries: 2,
+			},
+			paths:            []v1alpha1.Path{{Key: "title", Value: "issue.title"}},
+			expectedRequests: 1,
+			expectErr:        true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			atomic.StoreInt32(&requests, 0)
+			atomic.StoreInt32(&failures, 0)
+
+			pipeline, err := NewHandler(nil, []v1alpha1.Transform{store, {
+				Operation: "enrich",
+				Paths:     tc.paths,
+				Enrich:    &tc.request,
+			}})
+			assert.NoError(t, err)
+
+			transformedEvent, _, err := pipeline.transform(context.Background(), setData(t, newEvent(), json.RawMessage(`{"number":42}`)))
+			assert.Equal(t, tc.expectedRequests, atomic.LoadInt32(&requests))
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, []byte(tc.expectedData), transformedEvent.Data())
+		})
+	}
+}
+
+func TestK8sLookup(t *testing.T) {
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"namespace": "shop",
+			"name":      "checkout",
+			"labels": map[string]interface{}{
+				"team": "payments",
+			},
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(3),
+		},
+	}}
+	gvk := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(gvk, meta.RESTScopeNamespace)
+
+	client := k8slookup.NewClient("shop", dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), deployment), mapper)
+
+	object := &v1alpha1.KubernetesObject{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Namespace:  "involvedObject.namespace",
+		Name:       "$name",
+	}
+
+	testCases := []struct {
+		name         string
+		originalData json.RawMessage
+		expectedData json.RawMessage
+		expectErr    bool
+	}{
+		{
+			name:         "Existing object",
+			originalData: json.RawMessage(`{"involvedObject":{"namespace":"shop","name":"checkout"}}`),
+			expectedData: json.RawMessage(`{"involvedObject":{"namespace":"shop","name":"checkout"},"replicas":3,"owner":"payments"}`),
+		}, {
+			name:         "Missing object",
+			originalData: json.RawMessage(`{"involvedObject":{"namespace":"shop","name":"cart"}}`),
+			expectedData: json.RawMessage(`{"involvedObject":{"namespace":"shop","name":"cart"},"owner":"$team"}`),
+		}, {
+			name:         "Object in another namespace",
+			originalData: json.RawMessage(`{"involvedObject":{"namespace":"kube-system","name":"checkout"}}`),
+			expectErr:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline, err := NewHandler(nil, []v1alpha1.Transform{{
+				Operation: "store",
+				Paths:     []v1alpha1.Path{{Key: "$name", Value: "involvedObject.name"}},
+			}, {
+				Operation: "k8slookup",
+				Paths: []v1alpha1.Path{
+					{Key: "$team", Value: "metadata.labels.team"},
+					{Key: "replicas", Value: "spec.replicas"},
+				},
+				K8sLookup: object,
+			}, {
+				Operation: "add",
+				Paths:     []v1alpha1.Path{{Key: "owner", Value: "$team"}},
+			}}, Kubernetes(client))
+			assert.NoError(t, err)
+
+			transformedEvent, _, err := pipeline.transform(context.Background(), setData(t, newEvent(), tc.originalData))
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, []byte(tc.expectedData), transformedEvent.Data())
+		})
+	}
+
+	// secrets cannot be read
+	_, err := NewHandler(nil, []v1alpha1.Transform{{
+		Operation: "k8slookup",
+		Paths:     []v1alpha1.Path{{Key: "token", Value: "data.token"}},
+		K8sLookup: &v1alpha1.KubernetesObject{APIVersion: "v1", Kind: "Secret", Name: "name"},
+	}})
+	assert.Error(t, err)
+}
+
+func TestDeduplication(t *testing.T) {
+	testCases := []struct {
+		name          string
+		deduplication v1alpha1.Deduplication
+		data          []v1alpha1.Transform
+		events        []cloudevents.Event
+		dropped       []bool
+		expectErr     bool
+	}{
+		{
+			name:          "Event ID and source",
+			deduplication: v1alpha1.Deduplication{},
+			events: []cloudevents.Event{
+				setData(t, newEvent(), json.RawMessage(`{}`)),
+				setData(t, newEvent(), json.RawMessage(`{}`)),
+			},
+			dropped: []bool{false, true},
+		}, {
+			name:          "Data path",
+			deduplication: v1alpha1.Deduplication{Path: "delivery.id"},
+			events: []cloudevents.Event{
+				setData(t, newEvent(), json.RawMessage(`{"delivery":{"id":1}}`)),
+				setData(t, newEvent(), json.RawMessage(`{"delivery":{"id":2}}`)),
+				setData(t, newEvent(), json.RawMessage(`{"delivery":{"id":1}}`)),
+				setData(t, newEvent(), json.RawMessage(`{}`)),
+				setData(t, newEvent(), json.RawMessage(`{}`)),
+			},
+			dropped: []bool{false, false, true, false, false},
+		}, {
+			name:          "Expression",
+			deduplication: v1alpha1.Deduplication{Expression: `context.type + ":" + data.issue`},
+			events: []cloudevents.Event{
+				setData(t, newEvent(), json.RawMessage(`{"issue":"1","action":"opened"}`)),
+				setData(t, newEvent(), json.RawMessage(`{"issue":"1","action":"edited"}`)),
+			},
+			dropped: []bool{false, true},
+		}, {
+			name:          "Expression with variables of the event",
+			deduplication: v1alpha1.Deduplication{Expression: `vars["$issue"]`},
+			data: []v1alpha1.Transform{{
+				Operation: "store",
+				Paths:     []v1alpha1.Path{{Key: "$issue", Value: "issue"}},
+			}},
+			events: []cloudevents.Event{
+				setData(t, newEvent(), json.RawMessage(`{"issue":"1"}`)),
+				setData(t, newEvent(), json.RawMessage(`{"issue":"2"}`)),
+				setData(t, newEvent(), json.RawMessage(`{"issue":"1"}`)),
+			},
+			dropped: []bool{false, false, true},
+		}, {
+			name:          "Failed events are not duplicates",
+			deduplication: v1alpha1.Deduplication{},
+			data: []v1alpha1.Transform{{
+				Operation: "compute",
+				Paths:     []v1alpha1.Path{{Key: "foo", Value: "data.missing.foo"}},
+			}},
+			events: []cloudevents.Event{
+				setData(t, newEvent(), json.RawMessage(`{}`)),
+				setData(t, newEvent(), json.RawMessage(`{}`)),
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline, err := NewHandler(nil, tc.data, Deduplication(&tc.deduplication))
+			assert.NoError(t, err)
+
+			for i, event := range tc.events {
+				// keys of the failed events are removed by the receiver
+				transformedEvent, err := pipeline.receiveAndReply(context.Background(), event)
+				if tc.expectErr {
+					assert.Error(t, err)
+					continue
+				}
+				assert.NoError(t, err)
+				assert.Equal(t, tc.dropped[i], transformedEvent == nil)
+			}
+		})
+	}
+}
+
+func TestDeduplicationRedelivery(t *testing.T) {
+	var requests int32
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer sink.Close()
+
+	pipeline, err := NewHandler(nil, nil, Deduplication(&v1alpha1.Deduplication{}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// undelivered event is not a duplicate when redelivered
+	ctx := cloudevents.ContextWithTarget(context.Background(), sink.URL)
+	assert.Error(t, pipeline.receiveAndSend(ctx, setData(t, newEvent(), json.RawMessage(`{}`))))
+	assert.NoError(t, pipeline.receiveAndSend(ctx, setData(t, newEvent(), json.RawMessage(`{}`))))
+	assert.NoError(t, pipeline.receiveAndSend(ctx, setData(t, newEvent(), json.RawMessage(`{}`))))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	eventFrom := func(source, data string) cloudevents.Event {
+		event := setData(t, newEvent(), json.RawMessage(data))
+		event.SetSource(source)
+		return event
+	}
+
+	sequence := []v1alpha1.Transform{{
+		Operation: "increment",
+		Paths:     []v1alpha1.Path{{Key: "sequence-$source", Value: "sequence"}},
+	}}
+	storeSource := []v1alpha1.Transform{{
+		Operation: "store",
+		Paths:     []v1alpha1.Path{{Key: "$source", Value: "source"}},
+	}}
+	fileState := &v1alpha1.State{Backend: v1alpha1.StateFile, Path: filepath.Join(dir, "state.db")}
+
+	testCases := []struct {
+		name     string
+		state    *v1alpha1.State
+		context  []v1alpha1.Transform
+		data     []v1alpha1.Transform
+		events   []cloudevents.Event
+		expected []string
+	}{
+		{
+			name:    "Sequence per source",
+			context: storeSource,
+			data:    sequence,
+			events: []cloudevents.Event{
+				eventFrom("a", `{}`),
+				eventFrom("a", `{}`),
+				eventFrom("b", `{}`),
+			},
+			expected: []string{`{"sequence":1}`, `{"sequence":2}`, `{"sequence":1}`},
+		}, {
+			name: "Running total",
+			data: []v1alpha1.Transform{{
+				Operation: "increment",
+				Paths:     []v1alpha1.Path{{Key: "total", Value: "total"}},
+				Increment: &v1alpha1.Increment{By: "amount"},
+			}},
+			events: []cloudevents.Event{
+				eventFrom("a", `{"amount":10}`),
+				eventFrom("a", `{"amount":2.5}`),
+			},
+			expected: []string{`{"amount":10,"total":10}`, `{"amount":2.5,"total":12.5}`},
+		}, {
+			name: "Delta between events",
+			data: []v1alpha1.Transform{{
+				Operation: "getState",
+				Paths:     []v1alpha1.Path{{Key: "last", Value: "$previous"}},
+			}, {
+				Operation: "setState",
+				Paths:     []v1alpha1.Path{{Key: "last", Value: "temperature"}},
+			}, {
+				Operation: "compute",
+				Condition: `"$previous" in vars`,
+				Paths:     []v1alpha1.Path{{Key: "delta", Value: `data.temperature - vars["$previous"]`}},
+			}},
+			events: []cloudevents.Event{
+				eventFrom("a", `{"temperature":20}`),
+				eventFrom("a", `{"temperature":23}`),
+			},
+			expected: []string{`{"temperature":20}`, `{"delta":3,"temperature":23}`},
+		}, {
+			name:    "File backend",
+			state:   fileState,
+			context: storeSource,
+			data:    sequence,
+			events: []cloudevents.Event{
+				eventFrom("a", `{}`),
+				eventFrom("a", `{}`),
+			},
+			expected: []string{`{"sequence":1}`, `{"sequence":2}`},
+		}, {
+			name:    "File backend after restart",
+			state:   fileState,
+			context: storeSource,
+			data:    sequence,
+			events: []cloudevents.Event{
+				eventFrom("a", `{}`),
+			},
+			expected: []string{`{"sequence":3}`},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline, err := NewHandler(tc.context, tc.data, State(tc.state))
+			assert.NoError(t, err)
+			defer pipeline.state.Close()
+
+			for i, event := range tc.events {
+				transformedEvent, _, err := pipeline.transform(context.Background(), event)
+				assert.NoError(t, err)
+				assert.JSONEq(t, tc.expected[i], string(transformedEvent.Data()))
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	eventFrom := func(repository string) cloudevents.Event {
+		return setData(t, newEvent(), json.RawMessage(`{"repository":"`+repository+`"}`))
+	}
+
+	testCases := []struct {
+		name      string
+		rateLimit v1alpha1.RateLimit
+		events    []cloudevents.Event
+		limited   []bool
+	}{
+		{
+			name:      "Reject",
+			rateLimit: v1alpha1.RateLimit{Rate: 1, Burst: 2},
+			events:    []cloudevents.Event{eventFrom("a"), eventFrom("b"), eventFrom("c")},
+			limited:   []bool{false, false, true},
+		}, {
+			name:      "Drop",
+			rateLimit: v1alpha1.RateLimit{Rate: 1, Policy: v1alpha1.RateLimitDrop},
+			events:    []cloudevents.Event{eventFrom("a"), eventFrom("a")},
+			limited:   []bool{false, true},
+		}, {
+			name:      "Keyed by path",
+			rateLimit: v1alpha1.RateLimit{Rate: 1, Path: "repository"},
+			events:    []cloudevents.Event{eventFrom("a"), eventFrom("a"), eventFrom("b")},
+			limited:   []bool{false, true, false},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline, err := NewHandler(nil, nil, RateLimit(&tc.rateLimit))
+			assert.NoError(t, err)
+
+			for i, event := range tc.events {
+				transformedEvent, _, err := pipeline.transform(context.Background(), event)
+				switch {
+				case !tc.limited[i]:
+					assert.NoError(t, err)
+					assert.NotNil(t, transformedEvent)
+				case tc.rateLimit.Policy == v1alpha1.RateLimitDrop:
+					assert.NoError(t, err)
+					assert.Nil(t, transformedEvent)
+				default:
+					var result *cehttp.Result
+					assert.True(t, errors.As(err, &result))
+					assert.Equal(t, http.StatusTooManyRequests, result.StatusCode)
+				}
+			}
+		})
+	}
+
+	// duplicates are dropped without taking the tokens
+	pipeline, err := NewHandler(nil, nil,
+		RateLimit(&v1alpha1.RateLimit{Rate: 1}),
+		Deduplication(&v1alpha1.Deduplication{}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	event := eventFrom("a")
+	transformedEvent, _, err := pipeline.transform(context.Background(), event)
+	assert.NoError(t, err)
+	assert.NotNil(t, transformedEvent)
+	transformedEvent, _, err = pipeline.transform(context.Background(), event)
+	assert.NoError(t, err)
+	assert.Nil(t, transformedEvent)
+}
+
+func TestSampling(t *testing.T) {
+	eventWithID := func(id int) cloudevents.Event {
+		event := setData(t, newEvent(), json.RawMessage(`{}`))
+		event.SetID(strconv.Itoa(id))
+		return event
+	}
+
+	forwarded := func(percentage, events int) int {
+		pipeline, err := NewHandler(nil, nil, Sampling(&v1alpha1.Sampling{Percentage: percentage}))
+		assert.NoError(t, err)
+
+		count := 0
+		for i := 0; i < events; i++ {
+			event := eventWithID(i)
+			transformedEvent, _, err := pipeline.transform(context.Background(), event)
+			assert.NoError(t, err)
+			// redelivered event gets the same decision
+			redeliveredEvent, _, err := pipeline.transform(context.Background(), event)
+			assert.NoError(t, err)
+			assert.Equal(t, transformedEvent == nil, redeliveredEvent == nil)
+			if transformedEvent != nil {
+				count++
+			}
+		}
+		return count
+	}
+
+	assert.Equal(t, 0, forwarded(0, 100))
+	assert.Equal(t, 100, forwarded(100, 100))
+	assert.InDelta(t, 500, forwarded(50, 1000), 60)
+
+	_, err := NewHandler(nil, nil, Sampling(&v1alpha1.Sampling{Percentage: 101}))
+	assert.Error(t, err)
+}
+
+func TestDeadLetterSink(t *testing.T) {
+	var deadLetters []cloudevents.Event
+	deadLetterSink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event, err := binding.ToEvent(r.Context(), cehttp.NewMessageFromHttpRequest(r))
+		assert.NoError(t, err)
+		deadLetters = append(deadLetters, *event)
+	}))
+	defer deadLetterSink.Close()
+
+	var sinkStatus int
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(sinkStatus)
+	}))
+	defer sink.Close()
+
+	unsupported := newEvent()
+	assert.NoError(t, unsupported.SetData(cloudevents.ApplicationXML, []byte(`<foo/>`)))
+
+	testCases := []struct {
+		name           string
+		deadLetterSink string
+		data           []v1alpha1.Transform
+		rateLimit      *v1alpha1.RateLimit
+		event          cloudevents.Event
+		sinkStatus     int
+		expectErr      bool
+		expectedData   string
+		operation      string
+		errorContains  string
+	}{
+		{
+			name:           "Failed operation",
+			deadLetterSink: deadLetterSink.URL,
+			data: []v1alpha1.Transform{{
+				Operation: "add",
+				Paths:     []v1alpha1.Path{{Key: "bar", Value: "baz"}},
+			}, {
+				Operation: "compute",
+				Paths:     []v1alpha1.Path{{Key: "foo", Value: "data.missing.foo"}},
+			}},
+			event:         setData(t, newEvent(), json.RawMessage(`{"foo":"bar"}`)),
+			expectedData:  `{"foo":"bar"}`,
+			operation:     "compute",
+			errorContains: "cannot apply transformation on CE data",
+		}, {
+			name:           "Unsupported data",
+			deadLetterSink: deadLetterSink.URL,
+			event:          unsupported,
+			expectedData:   `<foo/>`,
+			errorContains:  "is not supported",
+		}, {
+			name:           "Failed delivery",
+			deadLetterSink: deadLetterSink.URL,
+			data: []v1alpha1.Transform{{
+				Operation: "add",
+				Paths:     []v1alpha1.Path{{Key: "bar", Value: "baz"}},
+			}},
+			event:         setData(t, newEvent(), json.RawMessage(`{"foo":"bar"}`)),
+			sinkStatus:    http.StatusInternalServerError,
+			expectedData:  `{"foo":"bar","bar":"baz"}`,
+			errorContains: "cannot deliver event",
+		}, {
+			name:      "No dead letter sink",
+			event:     unsupported,
+			expectErr: true,
+		}, {
+			name:           "Rejected event",
+			deadLetterSink: deadLetterSink.URL,
+			rateLimit:      &v1alpha1.RateLimit{Rate: 1, Burst: 1},
+			event:          setData(t, newEvent(), json.RawMessage(`{}`)),
+			expectErr:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			deadLetters = nil
+			sinkStatus = http.StatusOK
+			if tc.sinkStatus != 0 {
+				sinkStatus = tc.sinkStatus
+			}
+
+			pipeline, err := NewHandler(nil, tc.data,
+				DeadLetterSink(tc.deadLetterSink),
+				RateLimit(tc.rateLimit),
+			)
+			assert.NoError(t, err)
+
+			ctx := cloudevents.ContextWithTarget(context.Background(), sink.URL)
+			err = pipeline.receiveAndSend(ctx, tc.event)
+			if tc.rateLimit != nil {
+				// the first event takes the only token
+				assert.NoError(t, err)
+				err = pipeline.receiveAndSend(ctx, tc.event)
+			}
+			if tc.expectErr {
+				assert.Error(t, err)
+				assert.Empty(t, deadLetters)
+				return
+			}
+			assert.NoError(t, err)
+
+			if !assert.Len(t, deadLetters, 1) {
+				return
+			}
+			deadLetter := deadLetters[0]
+			assert.Equal(t, tc.event.ID(), deadLetter.ID())
+			assert.Equal(t, tc.expectedData, string(deadLetter.Data()))
+			assert.Contains(t, deadLetter.Extensions()[deadLetterErrorExtension], tc.errorContains)
+			operation, ok := deadLetter.Extensions()[deadLetterOperationExtension]
+			assert.Equal(t, tc.operation != "", ok)
+			if ok {
+				assert.Equal(t, tc.operation, operation)
+			}
+		})
+	}
+}
+
+func TestDelivery(t *testing.T) {
+	var requests int32
+	var failures int32
+	var failureStatus int
+	var failureDelay time.Duration
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) > atomic.LoadInt32(&failures) {
+			return
+		}
+		time.Sleep(failureDelay)
+		w.WriteHeader(failureStatus)
+	}))
+	defer sink.Close()
+
+	delay := &metav1.Duration{Duration: time.Millisecond}
+
+	testCases := []struct {
+		name             string
+		delivery         v1alpha1.Delivery
+		failures         int32
+		failureStatus    int
+		failureDelay     time.Duration
+		expectErr        bool
+		expectedRequests int32
+	}{
+		{
+			name:             "Delivered after retries",
+			delivery:         v1alpha1.Delivery{Retry: 3, BackoffDelay: delay},
+			failures:         2,
+			failureStatus:    http.StatusServiceUnavailable,
+			expectedRequests: 3,
+		}, {
+			name:             "Retries exhausted",
+			delivery:         v1alpha1.Delivery{Retry: 2, BackoffDelay: delay, BackoffPolicy: v1alpha1.BackoffPolicyLinear},
+			failures:         5,
+			failureStatus:    http.StatusServiceUnavailable,
+			expectErr:        true,
+			expectedRequests: 3,
+		}, {
+			name:             "Not retryable code",
+			delivery:         v1alpha1.Delivery{Retry: 3, BackoffDelay: delay},
+			failures:         1,
+			failureStatus:    http.StatusBadRequest,
+			expectErr:        true,
+			expectedRequests: 1,
+		}, {
+			name:             "Retryable codes",
+			delivery:         v1alpha1.Delivery{Retry: 3, BackoffDelay: delay, RetryableCodes: []int{http.StatusNotFound}},
+			failures:         1,
+			failureStatus:    http.StatusNotFound,
+			expectedRequests: 2,
+		}, {
+			name: "Attempt timeout",
+			delivery: v1alpha1.Delivery{
+				Retry:        1,
+				BackoffDelay: delay,
+				Timeout:      &metav1.Duration{Duration: 10 * time.Millisecond},
+			},
+			failures:         1,
+			failureStatus:    http.StatusOK,
+			failureDelay:     100 * time.Millisecond,
+			expectedRequests: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			atomic.StoreInt32(&requests, 0)
+			atomic.StoreInt32(&failures, tc.failures)
+			failureStatus = tc.failureStatus
+			failureDelay = tc.failureDelay
+
+			pipeline, err := NewHandler(nil, nil, Delivery(&tc.delivery))
+			assert.NoError(t, err)
+
+			ctx := cloudevents.ContextWithTarget(context.Background(), sink.URL)
+			err = pipeline.receiveAndSend(ctx, setData(t, newEvent(), json.RawMessage(`{}`)))
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedRequests, atomic.LoadInt32(&requests))
+		})
+	}
+}
+
+func TestDeliveryBackoff(t *testing.T) {
+	exponential := &deliveryPolicy{delay: time.Second}
+	assert.Equal(t, time.Second, exponential.backoff(1))
+	assert.Equal(t, 4*time.Second, exponential.backoff(3))
+
+	assert.Equal(t, maxBackoffDelay, exponential.backoff(20))
+	assert.Equal(t, maxBackoffDelay, exponential.backoff(64))
+	assert.Equal(t, maxBackoffDelay, exponential.backoff(1000))
+
+	linear := &deliveryPolicy{delay: time.Second, linear: true}
+	assert.Equal(t, time.Second, linear.backoff(1))
+	assert.Equal(t, 3*time.Second, linear.backoff(3))
+	assert.Equal(t, maxBackoffDelay, linear.backoff(1<<40))
+
+	long := &deliveryPolicy{delay: time.Hour}
+	assert.Equal(t, time.Hour, long.backoff(1))
+	assert.Equal(t, time.Hour, long.backoff(3))
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var requests int32
+	var healthy int32
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer sink.Close()
+
+	pipeline, err := NewHandler(nil, nil, Delivery(&v1alpha1.Delivery{
+		CircuitBreaker: &v1alpha1.CircuitBreaker{
+			FailureThreshold: 2,
+			OpenDuration:     &metav1.Duration{Duration: 50 * time.Millisecond},
+		},
+	}))
+	assert.NoError(t, err)
+
+	ctx := cloudevents.ContextWithTarget(context.Background(), sink.URL)
+	send := func() error {
+		return pipeline.receiveAndSend(ctx, setData(t, newEvent(), json.RawMessage(`{}`)))
+	}
+
+	assert.Error(t, send())
+	assert.Error(t, send())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// the circuit is open
+	err = send()
+	assert.True(t, errors.Is(err, errCircuitOpen))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// the trial delivery closes the circuit
+	time.Sleep(60 * time.Millisecond)
+	atomic.StoreInt32(&healthy, 1)
+	assert.NoError(t, send())
+	assert.NoError(t, send())
+	assert.Equal(t, int32(4), atomic.LoadInt32(&requests))
+}
+
+func TestCircuitBreakerRetries(t *testing.T) {
+	var requests int32
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer sink.Close()
+
+	pipeline, err := NewHandler(nil, nil, Delivery(&v1alpha1.Delivery{
+		Retry:        5,
+		BackoffDelay: &metav1.Duration{Duration: time.Millisecond},
+		CircuitBreaker: &v1alpha1.CircuitBreaker{
+			FailureThreshold: 2,
+			OpenDuration:     &metav1.Duration{Duration: time.Minute},
+		},
+	}))
+	assert.NoError(t, err)
+
+	// the retries stop when the failed attempts open the circuit
+	ctx := cloudevents.ContextWithTarget(context.Background(), sink.URL)
+	err = pipeline.receiveAndSend(ctx, setData(t, newEvent(), json.RawMessage(`{}`)))
+	assert.True(t, errors.Is(err, errCircuitOpen))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestBuffer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buffer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(path string) { queue.MountPath = path }(queue.MountPath)
+	queue.MountPath = dir
+	defer func(interval time.Duration) { ReplayInterval = interval }(ReplayInterval)
+	ReplayInterval = 10 * time.Millisecond
+
+	var healthy int32
+	var mux sync.Mutex
+	var delivered []string
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		event, err := binding.ToEvent(r.Context(), cehttp.NewMessageFromHttpRequest(r))
+		assert.NoError(t, err)
+		if event.ID() == "2" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mux.Lock()
+		delivered = append(delivered, event.ID())
+		mux.Unlock()
+	}))
+	defer sink.Close()
+
+	pipeline, err := NewHandler(nil, nil, Buffer(&v1alpha1.Buffer{MaxEvents: 4}))
+	assert.NoError(t, err)
+	defer pipeline.buffer.queue.Close()
+
+	ctx, cancel := context.WithCancel(cloudevents.ContextWithTarget(context.Background(), sink.URL))
+	defer cancel()
+
+	send := func(id string) error {
+		event := setData(t, newEvent(), json.RawMessage(`{}`))
+		event.SetID(id)
+		return pipeline.receiveAndSend(ctx, event)
+	}
+
+	// events are buffered while the sink is unavailable
+	assert.NoError(t, send("1"))
+	assert.NoError(t, send("2"))
+	assert.NoError(t, send("3"))
+
+	// new events are buffered behind the ones to replay
+	atomic.StoreInt32(&healthy, 1)
+	assert.NoError(t, send("4"))
+	assert.Error(t, send("5"), "buffer is full")
+	assert.Equal(t, 4, pipeline.buffer.queue.Len())
+
+	replayed := make(chan struct{})
+	go func() {
+		defer close(replayed)
+		pipeline.replay(ctx)
+	}()
+
+	// the rejected event is dropped without the dead letter sink
+	assert.Eventually(t, func() bool {
+		return !pipeline.buffer.pending()
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// new events are delivered directly after the replay
+	assert.NoError(t, send("6"))
+	mux.Lock()
+	assert.Equal(t, []string{"1", "3", "4", "6"}, delivered)
+	mux.Unlock()
+
+	cancel()
+	<-replayed
+}
+
+func TestErrorPolicy(t *testing.T) {
+	failing := v1alpha1.Transform{
+		Operation: "compute",
+		Paths:     []v1alpha1.Path{{Key: "foo", Value: "data.missing.foo"}},
+	}
+	addBar := v1alpha1.Transform{
+		Operation: "add",
+		Paths:     []v1alpha1.Path{{Key: "bar", Value: "baz"}},
+	}
+	addQux := v1alpha1.Transform{
+		Operation: "add",
+		Paths:     []v1alpha1.Path{{Key: "qux", Value: "quux"}},
+	}
+	withPolicy := func(t v1alpha1.Transform, policy string) v1alpha1.Transform {
+		t.OnError = policy
+		return t
+	}
+
+	testCases := []struct {
+		name           string
+		onError        string
+		context        []v1alpha1.Transform
+		data           []v1alpha1.Transform
+		expectErr      bool
+		expectedData   string
+		expectedErrors int
+		failedOp       string
+	}{
+		{
+			name:      "Fail by default",
+			data:      []v1alpha1.Transform{failing, addBar},
+			expectErr: true,
+		}, {
+			name:           "Skip remaining operations",
+			data:           []v1alpha1.Transform{addBar, withPolicy(failing, v1alpha1.OnErrorSkip), addBar},
+			expectedData:   `{"bar":"baz"}`,
+			expectedErrors: 1,
+		}, {
+			name:           "Skip does not run later operations",
+			data:           []v1alpha1.Transform{addBar, withPolicy(failing, v1alpha1.OnErrorSkip), addQux, addQux},
+			expectedData:   `{"bar":"baz"}`,
+			expectedErrors: 1,
+		}, {
+			name:           "Skip does not run later operations by default",
+			onError:        v1alpha1.OnErrorSkip,
+			data:           []v1alpha1.Transform{addBar, failing, withPolicy(failing, v1alpha1.OnErrorContinue), addQux},
+			expectedData:   `{"bar":"baz"}`,
+			expectedErrors: 1,
+		}, {
+			name:           "Skip does not affect data",
+			context:        []v1alpha1.Transform{withPolicy(failing, v1alpha1.OnErrorSkip)},
+			data:           []v1alpha1.Transform{addBar},
+			expectedData:   `{"bar":"baz"}`,
+			expectedErrors: 1,
+		}, {
+			name:           "Continue",
+			onError:        v1alpha1.OnErrorContinue,
+			data:           []v1alpha1.Transform{failing, failing, addBar},
+			expectedData:   `{"bar":"baz"}`,
+			expectedErrors: 2,
+		}, {
+			name:      "Operation policy overrides default",
+			onError:   v1alpha1.OnErrorContinue,
+			data:      []v1alpha1.Transform{withPolicy(failing, v1alpha1.OnErrorFail), addBar},
+			expectErr: true,
+		}, {
+			name:    "Init step",
+			onError: v1alpha1.OnErrorContinue,
+			data: []v1alpha1.Transform{{
+				Operation: "store",
+				Condition: `data.missing.foo == "bar"`,
+				Paths:     []v1alpha1.Path{{Key: "$foo", Value: "foo"}},
+			}, addBar},
+			expectedData:   `{"bar":"baz"}`,
+			expectedErrors: 1,
+			failedOp:       "store",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline, err := NewHandler(tc.context, tc.data, OnError(tc.onError))
+			assert.NoError(t, err)
+
+			transformedEvent, _, err := pipeline.transform(context.Background(), setData(t, newEvent(), json.RawMessage(`{}`)))
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.JSONEq(t, tc.expectedData, string(transformedEvent.Data()))
+
+			extension, ok := transformedEvent.Extensions()[transformationErrorsExtension]
+			assert.Equal(t, tc.expectedErrors != 0, ok)
+			if ok {
+				var messages []string
+				assert.NoError(t, json.Unmarshal([]byte(extension.(string)), &messages))
+				assert.Len(t, messages, tc.expectedErrors)
+				failedOp := "compute"
+				if tc.failedOp != "" {
+					failedOp = tc.failedOp
+				}
+				assert.True(t, strings.HasPrefix(messages[0], failedOp+": "), messages[0])
+			}
+		})
+	}
+
+	_, err := NewHandler(nil, nil, OnError("ignore"))
+	assert.Error(t, err)
+	_, err = NewHandler(nil, []v1alpha1.Transform{withPolicy(addBar, "ignore")})
+	assert.Error(t, err)
+}
+
+// metricsRuns makes the names of the Transformations
+// unique across repeated runs of TestMetrics.
+var metricsRuns int32
+
+func TestMetrics(t *testing.T) {
+	run := atomic.AddInt32(&metricsRuns, 1)
+	var sinkStatus int32
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&sinkStatus)))
+	}))
+	defer sink.Close()
+
+	addBar := v1alpha1.Transform{
+		Operation: "add",
+		Paths:     []v1alpha1.Path{{Key: "bar", Value: "baz"}},
+	}
+	failing := v1alpha1.Transform{
+		Operation: "compute",
+		Paths:     []v1alpha1.Path{{Key: "foo", Value: "data.missing.foo"}},
+	}
+
+	testCases := []struct {
+		name              string
+		data              []v1alpha1.Transform
+		options           []Option
+		sinkStatus        int32
+		expectedResult    string
+		expectedOperation string
+		expectedCode      string
+	}{
+		{
+			name:           "Transformed",
+			data:           []v1alpha1.Transform{addBar},
+			sinkStatus:     http.StatusAccepted,
+			expectedResult: resultTransformed,
+			expectedCode:   "202",
+		}, {
+			name:              "Failed operation",
+			data:              []v1alpha1.Transform{addBar, failing},
+			expectedResult:    resultFailed,
+			expectedOperation: "compute",
+		}, {
+			name:           "Dropped",
+			data:           []v1alpha1.Transform{addBar},
+			options:        []Option{Sampling(&v1alpha1.Sampling{Percentage: 0})},
+			expectedResult: resultDropped,
+		}, {
+			name:           "Sink error",
+			data:           []v1alpha1.Transform{addBar},
+			sinkStatus:     http.StatusInternalServerError,
+			expectedResult: resultTransformed,
+			expectedCode:   "500",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			name := "metrics-" + strconv.Itoa(int(run)) + "-" + strconv.Itoa(i)
+			atomic.StoreInt32(&sinkStatus, tc.sinkStatus)
+
+			pipeline, err := NewHandler(nil, tc.data, append(tc.options, Name("test", name))...)
+			assert.NoError(t, err)
+
+			ctx := cloudevents.ContextWithTarget(context.Background(), sink.URL)
+			_ = pipeline.receiveAndSend(ctx, setData(t, newEvent(), json.RawMessage(`{}`)))
+
+			received := viewRows(t, receivedEventsM.Name(), name)
+			if assert.Len(t, received, 1) {
+				assert.Equal(t, int64(1), received[0].Data.(*view.CountData).Value)
+			}
+
+			processed := viewRows(t, processedEventsM.Name(), name)
+			if assert.Len(t, processed, 1) {
+				assert.Equal(t, tc.expectedResult, tagValue(processed[0], resultKey))
+				assert.Equal(t, tc.expectedOperation, tagValue(processed[0], operationKey))
+			}
+
+			assert.Len(t, viewRows(t, eventLatencyM.Name(), name), 1)
+
+			operations := viewRows(t, operationLatencyM.Name(), name)
+			if tc.expectedResult == resultDropped {
+				assert.Empty(t, operations)
+			} else {
+				assert.Len(t, operations, len(tc.data))
+			}
+
+			deliveries := viewRows(t, deliveriesM.Name(), name)
+			if tc.expectedCode == "" {
+				assert.Empty(t, deliveries)
+			} else if assert.Len(t, deliveries, 1) {
+				assert.Equal(t, tc.expectedCode, tagValue(deliveries[0], responseCodeKey))
+				assert.Equal(t, tc.expectedCode[:1]+"xx", tagValue(deliveries[0], responseCodeClassKey))
+			}
+		})
+	}
+}
+
+func TestRegisterViews(t *testing.T) {
+	// every Handler of the process shares the views
+	for i := 0; i < 2; i++ {
+		_, err := NewHandler(nil, nil)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, registerViews())
+	assert.NotNil(t, view.Find(bufferDroppedM.Name()))
+
+	// duplicate registration returns an error instead of a panic
+	assert.Error(t, doRegisterViews())
+}
+
+// viewRows returns the rows of the view recorded by the named Transformation.
+func viewRows(t *testing.T, viewName, name string) []*view.Row {
+	rows, err := view.RetrieveData(viewName)
+	assert.NoError(t, err)
+
+	var result []*view.Row
+	for _, row := range rows {
+		if tagValue(row, nameKey) == name {
+			result = append(result, row)
+		}
+	}
+	return result
+}
+
+func tagValue(row *view.Row, key tag.Key) string {
+	for _, t := range row.Tags {
+		if t.Key == key {
+			return t.Value
+		}
+	}
+	return ""
+}
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(s *trace.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *spanRecorder) named(name string) []*trace.SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var spans []*trace.SpanData
+	for _, s := range r.spans {
+		if s.Name == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+func TestTracing(t *testing.T) {
+	recorder := &spanRecorder{}
+	trace.RegisterExporter(recorder)
+	defer trace.UnregisterExporter(recorder)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+	defer trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(1e-4)})
+
+	delivered := make(chan cloudevents.Event, 1)
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event, err := binding.ToEvent(context.Background(), cehttp.NewMessageFromHttpRequest(r))
+		assert.NoError(t, err)
+		delivered <- *event
+	}))
+	defer sink.Close()
+
+	pipeline, err := NewHandler(nil, []v1alpha1.Transform{{
+		Operation: "add",
+		Paths:     []v1alpha1.Path{{Key: "foo", Value: "bar"}, {Key: "bar", Value: "baz"}},
+	}})
+	assert.NoError(t, err)
+
+	parent := trace.SpanContext{
+		TraceID:      trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		SpanID:       trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		TraceOptions: 1,
+	}
+	event := setData(t, newEvent(), json.RawMessage(`{}`))
+	extensions.FromSpanContext(parent).AddTracingAttributes(&event)
+
+	ctx := cloudevents.ContextWithTarget(context.Background(), sink.URL)
+	assert.NoError(t, pipeline.receiveAndSend(ctx, event))
+
+	receive := recorder.named(receiveSpanName)
+	if !assert.Len(t, receive, 1) {
+		return
+	}
+	assert.Equal(t, parent.TraceID, receive[0].TraceID)
+	assert.Equal(t, parent.SpanID, receive[0].ParentSpanID)
+
+	operations := recorder.named(operationSpanName)
+	if assert.Len(t, operations, 2) {
+		for i, path := range []string{"foo", "bar"} {
+			assert.Equal(t, receive[0].SpanID, operations[i].ParentSpanID)
+			assert.Equal(t, "add", operations[i].Attributes[operationAttribute])
+			assert.Equal(t, path, operations[i].Attributes[pathAttribute])
+		}
+	}
+
+	send := recorder.named(sendSpanName)
+	if assert.Len(t, send, 1) {
+		assert.Equal(t, receive[0].SpanID, send[0].ParentSpanID)
+	}
+
+	outgoing := <-delivered
+	ext, ok := extensions.GetDistributedTracingExtension(outgoing)
+	if assert.True(t, ok) {
+		sc, err := ext.ToSpanContext()
+		assert.NoError(t, err)
+		assert.Equal(t, parent.TraceID, sc.TraceID)
+		assert.NotEqual(t, parent.SpanID, sc.SpanID)
+	}
+}
+
+func TestHeaderTrace(t *testing.T) {
+	var traceParent string
+	handler := &ochttp.Handler{
+		Propagation: &tracecontext.HTTPFormat{},
+		Handler: headerTrace(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			traceParent = r.Header.Get(ceHeaderTraceParent)
+		})),
+	}
+
+	request := func(headers map[string]string) string {
+		traceParent = ""
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		return traceParent
+	}
+
+	header := "00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01"
+	extension := "00-1112131415161718191a1b1c1d1e1f20-1112131415161718-01"
+
+	assert.True(t, strings.HasPrefix(request(map[string]string{
+		ceHeaderSpecVersion: "1.0",
+		"traceparent":       header,
+	}), "00-0102030405060708090a0b0c0d0e0f10-"))
+	assert.Equal(t, extension, request(map[string]string{
+		ceHeaderSpecVersion: "1.0",
+		ceHeaderTraceParent: extension,
+		"traceparent":       header,
+	}))
+	assert.Equal(t, "", request(map[string]string{
+		"traceparent": header,
+	}))
+}
+
+func TestPayloadLogging(t *testing.T) {
+	percentage := func(p int) *int { return &p }
+	data := json.RawMessage(`{"user":"foo","secret":"bar","items":[{"token":"baz"}]}`)
+
+	testCases := []struct {
+		name             string
+		logging          *v1alpha1.Logging
+		level            zapcore.Level
+		expectedPayloads []string
+	}{
+		{
+			name:  "Payloads",
+			level: zapcore.DebugLevel,
+			expectedPayloads: []string{
+				`{"user":"foo","secret":"bar","items":[{"token":"baz"}]}`,
+				`{"user":"foo","secret":"bar","items":[{"token":"baz"}],"added":"value"}`,
+			},
+		}, {
+			name:    "Redacted paths",
+			logging: &v1alpha1.Logging{Redact: []string{"secret", "items[0].token", "missing.path"}},
+			level:   zapcore.DebugLevel,
+			expectedPayloads: []string{
+				`{"user":"foo","secret":"[REDACTED]","items":[{"token":"[REDACTED]"}]}`,
+				`{"user":"foo","secret":"[REDACTED]","items":[{"token":"[REDACTED]"}],"added":"value"}`,
+			},
+		}, {
+			name:    "Not sampled",
+			logging: &v1alpha1.Logging{Percentage: percentage(0)},
+			level:   zapcore.DebugLevel,
+		}, {
+			name:  "Info level",
+			level: zapcore.InfoLevel,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline, err := NewHandler(nil, []v1alpha1.Transform{{
+				Operation: "add",
+				Paths:     []v1alpha1.Path{{Key: "added", Value: "value"}},
+			}}, Logging(tc.logging))
+			assert.NoError(t, err)
+
+			core, logs := observer.New(tc.level)
+			ctx := logging.WithLogger(context.Background(), zap.New(core).Sugar())
+			_, err = pipeline.receiveAndReply(ctx, setData(t, newEvent(), data))
+			assert.NoError(t, err)
+
+			var payloads []string
+			for _, entry := range logs.All() {
+				fields := entry.ContextMap()
+				assert.Equal(t, "123", fields["event.id"])
+				assert.Equal(t, "test", fields["event.type"])
+				assert.Equal(t, "test", fields["event.source"])
+				if payload, ok := fields["payload"]; ok {
+					payloads = append(payloads, payload.(string))
+				}
+			}
+			if assert.Len(t, payloads, len(tc.expectedPayloads)) {
+				for i := range payloads {
+					assert.JSONEq(t, tc.expectedPayloads[i], payloads[i])
+				}
+			}
+		})
+	}
+
+	_, err := NewHandler(nil, nil, Logging(&v1alpha1.Logging{Percentage: percentage(101)}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,29 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import "github.com/triggermesh/bumblebee/pkg/pipeline/transformer/k8slookup"
+
+// Kubernetes sets the client that "k8slookup" operations fetch the
+// objects with. Objects are read from any namespace by default.
+func Kubernetes(c *k8slookup.Client) Option {
+	return func(h *Handler) error {
+		h.ContextPipeline.setKubernetes(c)
+		h.DataPipeline.setKubernetes(c)
+		return nil
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"knative.dev/pkg/logging"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+)
+
+// redactedValue replaces the redacted values of the logged payloads.
+const redactedValue = "[REDACTED]"
+
+// payloadLogger logs the payloads of the sampled events at the debug level.
+type payloadLogger struct {
+	percentage uint32
+	// redact are the paths of the hidden values.
+	redact []convert.Path
+}
+
+// Logging sets the events whose payloads are logged at the debug
+// level and the paths of the values that are hidden in them.
+func Logging(l *v1alpha1.Logging) Option {
+	return func(h *Handler) error {
+		if l == nil {
+			return nil
+		}
+		if l.Percentage != nil {
+			if *l.Percentage < 0 || *l.Percentage > 100 {
+				return fmt.Errorf("logging percentage must be between 0 and 100")
+			}
+			h.payloads.percentage = uint32(*l.Percentage)
+		}
+		for _, redact := range l.Redact {
+			path, err := convert.ParsePath(redact)
+			if err != nil {
+				return fmt.Errorf("logging redact: %w", err)
+			}
+			h.payloads.redact = append(h.payloads.redact, path)
+		}
+		return nil
+	}
+}
+
+// eventLogger returns the logger with the event attributes.
+func eventLogger(ctx context.Context, event cloudevents.Event) *zap.SugaredLogger {
+	return logging.FromContext(ctx).With(
+		zap.String("event.id", event.ID()),
+		zap.String("event.type", event.Type()),
+		zap.String("event.source", event.Source()),
+	)
+}
+
+// log logs the CE data tree of the sampled event if the debug level is enabled.
+func (p *payloadLogger) log(ctx context.Context, msg string, event cloudevents.Event, data interface{}) {
+	logger := logging.FromContext(ctx)
+	if !logger.Desugar().Core().Enabled(zapcore.DebugLevel) || !sampled(event.ID(), p.percentage) {
+		return
+	}
+	payload, err := redact(data, p.redact)
+	if err != nil {
+		logger.Debugw(msg, zap.String("payload.error", err.Error()))
+		return
+	}
+	logger.Debugw(msg, zap.ByteString("payload", payload))
+}
+
+// redact encodes the JSON tree with the values at the given paths replaced.
+func redact(tree interface{}, paths []convert.Path) ([]byte, error) {
+	if len(paths) != 0 {
+		// the tree is shared with the operations
+		tree = convert.Copy(tree)
+		for _, path := range paths {
+			path.Replace(tree, redactedValue)
+		}
+	}
+	return convert.Marshal(tree)
+}
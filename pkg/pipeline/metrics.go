@@ -0,0 +1,284 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.uber.org/zap"
+
+	"knative.dev/pkg/metrics"
+)
+
+// Results of the processed events.
+const (
+	resultTransformed = "transformed"
+	resultFailed      = "failed"
+	resultRejected    = "rejected"
+	resultDropped     = "dropped"
+
+	// responseCodeError is the response code of the
+	// deliveries that the sink did not respond to.
+	responseCodeError = "error"
+)
+
+var (
+	receivedEventsM = stats.Int64(
+		"received_events",
+		"Number of events received by the Transformation",
+		stats.UnitDimensionless,
+	)
+	processedEventsM = stats.Int64(
+		"processed_events",
+		"Number of events processed by the Transformation, by result",
+		stats.UnitDimensionless,
+	)
+	eventLatencyM = stats.Float64(
+		"event_latencies",
+		"Time from receiving an event to its delivery",
+		stats.UnitMilliseconds,
+	)
+	operationLatencyM = stats.Float64(
+		"operation_latencies",
+		"Time spent in a Transformation operation",
+		stats.UnitMilliseconds,
+	)
+	deliveriesM = stats.Int64(
+		"sink_deliveries",
+		"Number of event delivery attempts to the sink, by response code",
+		stats.UnitDimensionless,
+	)
+	bufferEventsM = stats.Int64(
+		"buffer_events",
+		"Number of events in the buffer of undelivered events",
+		stats.UnitDimensionless,
+	)
+	bufferSizeM = stats.Int64(
+		"buffer_size",
+		"Size of the buffer of undelivered events",
+		stats.UnitBytes,
+	)
+	bufferDroppedM = stats.Int64(
+		"buffer_dropped_events",
+		"Number of buffered events dropped because they could not be delivered",
+		stats.UnitDimensionless,
+	)
+
+	namespaceKey         = tag.MustNewKey("namespace_name")
+	nameKey              = tag.MustNewKey("transformation_name")
+	eventTypeKey         = tag.MustNewKey("event_type")
+	resultKey            = tag.MustNewKey("result")
+	operationKey         = tag.MustNewKey("operation")
+	responseCodeKey      = tag.MustNewKey("response_code")
+	responseCodeClassKey = tag.MustNewKey("response_code_class")
+)
+
+// registerViewsOnce guards the registration of the views
+// that are shared by all Handlers of the process.
+var (
+	registerViewsOnce sync.Once
+	registerViewsErr  error
+)
+
+// registerViews registers the views of the Handler metrics once
+// and returns the registration error to every caller.
+func registerViews() error {
+	registerViewsOnce.Do(func() {
+		registerViewsErr = doRegisterViews()
+	})
+	return registerViewsErr
+}
+
+func doRegisterViews() error {
+	resourceKeys := []tag.Key{namespaceKey, nameKey}
+	latencyBuckets := view.Distribution(metrics.Buckets125(1, 10000)...)
+
+	err := view.Register(
+		&view.View{
+			Description: receivedEventsM.Description(),
+			Measure:     receivedEventsM,
+			Aggregation: view.Count(),
+			TagKeys:     append([]tag.Key{eventTypeKey}, resourceKeys...),
+		},
+		&view.View{
+			Description: processedEventsM.Description(),
+			Measure:     processedEventsM,
+			Aggregation: view.Count(),
+			TagKeys:     append([]tag.Key{eventTypeKey, resultKey, operationKey}, resourceKeys...),
+		},
+		&view.View{
+			Description: eventLatencyM.Description(),
+			Measure:     eventLatencyM,
+			Aggregation: latencyBuckets,
+			TagKeys:     append([]tag.Key{eventTypeKey, resultKey}, resourceKeys...),
+		},
+		&view.View{
+			Description: operationLatencyM.Description(),
+			Measure:     operationLatencyM,
+			Aggregation: latencyBuckets,
+			TagKeys:     append([]tag.Key{operationKey}, resourceKeys...),
+		},
+		&view.View{
+			Description: deliveriesM.Description(),
+			Measure:     deliveriesM,
+			Aggregation: view.Count(),
+			TagKeys:     append([]tag.Key{responseCodeKey, responseCodeClassKey}, resourceKeys...),
+		},
+		&view.View{
+			Description: bufferEventsM.Description(),
+			Measure:     bufferEventsM,
+			Aggregation: view.LastValue(),
+			TagKeys:     resourceKeys,
+		},
+		&view.View{
+			Description: bufferSizeM.Description(),
+			Measure:     bufferSizeM,
+			Aggregation: view.LastValue(),
+			TagKeys:     resourceKeys,
+		},
+		&view.View{
+			Description: bufferDroppedM.Description(),
+			Measure:     bufferDroppedM,
+			Aggregation: view.Count(),
+			TagKeys:     resourceKeys,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("cannot register metric views: %w", err)
+	}
+	return nil
+}
+
+// Name sets the namespace and the name of the Transformation
+// that label the metrics of the Handler.
+func Name(namespace, name string) Option {
+	return func(h *Handler) error {
+		h.stats.tags = []tag.Mutator{
+			tag.Upsert(namespaceKey, namespace),
+			tag.Upsert(nameKey, name),
+		}
+		return nil
+	}
+}
+
+// statsReporter records the metrics of the Handler.
+type statsReporter struct {
+	// tags identify the Transformation.
+	tags []tag.Mutator
+}
+
+// record stores the measurement with the Transformation
+// tags and the given ones.
+func (r *statsReporter) record(m stats.Measurement, tags ...tag.Mutator) {
+	err := stats.RecordWithOptions(context.Background(),
+		stats.WithTags(append(tags, r.tags...)...),
+		stats.WithMeasurements(m),
+	)
+	if err != nil {
+		zap.S().Errorw("Cannot record metric", zap.String("metric", m.Measure().Name()), zap.Error(err))
+	}
+}
+
+// reportReceived counts the received event.
+func (r *statsReporter) reportReceived(eventType string) {
+	r.record(receivedEventsM.M(1), tag.Upsert(eventTypeKey, eventType))
+}
+
+// reportProcessed counts the processed event by the result of
+// its transformation and the operation that failed it, if any.
+func (r *statsReporter) reportProcessed(eventType string, event *cloudevents.Event, err error) {
+	r.record(processedEventsM.M(1),
+		tag.Upsert(eventTypeKey, eventType),
+		tag.Upsert(resultKey, result(event, err)),
+		tag.Upsert(operationKey, failedOperation(err)),
+	)
+}
+
+// reportLatency records the time since the event was received.
+func (r *statsReporter) reportLatency(eventType string, event *cloudevents.Event, err error, start time.Time) {
+	r.record(eventLatencyM.M(milliseconds(time.Since(start))),
+		tag.Upsert(eventTypeKey, eventType),
+		tag.Upsert(resultKey, result(event, err)),
+	)
+}
+
+// reportOperation records the latency of the operation.
+func (r *statsReporter) reportOperation(operation string, latency time.Duration) {
+	r.record(operationLatencyM.M(milliseconds(latency)), tag.Upsert(operationKey, operation))
+}
+
+// reportDelivery counts the delivery attempt by the response code of the sink.
+func (r *statsReporter) reportDelivery(response error) {
+	code, class := responseCodeError, responseCodeError
+	var httpResult *cehttp.Result
+	if errors.As(response, &httpResult) {
+		code, class = strconv.Itoa(httpResult.StatusCode), metrics.ResponseCodeClass(httpResult.StatusCode)
+	}
+	r.record(deliveriesM.M(1),
+		tag.Upsert(responseCodeKey, code),
+		tag.Upsert(responseCodeClassKey, class),
+	)
+}
+
+// reportBuffer records the depth of the buffer.
+func (r *statsReporter) reportBuffer(events, size int64) {
+	r.record(bufferEventsM.M(events))
+	r.record(bufferSizeM.M(size))
+}
+
+// reportBufferDropped counts the buffered event that was dropped.
+func (r *statsReporter) reportBufferDropped() {
+	r.record(bufferDroppedM.M(1))
+}
+
+// result returns the result label of the event transformation.
+func result(event *cloudevents.Event, err error) string {
+	var reject *rejectError
+	switch {
+	case errors.As(err, &reject):
+		return resultRejected
+	case err != nil:
+		return resultFailed
+	case event == nil:
+		return resultDropped
+	}
+	return resultTransformed
+}
+
+// failedOperation returns the name of the operation that failed
+// the event, empty if the event did not fail in an operation.
+func failedOperation(err error) string {
+	var opErr *operationError
+	if errors.As(err, &opErr) {
+		return opErr.operation
+	}
+	return ""
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -17,22 +17,71 @@ limitations under the License.
 package pipeline
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"strings"
+	"time"
+
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+
+	"knative.dev/pkg/logging"
 
 	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/configmap"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/expression"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/state"
 	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
 	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
 	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/add"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/compute"
 	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/delete"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/enrich"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/getstate"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/increment"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/jq"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/k8slookup"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/lookup"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/script"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/setstate"
 	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/shift"
 	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/store"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer/wasm"
 )
 
 // Pipeline is a set of Transformations that are
 // sequentially applied to JSON data.
 type Pipeline struct {
 	Transformers []transformer.Transformer
+
+	// conditions are the compiled guards of the Transformers
+	// with the same index, nil if the step is unconditional.
+	conditions []*expression.Expression
+	// operations are the names of the Transformers
+	// with the same index.
+	operations []string
+	// paths are the keys of the Transformers
+	// with the same index.
+	paths []string
+	// policies are the error policies of the Transformers
+	// with the same index, empty to use the default one.
+	policies []string
+	// onError is the default error policy.
+	onError string
+	// document is the name of the CE part the Pipeline
+	// transforms, "context" or "data".
+	document  string
+	variables *storage.Storage
+	stats     *statsReporter
+}
+
+// eventDocuments contains CE context and data decoded into
+// JSON trees the Pipeline expressions are evaluated over.
+type eventDocuments struct {
+	context interface{}
+	data    interface{}
 }
 
 // register loads available Transformation into a named map.
@@ -40,64 +89,282 @@ func register() map[string]transformer.Transformer {
 	transformations := make(map[string]transformer.Transformer)
 
 	add.Register(transformations)
+	compute.Register(transformations)
 	delete.Register(transformations)
+	enrich.Register(transformations)
+	getstate.Register(transformations)
+	increment.Register(transformations)
+	jq.Register(transformations)
+	k8slookup.Register(transformations)
+	lookup.Register(transformations)
+	script.Register(transformations)
+	setstate.Register(transformations)
 	shift.Register(transformations)
 	store.Register(transformations)
+	wasm.Register(transformations)
 
 	return transformations
 }
 
-// newPipeline loads available Transformations and creates a Pipeline.
-func newPipeline(transformations []v1alpha1.Transform) (*Pipeline, error) {
+// newPipeline loads available Transformations and creates a Pipeline
+// for the named CE document. It returns all invalid operations and
+// paths of the spec so that they are reported at once.
+func newPipeline(document string, transformations []v1alpha1.Transform) (*Pipeline, specError) {
 	availableTransformers := register()
 	pipeline := []transformer.Transformer{}
+	conditions := []*expression.Expression{}
+	operations := []string{}
+	paths := []string{}
+	policies := []string{}
+	var invalid specError
 
-	for _, transformation := range transformations {
+	for i, transformation := range transformations {
 		operation, exist := availableTransformers[transformation.Operation]
 		if !exist {
-			return nil, fmt.Errorf("transformation %q not found", transformation.Operation)
+			invalid.add(document, i, -1, fmt.Errorf("transformation %q not found", transformation.Operation))
+			continue
+		}
+		if err := validateErrorPolicy(transformation.OnError); err != nil {
+			invalid.add(document, i, -1, fmt.Errorf("transformation %q: %w", transformation.Operation, err))
+		}
+		var condition *expression.Expression
+		if transformation.Condition != "" {
+			var err error
+			if condition, err = expression.Compile(transformation.Condition); err != nil {
+				invalid.add(document, i, -1, fmt.Errorf("transformation %q condition: %w", transformation.Operation, err))
+			}
 		}
-		for _, kv := range transformation.Paths {
-			pipeline = append(pipeline, operation.New(kv.Key, kv.Value))
-			log.Printf("%s: %s", transformation.Operation, kv.Key)
+		for j, kv := range transformation.Paths {
+			value := kv.Value
+			if kv.ValueFrom != nil && kv.ValueFrom.ConfigMapKeyRef != nil {
+				v, err := configmap.Read(*kv.ValueFrom.ConfigMapKeyRef)
+				if err != nil {
+					invalid.add(document, i, j, fmt.Errorf("transformation %q: %w", transformation.Operation, err))
+					continue
+				}
+				value = string(v)
+			}
+			t, err := operation.New(kv.Key, value)
+			if err != nil {
+				invalid.add(document, i, j, fmt.Errorf("transformation %q: %w", transformation.Operation, err))
+				continue
+			}
+			if c, ok := t.(transformer.Configurable); ok {
+				if err := c.Configure(transformation); err != nil {
+					invalid.add(document, i, j, fmt.Errorf("transformation %q: %w", transformation.Operation, err))
+					continue
+				}
+			}
+			pipeline = append(pipeline, t)
+			conditions = append(conditions, condition)
+			operations = append(operations, transformation.Operation)
+			paths = append(paths, kv.Key)
+			policies = append(policies, transformation.OnError)
 		}
 	}
+	if len(invalid) != 0 {
+		_ = (&Pipeline{Transformers: pipeline}).close()
+		return nil, invalid
+	}
 
 	return &Pipeline{
 		Transformers: pipeline,
+
+		conditions: conditions,
+		operations: operations,
+		paths:      paths,
+		policies:   policies,
+		onError:    v1alpha1.OnErrorFail,
+		document:   document,
 	}, nil
 }
 
+// specError lists the problems of the Transformation spec, each
+// prefixed with the field of the invalid Transform or its path.
+type specError []string
+
+// add records the error of the Transform with the given index and,
+// unless it is negative, the index of the path in the Transform.
+func (e *specError) add(document string, transform, path int, err error) {
+	field := fmt.Sprintf("%s[%d]", document, transform)
+	if path >= 0 {
+		field += fmt.Sprintf(".paths[%d]", path)
+	}
+	*e = append(*e, field+": "+err.Error())
+}
+
+func (e specError) Error() string {
+	return "invalid transformations: " + strings.Join(e, "; ")
+}
+
+// steps returns the operations and paths of the Transformers.
+func (p *Pipeline) steps() []string {
+	steps := make([]string, len(p.operations))
+	for i := range p.operations {
+		steps[i] = p.operations[i] + ": " + p.paths[i]
+	}
+	return steps
+}
+
 // SetStorage injects shared storage with Pipeline vars.
 func (p *Pipeline) setStorage(s *storage.Storage) {
+	p.variables = s
 	for _, v := range p.Transformers {
 		v.SetStorage(s)
 	}
 }
 
-// InitStep runs Transformations that are marked as InitStep.
-func (p *Pipeline) initStep(data []byte) {
+// setState injects the store of the values
+// that persist across events.
+func (p *Pipeline) setState(s state.Store) {
 	for _, v := range p.Transformers {
-		if !v.InitStep() {
-			continue
+		if st, ok := v.(transformer.Stateful); ok {
+			st.SetState(s)
 		}
-		if _, err := v.Apply(data); err != nil {
-			log.Printf("Failed to apply Init step: %v", err)
+	}
+}
+
+// setKubernetes injects the client that
+// "k8slookup" operations fetch the objects with.
+func (p *Pipeline) setKubernetes(c *k8slookup.Client) {
+	for _, v := range p.Transformers {
+		if k, ok := v.(*k8slookup.K8sLookup); ok {
+			k.SetClient(c)
 		}
 	}
 }
 
-// Apply applies Pipeline transformations.
-func (p *Pipeline) apply(data []byte) ([]byte, error) {
+// close releases the resources held by the Transformers,
+// such as the runtimes of "wasm" operations.
+func (p *Pipeline) close() error {
 	var err error
 	for _, v := range p.Transformers {
-		if v.InitStep() {
+		if c, ok := v.(io.Closer); ok {
+			if closeErr := c.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	}
+	return err
+}
+
+// InitStep runs Transformations that are marked as InitStep.
+// It returns the errors of the operations that did not fail the event.
+func (p *Pipeline) initStep(ctx context.Context, data interface{}, e eventDocuments) ([]error, error) {
+	_, ignored, err := p.run(ctx, data, e, true)
+	return ignored, err
+}
+
+// Apply applies Pipeline transformations to the decoded document
+// and returns its new root. It also returns the errors of the
+// operations that did not fail the event.
+func (p *Pipeline) apply(ctx context.Context, data interface{}, e eventDocuments) (interface{}, []error, error) {
+	return p.run(ctx, data, e, false)
+}
+
+// run applies either init step or main Transformations
+// according to their error policies.
+func (p *Pipeline) run(ctx context.Context, data interface{}, e eventDocuments, initStep bool) (interface{}, []error, error) {
+	var ignored []error
+	for i, v := range p.Transformers {
+		if v.InitStep() != initStep {
 			continue
 		}
-		data, err = v.Apply(data)
+		output, err := p.traceStep(ctx, i, data, e)
+		if err == nil {
+			data = output
+			continue
+		}
+		if errors.Is(err, transformer.ErrDropEvent) {
+			return data, ignored, err
+		}
+
+		opErr := &operationError{
+			operation: p.operations[i],
+			err:       err,
+		}
+		switch p.policy(i) {
+		case v1alpha1.OnErrorContinue:
+			logging.FromContext(ctx).Infow("Ignoring failed operation", zap.Error(opErr))
+			ignored = append(ignored, opErr)
+		case v1alpha1.OnErrorSkip:
+			logging.FromContext(ctx).Infow("Skipping operations after failed one", zap.Error(opErr))
+			return data, append(ignored, opErr), nil
+		default:
+			return data, ignored, opErr
+		}
+	}
+	return data, ignored, nil
+}
+
+// policy returns the error policy of the Transformer with the given index.
+func (p *Pipeline) policy(i int) string {
+	if p.policies[i] != "" {
+		return p.policies[i]
+	}
+	return p.onError
+}
+
+// traceStep applies the Transformer with the given index
+// and records its span and latency.
+func (p *Pipeline) traceStep(ctx context.Context, i int, data interface{}, e eventDocuments) (interface{}, error) {
+	_, span := trace.StartSpan(ctx, operationSpanName)
+	defer span.End()
+	span.AddAttributes(
+		trace.StringAttribute(operationAttribute, p.operations[i]),
+		trace.StringAttribute(pathAttribute, p.paths[i]),
+		trace.StringAttribute(documentAttribute, p.document),
+	)
+
+	start := time.Now()
+	output, err := p.applyStep(ctx, i, data, e)
+	p.stats.reportOperation(p.operations[i], time.Since(start))
+	if !errors.Is(err, transformer.ErrDropEvent) {
+		spanError(span, err)
+	}
+	return output, err
+}
+
+// applyStep applies the Transformer with the given index
+// if its condition is met.
+func (p *Pipeline) applyStep(ctx context.Context, i int, data interface{}, e eventDocuments) (interface{}, error) {
+	evaluator, isEvaluator := p.Transformers[i].(transformer.Evaluator)
+	if p.conditions[i] == nil && !isEvaluator {
+		return p.applyTransformer(ctx, i, data)
+	}
+
+	activation := p.activation(data, e)
+	if p.conditions[i] != nil {
+		match, err := p.conditions[i].Match(activation)
 		if err != nil {
 			return data, err
 		}
+		if !match {
+			return data, nil
+		}
+	}
+	if isEvaluator {
+		return evaluator.Evaluate(p.document, data, activation)
+	}
+	return p.applyTransformer(ctx, i, data)
+}
+
+// applyTransformer applies the Transformer with the given index,
+// passing the event context to the Transformers that accept it.
+func (p *Pipeline) applyTransformer(ctx context.Context, i int, data interface{}) (interface{}, error) {
+	if applier, ok := p.Transformers[i].(transformer.ContextApplier); ok {
+		return applier.ApplyContext(ctx, data)
+	}
+	return p.Transformers[i].Apply(data)
+}
+
+// activation returns expression variables with the current
+// state of the document transformed by the Pipeline.
+func (p *Pipeline) activation(data interface{}, e eventDocuments) expression.Activation {
+	if p.document == expression.Context {
+		e.context = data
+	} else {
+		e.data = data
 	}
-	return data, nil
+	return expression.NewActivation(e.context, e.data, p.variables)
 }
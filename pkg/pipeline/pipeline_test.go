@@ -0,0 +1,222 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/expression"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+// benchmarkTransformations is a 20-step data pipeline
+// that summarizes GitHub push events.
+var benchmarkTransformations = []v1alpha1.Transform{
+	{
+		Operation: "store",
+		Paths: []v1alpha1.Path{
+			{Key: "$repository", Value: "repository.full_name"},
+			{Key: "$ref", Value: "ref"},
+			{Key: "$pusher", Value: "pusher.name"},
+		},
+	}, {
+		Operation: "add",
+		Paths: []v1alpha1.Path{
+			{Key: "summary.repository", Value: "$repository"},
+			{Key: "summary.ref", Value: "$ref"},
+			{Key: "summary.pusher", Value: "$pusher"},
+			{Key: "summary.source", Value: "github"},
+		},
+	}, {
+		Operation: "shift",
+		Paths: []v1alpha1.Path{
+			{Key: "head_commit.id:summary.head"},
+			{Key: "head_commit.message:summary.message"},
+			{Key: "compare:summary.compare"},
+			{Key: "repository.owner.login:summary.owner"},
+		},
+	}, {
+		Operation: "delete",
+		Paths: []v1alpha1.Path{
+			{Key: "sender"},
+			{Key: "installation"},
+			{Key: "repository.owner"},
+		},
+	}, {
+		Operation: "compute",
+		Condition: "has(data.commits)",
+		Paths: []v1alpha1.Path{
+			{Key: "summary.commits", Value: "size(data.commits)"},
+			{Key: "summary.forced", Value: "data.forced"},
+		},
+	}, {
+		Operation: "add",
+		Paths: []v1alpha1.Path{
+			{Key: "summary.transformed", Value: "true"},
+			{Key: "summary.size", Value: "large"},
+			{Key: "commits[0].verified", Value: "true"},
+			{Key: "repository.pusher", Value: "$pusher"},
+		},
+	},
+}
+
+// pushEvent returns a GitHub push event payload with
+// the given number of commits, about 1 KB per commit.
+func pushEvent(commits int) map[string]interface{} {
+	list := make([]interface{}, commits)
+	for i := range list {
+		list[i] = map[string]interface{}{
+			"id":        fmt.Sprintf("%040d", i),
+			"tree_id":   fmt.Sprintf("%040d", i+1),
+			"distinct":  true,
+			"message":   strings.Repeat("Update the documentation. ", 10),
+			"timestamp": "2021-06-01T12:00:00Z",
+			"url":       fmt.Sprintf("https://github.com/triggermesh/bumblebee/commit/%040d", i),
+			"author": map[string]interface{}{
+				"name":     "Jane Doe",
+				"email":    "jane@example.com",
+				"username": "jane",
+			},
+			"committer": map[string]interface{}{
+				"name":     "GitHub",
+				"email":    "noreply@github.com",
+				"username": "web-flow",
+			},
+			"added":    []interface{}{"docs/index.md"},
+			"removed":  []interface{}{},
+			"modified": []interface{}{"README.md", "docs/operations.md", "docs/examples.md"},
+		}
+	}
+	return map[string]interface{}{
+		"ref":     "refs/heads/main",
+		"before":  fmt.Sprintf("%040d", 0),
+		"after":   fmt.Sprintf("%040d", commits),
+		"forced":  false,
+		"compare": "https://github.com/triggermesh/bumblebee/compare/0000000000...1111111111",
+		"commits": list,
+		"head_commit": map[string]interface{}{
+			"id":      fmt.Sprintf("%040d", commits),
+			"message": "Update the documentation.",
+		},
+		"repository": map[string]interface{}{
+			"id":        35129377,
+			"name":      "bumblebee",
+			"full_name": "triggermesh/bumblebee",
+			"private":   false,
+			"owner": map[string]interface{}{
+				"login": "triggermesh",
+				"id":    24567890,
+			},
+			"stargazers_count": 42,
+		},
+		"pusher": map[string]interface{}{
+			"name":  "jane",
+			"email": "jane@example.com",
+		},
+		"sender": map[string]interface{}{
+			"login": "jane",
+			"id":    12345678,
+		},
+		"installation": map[string]interface{}{
+			"id": 87654321,
+		},
+	}
+}
+
+// reencoded is the baseline Transformer that encodes and decodes
+// the document before every step, as the operations did when
+// they were applied to JSON bytes.
+type reencoded struct {
+	transformer.Transformer
+}
+
+// reencodedEvaluator is the baseline of the Evaluator operations.
+type reencodedEvaluator struct {
+	reencoded
+}
+
+func (r reencoded) Apply(data interface{}) (interface{}, error) {
+	data, err := reencode(data)
+	if err != nil {
+		return nil, err
+	}
+	return r.Transformer.Apply(data)
+}
+
+func (r reencodedEvaluator) Evaluate(document string, data interface{}, activation expression.Activation) (interface{}, error) {
+	data, err := reencode(data)
+	if err != nil {
+		return nil, err
+	}
+	activation[document] = data
+	return r.Transformer.(transformer.Evaluator).Evaluate(document, data, activation)
+}
+
+func reencode(data interface{}) (interface{}, error) {
+	encoded, err := convert.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return convert.Decode(encoded)
+}
+
+// BenchmarkApplyTransformations runs the pipeline over payloads of
+// different sizes with the document that is shared by all steps and
+// with the baseline that encodes the document between the steps.
+func BenchmarkApplyTransformations(b *testing.B) {
+	for _, commits := range []int{1, 50, 650} {
+		event := newEvent()
+		if err := event.SetData(cloudevents.ApplicationJSON, pushEvent(commits)); err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(fmt.Sprintf("%dKB", len(event.Data())/1024), func(b *testing.B) {
+			for _, mode := range []string{"shared", "reencoded"} {
+				pipeline, err := NewHandler(nil, benchmarkTransformations)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if mode == "reencoded" {
+					for i, t := range pipeline.DataPipeline.Transformers {
+						if _, ok := t.(transformer.Evaluator); ok {
+							pipeline.DataPipeline.Transformers[i] = reencodedEvaluator{reencoded{t}}
+							continue
+						}
+						pipeline.DataPipeline.Transformers[i] = reencoded{t}
+					}
+				}
+
+				b.Run(mode, func(b *testing.B) {
+					b.ReportAllocs()
+					b.SetBytes(int64(len(event.Data())))
+					for i := 0; i < b.N; i++ {
+						if _, _, err := pipeline.transform(context.Background(), event.Clone()); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"golang.org/x/time/rate"
+
+	"knative.dev/pkg/logging"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+// limiterSweepSize is the number of keys after which
+// idle limiters are removed when a new key is added.
+const limiterSweepSize = 10000
+
+// rateLimiter keeps token buckets of the event keys.
+type rateLimiter struct {
+	limit rate.Limit
+	burst int
+	path  convert.Path
+	drop  bool
+
+	mux      sync.Mutex
+	limiters map[string]*keyLimiter
+
+	limited uint64
+}
+
+type keyLimiter struct {
+	limiter *rate.Limiter
+	used    time.Time
+}
+
+// RateLimit limits the number of events transformed per second.
+func RateLimit(r *v1alpha1.RateLimit) Option {
+	return func(h *Handler) error {
+		if r == nil {
+			return nil
+		}
+		if r.Rate <= 0 {
+			return fmt.Errorf("rate limit must be positive")
+		}
+		path, err := convert.ParsePath(r.Path)
+		if err != nil {
+			return fmt.Errorf("rate limit: %w", err)
+		}
+
+		limiter := &rateLimiter{
+			limit:    rate.Limit(r.Rate),
+			burst:    r.Burst,
+			path:     path,
+			limiters: make(map[string]*keyLimiter),
+		}
+		if limiter.burst <= 0 {
+			limiter.burst = r.Rate
+		}
+		switch r.Policy {
+		case "", v1alpha1.RateLimitReject:
+		case v1alpha1.RateLimitDrop:
+			limiter.drop = true
+		default:
+			return fmt.Errorf("rate limit policy %q is not supported", r.Policy)
+		}
+
+		h.rateLimiter = limiter
+		return nil
+	}
+}
+
+// check returns nil if the event is within the rate limit, ErrDropEvent
+// or "429 Too Many Requests" result otherwise.
+func (l *rateLimiter) check(ctx context.Context, documents eventDocuments) error {
+	if l.allow(l.key(documents), time.Now()) {
+		return nil
+	}
+
+	limited := atomic.AddUint64(&l.limited, 1)
+	if l.drop {
+		logging.FromContext(ctx).Infof("Dropping event over the rate limit (%d limited)", limited)
+		return transformer.ErrDropEvent
+	}
+	logging.FromContext(ctx).Infof("Rejecting event over the rate limit (%d limited)", limited)
+	return &rejectError{err: cehttp.NewResult(http.StatusTooManyRequests, "rate limit exceeded")}
+}
+
+// key returns the rate limiter key, empty if the path
+// is not set or does not exist in CE Data.
+func (l *rateLimiter) key(documents eventDocuments) string {
+	if l.path.Empty() {
+		return ""
+	}
+	value := l.path.Read(documents.data)
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func (l *rateLimiter) allow(key string, now time.Time) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	kl, ok := l.limiters[key]
+	if !ok {
+		if len(l.limiters) >= limiterSweepSize {
+			l.sweep(now)
+		}
+		kl = &keyLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[key] = kl
+	}
+	kl.used = now
+	return kl.limiter.AllowN(now, 1)
+}
+
+// sweep removes limiters that were idle long enough to refill
+// their buckets, they are equal to the new ones.
+func (l *rateLimiter) sweep(now time.Time) {
+	refill := time.Duration(float64(l.burst) / float64(l.limit) * float64(time.Second))
+	for key, kl := range l.limiters {
+		if now.Sub(kl.used) >= refill {
+			delete(l.limiters, key)
+		}
+	}
+}
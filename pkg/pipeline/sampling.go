@@ -0,0 +1,72 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync/atomic"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"knative.dev/pkg/logging"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+)
+
+// sampler selects the forwarded events by their ID hash.
+type sampler struct {
+	percentage uint32
+
+	skipped uint64
+}
+
+// Sampling forwards the percentage of events and drops the rest.
+func Sampling(s *v1alpha1.Sampling) Option {
+	return func(h *Handler) error {
+		if s == nil {
+			return nil
+		}
+		if s.Percentage < 0 || s.Percentage > 100 {
+			return fmt.Errorf("sampling percentage must be between 0 and 100")
+		}
+		h.sampler = &sampler{percentage: uint32(s.Percentage)}
+		return nil
+	}
+}
+
+// sample returns true if the event must be forwarded.
+// The decision is the same for the redelivered event.
+func (s *sampler) sample(ctx context.Context, event cloudevents.Event) bool {
+	if sampled(event.ID(), s.percentage) {
+		return true
+	}
+
+	skipped := atomic.AddUint64(&s.skipped, 1)
+	logging.FromContext(ctx).Debugf("Dropping event that is not sampled (%d dropped)", skipped)
+	return false
+}
+
+// sampled returns true if the hash of the event ID
+// falls into the percentage.
+func sampled(id string, percentage uint32) bool {
+	hash := fnv.New32a()
+	// hash.Hash never returns an error
+	_, _ = hash.Write([]byte(id))
+	return hash.Sum32()%100 < percentage
+}
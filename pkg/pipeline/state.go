@@ -0,0 +1,55 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/state"
+)
+
+// State sets the store of the values that persist across
+// events. Values are kept in memory by default.
+func State(s *v1alpha1.State) Option {
+	return func(h *Handler) error {
+		if s == nil {
+			return nil
+		}
+
+		var store state.Store
+		switch s.Backend {
+		case "", v1alpha1.StateMemory:
+			store = state.NewMemory()
+		case v1alpha1.StateFile:
+			if s.Path == "" {
+				return fmt.Errorf("state file path is not set")
+			}
+			var err error
+			if store, err = state.NewFile(s.Path); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("state backend %q is not supported", s.Backend)
+		}
+
+		h.state = store
+		h.ContextPipeline.setState(store)
+		h.DataPipeline.setState(store)
+		return nil
+	}
+}
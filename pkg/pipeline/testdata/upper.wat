@@ -0,0 +1,74 @@
+;; Test module for the "wasm" operation, upper.wasm is assembled from this file.
+(module
+  (memory (export "memory") 1)
+
+  ;; The host calls one function at a time, a static buffer is enough.
+  (func (export "allocate") (param $size i32) (result i32)
+    i32.const 1024)
+
+  ;; Converts ASCII letters of the payload to upper case in place.
+  (func (export "transform") (param $ptr i32) (param $len i32) (result i64)
+    (local $i i32) (local $c i32)
+    block $done
+      loop $next
+        local.get $i
+        local.get $len
+        i32.ge_u
+        br_if $done
+        local.get $ptr
+        local.get $i
+        i32.add
+        i32.load8_u
+        local.set $c
+        local.get $c
+        i32.const 97
+        i32.ge_u
+        local.get $c
+        i32.const 122
+        i32.le_u
+        i32.and
+        if
+          local.get $ptr
+          local.get $i
+          i32.add
+          local.get $c
+          i32.const 32
+          i32.sub
+          i32.store8
+        end
+        local.get $i
+        i32.const 1
+        i32.add
+        local.set $i
+        br $next
+      end
+    end
+    local.get $ptr
+    i64.extend_i32_u
+    i64.const 32
+    i64.shl
+    local.get $len
+    i64.extend_i32_u
+    i64.or)
+
+  ;; Returns an empty result.
+  (func (export "drop") (param i32 i32) (result i64)
+    i64.const 0)
+
+  ;; Never returns.
+  (func (export "loop") (param i32 i32) (result i64)
+    loop $forever
+      br $forever
+    end
+    unreachable)
+
+  ;; Traps if 1024 memory pages cannot be allocated.
+  (func (export "grow") (param i32 i32) (result i64)
+    i32.const 1024
+    memory.grow
+    i32.const -1
+    i32.eq
+    if
+      unreachable
+    end
+    i64.const 0))
@@ -0,0 +1,121 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"context"
+	"net/http"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/client"
+	"github.com/cloudevents/sdk-go/v2/extensions"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
+	"go.opencensus.io/trace"
+)
+
+// Span names of the event processing steps.
+const (
+	receiveSpanName   = "transformation.receive"
+	operationSpanName = "transformation.operation"
+	sendSpanName      = "transformation.send"
+	replaySpanName    = "transformation.replay"
+)
+
+// HTTP headers of the binary mode CloudEvents.
+const (
+	ceHeaderSpecVersion = "Ce-Specversion"
+	ceHeaderTraceParent = "Ce-Traceparent"
+	ceHeaderTraceState  = "Ce-Tracestate"
+)
+
+// Span attributes of the pipeline operations.
+const (
+	operationAttribute = "transformation.operation"
+	pathAttribute      = "transformation.path"
+	documentAttribute  = "transformation.document"
+)
+
+// newClient creates a CloudEvents client that propagates the
+// trace context to the sent events and their HTTP requests.
+func newClient() (cloudevents.Client, error) {
+	protocol, err := cehttp.New(
+		cehttp.WithRoundTripper(&ochttp.Transport{
+			Propagation: &tracecontext.HTTPFormat{},
+		}),
+		cehttp.WithMiddleware(headerTrace),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return cloudevents.NewClientObserved(protocol,
+		client.WithTimeNow(),
+		client.WithUUIDs(),
+		client.WithTracePropagation(),
+	)
+}
+
+// headerTrace sets the distributed tracing extension of the binary mode
+// events that do not have it to the span of the HTTP request, which
+// continues the trace of the traceparent header.
+func headerTrace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(ceHeaderSpecVersion) != "" && r.Header.Get(ceHeaderTraceParent) == "" {
+			if span := trace.FromContext(r.Context()); span != nil {
+				ext := extensions.FromSpanContext(span.SpanContext())
+				r.Header.Set(ceHeaderTraceParent, ext.TraceParent)
+				if ext.TraceState != "" {
+					r.Header.Set(ceHeaderTraceState, ext.TraceState)
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startSpan starts a span that is a child of the span in the distributed
+// tracing extension of the event, or of the span in the context if the
+// extension is not set.
+func startSpan(ctx context.Context, name string, event cloudevents.Event) (context.Context, *trace.Span) {
+	var span *trace.Span
+	if ext, ok := extensions.GetDistributedTracingExtension(event); ok {
+		ctx, span = ext.StartChildSpan(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+	}
+	if span == nil {
+		ctx, span = trace.StartSpan(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+	}
+	if span.IsRecordingEvents() {
+		span.AddAttributes(client.EventTraceAttributes(&event)...)
+	}
+	return ctx, span
+}
+
+// propagateTrace sets the distributed tracing extension
+// of the event to the span in the context.
+func propagateTrace(ctx context.Context, event *cloudevents.Event) {
+	if span := trace.FromContext(ctx); span != nil {
+		extensions.FromSpanContext(span.SpanContext()).AddTracingAttributes(event)
+	}
+}
+
+// spanError sets the status of the span to the error, if any.
+func spanError(span *trace.Span, err error) {
+	if err != nil && !cloudevents.IsACK(err) {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+	}
+}
@@ -17,7 +17,6 @@ limitations under the License.
 package add
 
 import (
-	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -33,6 +32,7 @@ type Add struct {
 	Path  string
 	Value string
 
+	path      convert.Path
 	variables *storage.Storage
 }
 
@@ -62,31 +62,24 @@ func (a *Add) InitStep() bool {
 }
 
 // New returns a new instance of Add object.
-func (a *Add) New(key, value string) transformer.Transformer {
+func (a *Add) New(key, value string) (transformer.Transformer, error) {
+	path, err := convert.ParsePath(key)
+	if err != nil {
+		return nil, err
+	}
 	return &Add{
 		Path:  key,
 		Value: value,
 
+		path:      path,
 		variables: a.variables,
-	}
+	}, nil
 }
 
 // Apply is a main method of Transformation that adds any type of
 // variables into existing JSON.
-func (a *Add) Apply(data []byte) ([]byte, error) {
-	input := convert.SliceToMap(strings.Split(a.Path, "."), a.composeValue())
-	var event interface{}
-	if err := json.Unmarshal(data, &event); err != nil {
-		return data, err
-	}
-
-	result := convert.MergeJSONWithMap(event, input)
-	output, err := json.Marshal(result)
-	if err != nil {
-		return data, err
-	}
-
-	return output, nil
+func (a *Add) Apply(data interface{}) (interface{}, error) {
+	return a.path.Merge(data, a.composeValue()), nil
 }
 
 func (a *Add) retrieveVariable(key string) interface{} {
@@ -104,7 +97,7 @@ func (a *Add) composeValue() interface{} {
 			continue
 		}
 		if result == key {
-			return a.retrieveVariable(key)
+			return convert.Copy(a.retrieveVariable(key))
 		}
 		result = fmt.Sprintf("%s%v%s", result[:index], a.retrieveVariable(key), result[index+len(key):])
 	}
@@ -0,0 +1,100 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package compute
+
+import (
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/expression"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+var (
+	_ transformer.Transformer = (*Compute)(nil)
+	_ transformer.Evaluator   = (*Compute)(nil)
+)
+
+// Compute object implements Transformer interface.
+type Compute struct {
+	Path       string
+	Expression *expression.Expression
+
+	path      convert.Path
+	variables *storage.Storage
+}
+
+// InitStep is used to figure out if this operation should
+// run before main Transformations. For example, Store
+// operation needs to run first to load all Pipeline variables.
+var InitStep bool = false
+
+// operationName is used to identify this transformation.
+var operationName string = "compute"
+
+// Register adds this transformation to the map which will
+// be used to create Transformation pipeline.
+func Register(m map[string]transformer.Transformer) {
+	m[operationName] = &Compute{}
+}
+
+// SetStorage sets a shared Storage with Pipeline variables.
+func (c *Compute) SetStorage(storage *storage.Storage) {
+	c.variables = storage
+}
+
+// InitStep returns "true" if this Transformation should run
+// as init step.
+func (c *Compute) InitStep() bool {
+	return InitStep
+}
+
+// New returns a new instance of Compute object. The value
+// is compiled as CEL expression.
+func (c *Compute) New(key, value string) (transformer.Transformer, error) {
+	path, err := convert.ParsePath(key)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := expression.Compile(value)
+	if err != nil {
+		return nil, err
+	}
+	return &Compute{
+		Path:       key,
+		Expression: expr,
+
+		path:      path,
+		variables: c.variables,
+	}, nil
+}
+
+// Apply evaluates the expression with the "data" variable
+// set to the input JSON.
+func (c *Compute) Apply(data interface{}) (interface{}, error) {
+	return c.Evaluate(expression.Data, data, expression.NewActivation(nil, data, c.variables))
+}
+
+// Evaluate is a main method of Transformation that writes
+// the expression result to the path in existing JSON.
+func (c *Compute) Evaluate(_ string, data interface{}, activation expression.Activation) (interface{}, error) {
+	value, err := c.Expression.Eval(activation)
+	if err != nil {
+		return data, err
+	}
+
+	return c.path.Merge(data, value), nil
+}
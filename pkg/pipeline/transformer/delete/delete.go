@@ -19,9 +19,10 @@ package delete
 import (
 	"encoding/json"
 	"fmt"
-	"log"
-	"strconv"
 
+	"go.uber.org/zap"
+
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
 	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
 	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
 )
@@ -34,6 +35,7 @@ type Delete struct {
 	Value string
 	Type  string
 
+	path      convert.Path
 	variables *storage.Storage
 }
 
@@ -63,31 +65,31 @@ func (d *Delete) InitStep() bool {
 }
 
 // New returns a new instance of Delete object.
-func (d *Delete) New(key, value string) transformer.Transformer {
+func (d *Delete) New(key, value string) (transformer.Transformer, error) {
+	path, err := convert.ParsePath(key)
+	if err != nil {
+		return nil, err
+	}
 	return &Delete{
 		Path:  key,
 		Value: value,
 
+		path:      path,
 		variables: d.variables,
-	}
+	}, nil
 }
 
 // Apply is a main method of Transformation that removed any type of
 // variables from existing JSON.
-func (d *Delete) Apply(data []byte) ([]byte, error) {
+func (d *Delete) Apply(data interface{}) (interface{}, error) {
 	d.Value = d.retrieveString(d.Value)
 
-	result, err := d.parse(data, "", "")
+	result, err := d.parse(data, "", convert.Path{})
 	if err != nil {
 		return data, err
 	}
 
-	output, err := json.Marshal(result)
-	if err != nil {
-		return data, err
-	}
-
-	return output, nil
+	return result, nil
 }
 
 func (d *Delete) retrieveString(key string) string {
@@ -99,55 +101,46 @@ func (d *Delete) retrieveString(key string) string {
 	return key
 }
 
-func (d *Delete) parse(data interface{}, key, path string) (interface{}, error) {
-	output := make(map[string]interface{})
+func (d *Delete) parse(data interface{}, key string, path convert.Path) (interface{}, error) {
+	output := convert.NewObject()
 	// TODO: keep only one filter call
 	if d.filter(path, data) {
 		return nil, nil
 	}
 	switch value := data.(type) {
-	case []byte:
-		var m interface{}
-		if err := json.Unmarshal(value, &m); err != nil {
-			return nil, fmt.Errorf("unmarshal err: %v", err)
-		}
-		o, err := d.parse(m, key, path)
-		if err != nil {
-			return nil, fmt.Errorf("recursive call in []bytes case: %v", err)
-		}
-		return o, nil
-	case float64, bool, string, nil:
+	case json.Number, float64, bool, string, nil:
 		return value, nil
 	case []interface{}:
 		slice := []interface{}{}
 		for i, v := range value {
-			o, err := d.parse(v, key, fmt.Sprintf("%s[%d]", path, i))
+			o, err := d.parse(v, key, path.Element(i))
 			if err != nil {
 				return nil, fmt.Errorf("recursive call in []interface case: %v", err)
 			}
 			slice = append(slice, o)
 		}
 		return slice, nil
-	case map[string]interface{}:
-		for k, v := range value {
-			subPath := fmt.Sprintf("%s.%s", path, k)
+	case *convert.Object:
+		for _, k := range value.Keys() {
+			v, _ := value.Get(k)
+			subPath := path.Child(k)
 			if d.filter(subPath, v) {
 				continue
 			}
 			o, err := d.parse(v, k, subPath)
 			if err != nil {
-				return nil, fmt.Errorf("recursive call in map[]interface case: %v", err)
+				return nil, fmt.Errorf("recursive call in object case: %v", err)
 			}
-			output[k] = o
+			output.Set(k, o)
 		}
 	default:
-		log.Printf("unhandled type %T\n", value)
+		zap.S().Warnf("unhandled type %T", value)
 	}
 
 	return output, nil
 }
 
-func (d *Delete) filter(path string, value interface{}) bool {
+func (d *Delete) filter(path convert.Path, value interface{}) bool {
 	switch {
 	case d.Path != "" && d.Value != "":
 		return d.filterPathAndValue(path, value)
@@ -160,22 +153,22 @@ func (d *Delete) filter(path string, value interface{}) bool {
 	return true
 }
 
-func (d *Delete) filterPath(path string) bool {
-	return "."+d.Path == path
+func (d *Delete) filterPath(path convert.Path) bool {
+	return d.path.Equal(path)
 }
 
 func (d *Delete) filterValue(value interface{}) bool {
 	switch v := value.(type) {
 	case string:
 		return v == d.Value
-	case float64:
-		return d.Value == strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number, float64:
+		return convert.NumberEqual(v, json.Number(d.Value))
 	case bool:
 		return d.Value == fmt.Sprintf("%t", v)
 	}
 	return false
 }
 
-func (d *Delete) filterPathAndValue(path string, value interface{}) bool {
+func (d *Delete) filterPathAndValue(path convert.Path, value interface{}) bool {
 	return d.filterPath(path) && d.filterValue(value)
 }
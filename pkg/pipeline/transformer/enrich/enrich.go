@@ -0,0 +1,354 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package enrich
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+var (
+	_ transformer.Transformer    = (*Enrich)(nil)
+	_ transformer.Configurable   = (*Enrich)(nil)
+	_ transformer.ContextApplier = (*Enrich)(nil)
+)
+
+// Enrich object implements Transformer interface.
+type Enrich struct {
+	Path  string
+	Value string
+
+	request         v1alpha1.EnrichRequest
+	client          *http.Client
+	cacheTTL        time.Duration
+	retryBackoff    time.Duration
+	maxResponseSize int64
+	// responses are shared by the operations of the Pipeline
+	// so that the paths of the same request reuse the response.
+	responses *cache
+
+	path      convert.Path
+	value     convert.Path
+	variables *storage.Storage
+}
+
+// InitStep is used to figure out if this operation should
+// run before main Transformations. For example, Store
+// operation needs to run first to load all Pipeline variables.
+var InitStep bool = false
+
+// operationName is used to identify this transformation.
+var operationName string = "enrich"
+
+// Default parameters of the requests.
+const (
+	// defaultTimeout limits the request duration if the timeout is not set.
+	defaultTimeout = 5 * time.Second
+	// defaultRetryBackoff is the delay before the first retry,
+	// it doubles with each next attempt.
+	defaultRetryBackoff = 100 * time.Millisecond
+	// defaultMaxResponseSize limits the size of the response body.
+	defaultMaxResponseSize = 10 << 20
+	// defaultCacheSize is the maximum number of cached responses, the
+	// least recently used ones are removed when it is reached.
+	defaultCacheSize = 1000
+)
+
+// Register adds this transformation to the map which will
+// be used to create Transformation pipeline.
+func Register(m map[string]transformer.Transformer) {
+	m[operationName] = &Enrich{
+		responses: newCache(defaultCacheSize),
+	}
+}
+
+// SetStorage sets a shared Storage with Pipeline variables.
+func (e *Enrich) SetStorage(storage *storage.Storage) {
+	e.variables = storage
+}
+
+// InitStep returns "true" if this Transformation should run
+// as init step.
+func (e *Enrich) InitStep() bool {
+	return InitStep
+}
+
+// New returns a new instance of Enrich object. The key is a path
+// or a variable to write the response to, the value is an optional
+// path inside the response.
+func (e *Enrich) New(key, value string) (transformer.Transformer, error) {
+	path, err := convert.ParseVariableOrPath(key)
+	if err != nil {
+		return nil, err
+	}
+	valuePath, err := convert.ParsePath(value)
+	if err != nil {
+		return nil, err
+	}
+	return &Enrich{
+		Path:  key,
+		Value: value,
+
+		retryBackoff:    defaultRetryBackoff,
+		maxResponseSize: defaultMaxResponseSize,
+		responses:       e.responses,
+
+		path:      path,
+		value:     valuePath,
+		variables: e.variables,
+	}, nil
+}
+
+// Configure sets the request parameters.
+func (e *Enrich) Configure(t v1alpha1.Transform) error {
+	if t.Enrich == nil || t.Enrich.URL == "" {
+		return fmt.Errorf("enrich request URL is not set")
+	}
+	e.request = *t.Enrich
+	if e.request.Method == "" {
+		e.request.Method = http.MethodGet
+	}
+	if e.request.Retries < 0 {
+		return fmt.Errorf("enrich request retries cannot be negative")
+	}
+	// other methods may change the server state, so
+	// their failed requests are not safe to repeat
+	if e.request.Retries != 0 && e.request.Method != http.MethodGet && e.request.Method != http.MethodHead {
+		return fmt.Errorf("enrich %s requests cannot be retried", e.request.Method)
+	}
+
+	timeout := defaultTimeout
+	if t.Enrich.Timeout != nil {
+		timeout = t.Enrich.Timeout.Duration
+	}
+	e.client = &http.Client{Timeout: timeout}
+
+	if t.Enrich.CacheTTL != nil {
+		e.cacheTTL = t.Enrich.CacheTTL.Duration
+	}
+	return nil
+}
+
+// Apply performs the request without the event context.
+func (e *Enrich) Apply(data interface{}) (interface{}, error) {
+	return e.ApplyContext(context.Background(), data)
+}
+
+// ApplyContext is a main method of Transformation that performs
+// the HTTP request and adds its JSON response to the event.
+func (e *Enrich) ApplyContext(ctx context.Context, data interface{}) (interface{}, error) {
+	response, err := e.response(ctx)
+	if err != nil {
+		return data, err
+	}
+
+	value, err := convert.Decode(response)
+	if err != nil {
+		return data, fmt.Errorf("cannot decode %s response: %w", e.request.URL, err)
+	}
+	if e.Value != "" {
+		value = e.value.Read(value)
+	}
+
+	if strings.HasPrefix(e.Path, "$") {
+		e.variables.Set(e.Path, value)
+		return data, nil
+	}
+
+	return e.path.Merge(data, value), nil
+}
+
+// response returns the cached response or performs the request.
+// Variables in the URL are escaped, the ones in the body are encoded
+// as JSON string contents, the ones in the headers must not contain
+// line breaks.
+func (e *Enrich) response(ctx context.Context) ([]byte, error) {
+	url := e.variables.ExpandFunc(e.request.URL, escape)
+	body := e.variables.ExpandFunc(e.request.Body, escapeJSON)
+	headers := make(map[string]string, len(e.request.Headers))
+	for k, v := range e.request.Headers {
+		value := e.variables.Expand(v)
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("header %s contains line break", k)
+		}
+		headers[k] = value
+	}
+
+	key := fmt.Sprintf("%s %s %v %s", e.request.Method, url, headers, body)
+	if e.cacheTTL > 0 && e.responses != nil {
+		if response, ok := e.responses.get(key); ok {
+			return response, nil
+		}
+	}
+
+	var response []byte
+	var err error
+	backoff := e.retryBackoff
+	for attempt := 0; attempt <= e.request.Retries; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, fmt.Errorf("request %s canceled: %w", url, err)
+			case <-timer.C:
+			}
+			backoff *= 2
+		}
+		var retry bool
+		if response, retry, err = e.do(ctx, url, body, headers); err == nil || !retry {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if e.cacheTTL > 0 && e.responses != nil {
+		e.responses.set(key, response, e.cacheTTL)
+	}
+	return response, nil
+}
+
+// escape encodes the variable value for the URL path or query.
+func escape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+// escapeJSON encodes the variable value for a JSON string, so that
+// quotes and control characters do not change the body structure.
+func escapeJSON(value string) string {
+	encoded, err := convert.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(encoded[1 : len(encoded)-1])
+}
+
+// do performs a single request attempt and returns
+// whether a failed attempt can be retried.
+func (e *Enrich) do(ctx context.Context, url, body string, headers map[string]string) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, e.request.Method, url, strings.NewReader(body))
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot create request: %w", err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		// requests of the canceled event are not retried
+		return nil, ctx.Err() == nil, fmt.Errorf("request %s failed: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	response, err := ioutil.ReadAll(io.LimitReader(resp.Body, e.maxResponseSize+1))
+	if err != nil {
+		return nil, true, fmt.Errorf("cannot read %s response: %w", url, err)
+	}
+	if int64(len(response)) > e.maxResponseSize {
+		return nil, false, fmt.Errorf("%s response exceeds %d bytes", url, e.maxResponseSize)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return nil, retry, fmt.Errorf("request %s returned %s", url, resp.Status)
+	}
+	return response, false, nil
+}
+
+// cache keeps the most recently used responses until their TTL expires.
+type cache struct {
+	// size is the maximum number of entries.
+	size    int
+	mux     sync.Mutex
+	entries map[string]*list.Element
+	// order lists the entries from the most recently used.
+	order *list.List
+}
+
+type entry struct {
+	key      string
+	response []byte
+	expires  time.Time
+}
+
+func newCache(size int) *cache {
+	return &cache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *cache) get(key string) ([]byte, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := element.Value.(*entry)
+	if time.Now().After(e.expires) {
+		c.remove(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return e.response, true
+}
+
+func (c *cache) set(key string, response []byte, ttl time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	expires := time.Now().Add(ttl)
+	if element, ok := c.entries[key]; ok {
+		e := element.Value.(*entry)
+		e.response, e.expires = response, expires
+		c.order.MoveToFront(element)
+		return
+	}
+	for c.order.Len() >= c.size && c.order.Len() > 0 {
+		c.remove(c.order.Back())
+	}
+	c.entries[key] = c.order.PushFront(&entry{
+		key:      key,
+		response: response,
+		expires:  expires,
+	})
+}
+
+// remove deletes the entry of the list element.
+func (c *cache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*entry).key)
+}
@@ -0,0 +1,207 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+func newEnrich(t *testing.T, variables *storage.Storage, request v1alpha1.EnrichRequest) *Enrich {
+	e := &Enrich{responses: newCache(defaultCacheSize)}
+	e.SetStorage(variables)
+	tr, err := e.New("result", "")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if !assert.NoError(t, tr.(transformer.Configurable).Configure(v1alpha1.Transform{Enrich: &request})) {
+		t.FailNow()
+	}
+	return tr.(*Enrich)
+}
+
+func TestApply(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/large":
+			_, _ = w.Write([]byte(`"` + strings.Repeat("x", 200) + `"`))
+		case "/echo":
+			body, _ := ioutil.ReadAll(r.Body)
+			_, _ = w.Write(body)
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"path":  r.URL.EscapedPath(),
+				"query": r.URL.Query().Get("q"),
+			})
+		}
+	}))
+	defer server.Close()
+
+	variables := storage.New()
+	variables.Set("$id", "a/b c")
+	variables.Set("$name", `a", "admin": true, "b": "\`)
+	variables.Set("$count", 3)
+	variables.Set("$query", "x&admin=true")
+	variables.Set("$header", "value\r\nX-Injected: true")
+
+	testCases := []struct {
+		name             string
+		request          v1alpha1.EnrichRequest
+		expected         string
+		expectedRequests int32
+		expectErr        bool
+	}{
+		{
+			name:             "Escaped URL variables",
+			request:          v1alpha1.EnrichRequest{URL: server.URL + "/items/$id?q=$query"},
+			expected:         `{"result":{"path":"/items/a%2Fb%20c","query":"x&admin=true"}}`,
+			expectedRequests: 1,
+		}, {
+			name: "Escaped body variables",
+			request: v1alpha1.EnrichRequest{
+				Method: http.MethodPost,
+				URL:    server.URL + "/echo",
+				Body:   `{"name":"$name","count":$count}`,
+			},
+			expected:         `{"result":{"name":"a\", \"admin\": true, \"b\": \"\\","count":3}}`,
+			expectedRequests: 1,
+		}, {
+			name: "Line break in header",
+			request: v1alpha1.EnrichRequest{
+				URL:     server.URL,
+				Headers: map[string]string{"X-Value": "$header"},
+			},
+			expectErr: true,
+		}, {
+			name:             "Non-2xx response",
+			request:          v1alpha1.EnrichRequest{URL: server.URL + "/missing", Retries: 2},
+			expectedRequests: 1,
+			expectErr:        true,
+		}, {
+			name:             "Retries exhausted",
+			request:          v1alpha1.EnrichRequest{URL: server.URL + "/unavailable", Retries: 2},
+			expectedRequests: 3,
+			expectErr:        true,
+		}, {
+			name:             "Response too large",
+			request:          v1alpha1.EnrichRequest{URL: server.URL + "/large", Retries: 2},
+			expectedRequests: 1,
+			expectErr:        true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			atomic.StoreInt32(&requests, 0)
+			tr := newEnrich(t, variables, tc.request)
+			tr.retryBackoff = time.Millisecond
+			tr.maxResponseSize = 100
+
+			result, err := tr.Apply(convert.NewObject())
+			assert.Equal(t, tc.expectedRequests, atomic.LoadInt32(&requests))
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			output, err := convert.Marshal(result)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(output))
+		})
+	}
+}
+
+func TestApplyContext(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	tr := newEnrich(t, storage.New(), v1alpha1.EnrichRequest{URL: server.URL, Retries: 1})
+	tr.retryBackoff = time.Hour
+
+	// the retry of the canceled event does not wait for the backoff
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := tr.ApplyContext(ctx, convert.NewObject())
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestConfigure(t *testing.T) {
+	testCases := map[string]*v1alpha1.EnrichRequest{
+		"Request is not set":   nil,
+		"URL is not set":       {Method: http.MethodGet},
+		"Negative retries":     {URL: "http://example.com", Retries: -1},
+		"Retried POST request": {URL: "http://example.com", Method: http.MethodPost, Retries: 1},
+	}
+
+	for name, request := range testCases {
+		t.Run(name, func(t *testing.T) {
+			tr, err := (&Enrich{}).New("result", "")
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Error(t, tr.(transformer.Configurable).Configure(v1alpha1.Transform{Enrich: request}))
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := newCache(2)
+	c.set("a", []byte("a"), time.Minute)
+	c.set("b", []byte("b"), time.Minute)
+	_, ok := c.get("a")
+	assert.True(t, ok)
+
+	// the least recently used entry is evicted
+	c.set("c", []byte("c"), time.Minute)
+	_, ok = c.get("b")
+	assert.False(t, ok)
+	_, ok = c.get("a")
+	assert.True(t, ok)
+	_, ok = c.get("c")
+	assert.True(t, ok)
+
+	c.set("expired", []byte("d"), -time.Second)
+	_, ok = c.get("expired")
+	assert.False(t, ok)
+	assert.Equal(t, 1, len(c.entries))
+	assert.Equal(t, 1, c.order.Len())
+}
@@ -0,0 +1,110 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package getstate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/state"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+var (
+	_ transformer.Transformer = (*GetState)(nil)
+	_ transformer.Stateful    = (*GetState)(nil)
+)
+
+// GetState object implements Transformer interface.
+type GetState struct {
+	Key    string
+	Target string
+
+	target    convert.Path
+	state     state.Store
+	variables *storage.Storage
+}
+
+// InitStep is used to figure out if this operation should
+// run before main Transformations. For example, Store
+// operation needs to run first to load all Pipeline variables.
+var InitStep bool = false
+
+// operationName is used to identify this transformation.
+var operationName string = "getState"
+
+// Register adds this transformation to the map which will
+// be used to create Transformation pipeline.
+func Register(m map[string]transformer.Transformer) {
+	m[operationName] = &GetState{}
+}
+
+// SetStorage sets a shared Storage with Pipeline variables.
+func (g *GetState) SetStorage(storage *storage.Storage) {
+	g.variables = storage
+}
+
+// SetState sets the store of the persistent values.
+func (g *GetState) SetState(s state.Store) {
+	g.state = s
+}
+
+// InitStep returns "true" if this Transformation should run
+// as init step.
+func (g *GetState) InitStep() bool {
+	return InitStep
+}
+
+// New returns a new instance of GetState object. The key is
+// the state name where Pipeline variables are replaced with
+// their values, the value is a path or a variable to write
+// the stored value to.
+func (g *GetState) New(key, value string) (transformer.Transformer, error) {
+	if key == "" || value == "" {
+		return nil, fmt.Errorf("state name and target must be set")
+	}
+	target, err := convert.ParseVariableOrPath(value)
+	if err != nil {
+		return nil, err
+	}
+	return &GetState{
+		Key:    key,
+		Target: value,
+
+		target:    target,
+		state:     g.state,
+		variables: g.variables,
+	}, nil
+}
+
+// Apply is a main method of Transformation that reads the
+// stored value. The event is not changed if it is not set.
+func (g *GetState) Apply(data interface{}) (interface{}, error) {
+	value, err := g.state.Get(g.variables.Expand(g.Key))
+	if err != nil || value == nil {
+		return data, err
+	}
+
+	if strings.HasPrefix(g.Target, "$") {
+		g.variables.Set(g.Target, value)
+		return data, nil
+	}
+
+	return g.target.Merge(data, value), nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package getstate
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/state"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+)
+
+// failingStore fails all operations.
+type failingStore struct {
+	state.Store
+}
+
+func (failingStore) Get(string) (interface{}, error) {
+	return nil, errors.New("store is unavailable")
+}
+
+func TestApply(t *testing.T) {
+	store := state.NewMemory()
+	assert.NoError(t, store.Set("last-foo", map[string]interface{}{"id": json.Number("9007199254740993")}))
+	assert.NoError(t, store.Set("count", json.Number("3")))
+
+	testCases := []struct {
+		name     string
+		key      string
+		value    string
+		data     string
+		expected string
+		// expectedVars are checked after the operation
+		expectedVars map[string]interface{}
+	}{
+		{
+			name:     "Write to path",
+			key:      "last-$customer",
+			value:    "last",
+			data:     `{"customer":"foo"}`,
+			expected: `{"customer":"foo","last":{"id":9007199254740993}}`,
+		}, {
+			name:         "Write to variable",
+			key:          "count",
+			value:        "$count",
+			data:         `{}`,
+			expected:     `{}`,
+			expectedVars: map[string]interface{}{"$count": json.Number("3")},
+		}, {
+			name:     "Missing value",
+			key:      "last-bar",
+			value:    "last",
+			data:     `{"last":null}`,
+			expected: `{"last":null}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			vars := storage.New()
+			vars.Set("$customer", "foo")
+			g := &GetState{}
+			g.SetStorage(vars)
+			g.SetState(store)
+			op, err := g.New(tc.key, tc.value)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			data, err := convert.Decode([]byte(tc.data))
+			if !assert.NoError(t, err) {
+				return
+			}
+			result, err := op.Apply(data)
+			if !assert.NoError(t, err) {
+				return
+			}
+			output, err := convert.Marshal(result)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(output))
+			for k, v := range tc.expectedVars {
+				assert.Equal(t, v, vars.Get(k))
+			}
+		})
+	}
+
+	// store errors fail the operation
+	g := &GetState{}
+	g.SetStorage(storage.New())
+	g.SetState(failingStore{})
+	op, err := g.New("count", "count")
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = op.Apply(convert.NewObject())
+	assert.Error(t, err)
+}
+
+func TestNew(t *testing.T) {
+	_, err := (&GetState{}).New("", "count")
+	assert.Error(t, err)
+	_, err = (&GetState{}).New("count", "")
+	assert.Error(t, err)
+	_, err = (&GetState{}).New("count", "count..total")
+	assert.Error(t, err)
+}
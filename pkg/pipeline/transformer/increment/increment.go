@@ -0,0 +1,179 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package increment
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/state"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+var (
+	_ transformer.Transformer  = (*Increment)(nil)
+	_ transformer.Configurable = (*Increment)(nil)
+	_ transformer.Stateful     = (*Increment)(nil)
+)
+
+// Increment object implements Transformer interface.
+type Increment struct {
+	Key    string
+	Target string
+
+	target convert.Path
+	by     string
+	byPath convert.Path
+
+	state     state.Store
+	variables *storage.Storage
+}
+
+// InitStep is used to figure out if this operation should
+// run before main Transformations. For example, Store
+// operation needs to run first to load all Pipeline variables.
+var InitStep bool = false
+
+// operationName is used to identify this transformation.
+var operationName string = "increment"
+
+// Register adds this transformation to the map which will
+// be used to create Transformation pipeline.
+func Register(m map[string]transformer.Transformer) {
+	m[operationName] = &Increment{}
+}
+
+// SetStorage sets a shared Storage with Pipeline variables.
+func (i *Increment) SetStorage(storage *storage.Storage) {
+	i.variables = storage
+}
+
+// SetState sets the store of the counters.
+func (i *Increment) SetState(s state.Store) {
+	i.state = s
+}
+
+// InitStep returns "true" if this Transformation should run
+// as init step.
+func (i *Increment) InitStep() bool {
+	return InitStep
+}
+
+// New returns a new instance of Increment object. The key is
+// the counter name where Pipeline variables are replaced with
+// their values, the value is an optional path or a variable
+// to write the incremented counter to.
+func (i *Increment) New(key, value string) (transformer.Transformer, error) {
+	if key == "" {
+		return nil, fmt.Errorf("counter name is empty")
+	}
+	target, err := convert.ParseVariableOrPath(value)
+	if err != nil {
+		return nil, err
+	}
+	return &Increment{
+		Key:    key,
+		Target: value,
+
+		target:    target,
+		state:     i.state,
+		variables: i.variables,
+	}, nil
+}
+
+// Configure sets the counter step.
+func (i *Increment) Configure(t v1alpha1.Transform) error {
+	if t.Increment == nil || t.Increment.By == "" {
+		return nil
+	}
+	i.by = t.Increment.By
+	if isNumber(i.by) {
+		return nil
+	}
+	path, err := convert.ParseVariableOrPath(i.by)
+	if err != nil {
+		return fmt.Errorf("increment step: %w", err)
+	}
+	i.byPath = path
+	return nil
+}
+
+// Apply is a main method of Transformation that increments
+// the counter and writes its new value to the event.
+func (i *Increment) Apply(data interface{}) (interface{}, error) {
+	delta, err := i.delta(data)
+	if err != nil {
+		return data, err
+	}
+	counter, err := i.state.Increment(i.variables.Expand(i.Key), delta)
+	if err != nil {
+		return data, err
+	}
+
+	switch {
+	case i.Target == "":
+		return data, nil
+	case strings.HasPrefix(i.Target, "$"):
+		i.variables.Set(i.Target, counter)
+		return data, nil
+	}
+
+	return i.target.Merge(data, counter), nil
+}
+
+// delta returns the number the counter is incremented by.
+func (i *Increment) delta(event interface{}) (json.Number, error) {
+	if i.by == "" {
+		return "1", nil
+	}
+	if isNumber(i.by) {
+		return json.Number(i.by), nil
+	}
+
+	var value interface{}
+	if strings.HasPrefix(i.by, "$") {
+		value = i.variables.Get(i.by)
+	} else {
+		value = i.byPath.Read(event)
+	}
+	switch v := value.(type) {
+	case json.Number:
+		return v, nil
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'f', -1, 64)), nil
+	case string:
+		if isNumber(v) {
+			return json.Number(v), nil
+		}
+	}
+	return "", fmt.Errorf("increment step %q is not a number: %v", i.by, value)
+}
+
+// isNumber returns true if the string is a JSON number.
+func isNumber(s string) bool {
+	var value interface{}
+	if err := convert.Unmarshal([]byte(s), &value); err != nil {
+		return false
+	}
+	_, ok := value.(json.Number)
+	return ok
+}
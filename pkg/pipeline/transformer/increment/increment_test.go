@@ -0,0 +1,181 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package increment
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/state"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+// failingStore fails all operations.
+type failingStore struct {
+	state.Store
+}
+
+func (failingStore) Increment(string, json.Number) (json.Number, error) {
+	return "", errors.New("store is unavailable")
+}
+
+func TestApply(t *testing.T) {
+	testCases := []struct {
+		name      string
+		key       string
+		value     string
+		by        string
+		data      string
+		expected  []string
+		expectErr bool
+	}{
+		{
+			name:     "Increment by one",
+			key:      "orders",
+			value:    "count",
+			data:     `{}`,
+			expected: []string{`{"count":1}`, `{"count":2}`},
+		}, {
+			name:     "Counter per variable",
+			key:      "orders-$customer",
+			value:    "count",
+			data:     `{"customer":"foo"}`,
+			expected: []string{`{"customer":"foo","count":1}`, `{"customer":"foo","count":2}`},
+		}, {
+			name:     "Increment by number",
+			key:      "total",
+			value:    "total",
+			by:       "0.5",
+			data:     `{}`,
+			expected: []string{`{"total":0.5}`, `{"total":1}`},
+		}, {
+			name:     "Increment by path",
+			key:      "total",
+			value:    "total",
+			by:       "amount",
+			data:     `{"amount":9007199254740993}`,
+			expected: []string{`{"amount":9007199254740993,"total":9007199254740993}`, `{"amount":9007199254740993,"total":18014398509481986}`},
+		}, {
+			name:     "Increment by string number",
+			key:      "total",
+			by:       "amount",
+			data:     `{"amount":"2"}`,
+			expected: []string{`{"amount":"2"}`},
+		}, {
+			name:      "Step is not a number",
+			key:       "total",
+			by:        "amount",
+			data:      `{"amount":"two"}`,
+			expectErr: true,
+		}, {
+			name:      "Missing step",
+			key:       "total",
+			by:        "amount",
+			data:      `{}`,
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			vars := storage.New()
+			vars.Set("$customer", "foo")
+			i := &Increment{}
+			i.SetStorage(vars)
+			i.SetState(state.NewMemory())
+			op, err := i.New(tc.key, tc.value)
+			if !assert.NoError(t, err) {
+				return
+			}
+			if !assert.NoError(t, op.(transformer.Configurable).Configure(v1alpha1.Transform{
+				Increment: &v1alpha1.Increment{By: tc.by},
+			})) {
+				return
+			}
+
+			if tc.expectErr {
+				data, err := convert.Decode([]byte(tc.data))
+				assert.NoError(t, err)
+				_, err = op.Apply(data)
+				assert.Error(t, err)
+				return
+			}
+			for _, expected := range tc.expected {
+				data, err := convert.Decode([]byte(tc.data))
+				if !assert.NoError(t, err) {
+					return
+				}
+				result, err := op.Apply(data)
+				if !assert.NoError(t, err) {
+					return
+				}
+				output, err := convert.Marshal(result)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, string(output))
+			}
+		})
+	}
+}
+
+func TestApplyVariable(t *testing.T) {
+	vars := storage.New()
+	store := state.NewMemory()
+	i := &Increment{}
+	i.SetStorage(vars)
+	i.SetState(store)
+	op, err := i.New("orders", "$count")
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = op.Apply(convert.NewObject())
+	assert.NoError(t, err)
+	assert.Equal(t, json.Number("1"), vars.Get("$count"))
+
+	counter, err := store.Get("orders")
+	assert.NoError(t, err)
+	assert.Equal(t, json.Number("1"), counter)
+
+	// store errors fail the operation
+	i.SetState(failingStore{})
+	op, err = i.New("orders", "$count")
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = op.Apply(convert.NewObject())
+	assert.Error(t, err)
+}
+
+func TestNew(t *testing.T) {
+	_, err := (&Increment{}).New("", "count")
+	assert.Error(t, err)
+	_, err = (&Increment{}).New("orders", "count..total")
+	assert.Error(t, err)
+
+	op, err := (&Increment{}).New("orders", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Error(t, op.(transformer.Configurable).Configure(v1alpha1.Transform{
+		Increment: &v1alpha1.Increment{By: "amount..total"},
+	}))
+}
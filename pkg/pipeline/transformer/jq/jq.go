@@ -0,0 +1,135 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jq
+
+import (
+	"fmt"
+
+	"github.com/itchyny/gojq"
+
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+var _ transformer.Transformer = (*JQ)(nil)
+
+// JQ object implements Transformer interface.
+type JQ struct {
+	Path   string
+	Filter string
+
+	path      convert.Path
+	code      *gojq.Code
+	variables *storage.Storage
+}
+
+// InitStep is used to figure out if this operation should
+// run before main Transformations. For example, Store
+// operation needs to run first to load all Pipeline variables.
+var InitStep bool = false
+
+// operationName is used to identify this transformation.
+var operationName string = "jq"
+
+// Register adds this transformation to the map which will
+// be used to create Transformation pipeline.
+func Register(m map[string]transformer.Transformer) {
+	m[operationName] = &JQ{}
+}
+
+// SetStorage sets a shared Storage with Pipeline variables.
+func (j *JQ) SetStorage(storage *storage.Storage) {
+	j.variables = storage
+}
+
+// InitStep returns "true" if this Transformation should run
+// as init step.
+func (j *JQ) InitStep() bool {
+	return InitStep
+}
+
+// New returns a new instance of JQ object. The value
+// is compiled as jq filter.
+func (j *JQ) New(key, value string) (transformer.Transformer, error) {
+	path, err := convert.ParsePath(key)
+	if err != nil {
+		return nil, err
+	}
+	code, err := compile(value)
+	if err != nil {
+		return nil, err
+	}
+	return &JQ{
+		Path:   key,
+		Filter: value,
+
+		path:      path,
+		code:      code,
+		variables: j.variables,
+	}, nil
+}
+
+func compile(filter string) (*gojq.Code, error) {
+	query, err := gojq.Parse(filter)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse jq filter %q: %w", filter, err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compile jq filter %q: %w", filter, err)
+	}
+	return code, nil
+}
+
+// Apply is a main method of Transformation that runs the jq filter
+// on existing JSON and writes the result to the path, or replaces
+// the whole JSON if the path is empty. The filter that yields no
+// results drops the event, the filter that yields more than one
+// result fails, such filters are wrapped in [] to collect results.
+func (j *JQ) Apply(data interface{}) (interface{}, error) {
+	var value interface{}
+	results := 0
+	// jq works on maps and converts json.Number values
+	// of its input in place, it runs on a plain copy
+	iter := j.code.Run(convert.Plain(data))
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			return data, fmt.Errorf("jq filter %q: %w", j.Filter, err)
+		}
+		if results++; results > 1 {
+			return data, fmt.Errorf("jq filter %q yields more than one result, use [%s] to collect them", j.Filter, j.Filter)
+		}
+		value = v
+	}
+	if results == 0 {
+		return data, transformer.ErrDropEvent
+	}
+
+	// jq yields integers and results that share values
+	// with the input, copy them as a new JSON tree
+	value = convert.Copy(value)
+	if j.path.Empty() {
+		return value, nil
+	}
+
+	return j.path.Merge(data, value), nil
+}
@@ -0,0 +1,339 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8slookup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+var (
+	_ transformer.Transformer    = (*K8sLookup)(nil)
+	_ transformer.Configurable   = (*K8sLookup)(nil)
+	_ transformer.ContextApplier = (*K8sLookup)(nil)
+)
+
+// K8sLookup object implements Transformer interface.
+type K8sLookup struct {
+	Path  string
+	Value string
+
+	path          convert.Path
+	value         convert.Path
+	gvk           schema.GroupVersionKind
+	namespace     string
+	namespacePath convert.Path
+	name          string
+	namePath      convert.Path
+
+	client    *Client
+	variables *storage.Storage
+}
+
+// InitStep is used to figure out if this operation should
+// run before main Transformations. For example, Store
+// operation needs to run first to load all Pipeline variables.
+var InitStep bool = false
+
+// operationName is used to identify this transformation.
+var operationName string = "k8slookup"
+
+// Default parameters of the Client.
+const (
+	// defaultTimeout limits the duration of the object request.
+	defaultTimeout = 5 * time.Second
+	// defaultCacheTTL is how long the fetched objects are reused
+	// so that multiple paths do not request the same object.
+	defaultCacheTTL = 5 * time.Second
+)
+
+// Client fetches the objects for the operations of a Transformation
+// and caches them for a short time.
+type Client struct {
+	namespace string
+	timeout   time.Duration
+	cacheTTL  time.Duration
+
+	mux     sync.Mutex
+	dynamic dynamic.Interface
+	mapper  meta.RESTMapper
+	objects map[string]cachedObject
+}
+
+type cachedObject struct {
+	object  *convert.Object
+	expires time.Time
+}
+
+// NewClient returns the Client of the Transformation namespace. Objects
+// are read from it when the reference has no namespace, objects in other
+// namespaces are not read since the adapter is only allowed to access its
+// own namespace. The dynamic client and the mapper of kinds to resources
+// are created from the in-cluster configuration when the first object is
+// requested if they are nil.
+func NewClient(namespace string, c dynamic.Interface, m meta.RESTMapper) *Client {
+	return &Client{
+		namespace: namespace,
+		timeout:   defaultTimeout,
+		cacheTTL:  defaultCacheTTL,
+		dynamic:   c,
+		mapper:    m,
+		objects:   make(map[string]cachedObject),
+	}
+}
+
+// Register adds this transformation to the map which will
+// be used to create Transformation pipeline.
+func Register(m map[string]transformer.Transformer) {
+	m[operationName] = &K8sLookup{}
+}
+
+// SetStorage sets a shared Storage with Pipeline variables.
+func (k *K8sLookup) SetStorage(storage *storage.Storage) {
+	k.variables = storage
+}
+
+// SetClient sets the Client that fetches the objects.
+func (k *K8sLookup) SetClient(c *Client) {
+	k.client = c
+}
+
+// InitStep returns "true" if this Transformation should run
+// as init step.
+func (k *K8sLookup) InitStep() bool {
+	return InitStep
+}
+
+// New returns a new instance of K8sLookup object. The key is a path
+// or a variable to write the object field to, the value is the field
+// path inside the object, the whole object if empty.
+func (k *K8sLookup) New(key, value string) (transformer.Transformer, error) {
+	path, err := convert.ParseVariableOrPath(key)
+	if err != nil {
+		return nil, err
+	}
+	valuePath, err := convert.ParsePath(value)
+	if err != nil {
+		return nil, err
+	}
+	return &K8sLookup{
+		Path:  key,
+		Value: value,
+
+		path:      path,
+		value:     valuePath,
+		client:    k.client,
+		variables: k.variables,
+	}, nil
+}
+
+// Configure sets the object reference.
+func (k *K8sLookup) Configure(t v1alpha1.Transform) error {
+	o := t.K8sLookup
+	if o == nil || o.Kind == "" || o.Name == "" {
+		return fmt.Errorf("kubernetes object kind and name are not set")
+	}
+	gv, err := schema.ParseGroupVersion(o.APIVersion)
+	if err != nil {
+		return fmt.Errorf("cannot parse object apiVersion: %w", err)
+	}
+	if gk := gv.WithKind(o.Kind).GroupKind(); !v1alpha1.LookupKinds[gk] {
+		return fmt.Errorf("lookup of %s is not allowed", gk)
+	}
+	if k.namePath, err = convert.ParseVariableOrPath(o.Name); err != nil {
+		return fmt.Errorf("object name: %w", err)
+	}
+	if k.namespacePath, err = convert.ParseVariableOrPath(o.Namespace); err != nil {
+		return fmt.Errorf("object namespace: %w", err)
+	}
+	k.gvk = gv.WithKind(o.Kind)
+	k.namespace = o.Namespace
+	k.name = o.Name
+	return nil
+}
+
+// Apply fetches the object without the event context.
+func (k *K8sLookup) Apply(data interface{}) (interface{}, error) {
+	return k.ApplyContext(context.Background(), data)
+}
+
+// ApplyContext is a main method of Transformation that fetches the
+// Kubernetes object and writes its field to the event or the variable.
+// Fields of missing objects are not written.
+func (k *K8sLookup) ApplyContext(ctx context.Context, data interface{}) (interface{}, error) {
+	if k.client == nil {
+		return data, fmt.Errorf("kubernetes client is not set")
+	}
+	name := k.resolve(data, k.name, k.namePath)
+	if name == "" {
+		return data, fmt.Errorf("%s name at %q is empty", k.gvk.Kind, k.name)
+	}
+
+	object, err := k.client.get(ctx, k.gvk, k.resolve(data, k.namespace, k.namespacePath), name)
+	if err != nil {
+		return data, err
+	}
+	if object == nil {
+		zap.S().Debugf("%s %q not found", k.gvk.Kind, name)
+		return data, nil
+	}
+
+	value := interface{}(object)
+	if k.Value != "" {
+		value = k.value.Read(object)
+	}
+
+	// cached objects are shared by all events
+	value = convert.Copy(value)
+
+	if strings.HasPrefix(k.Path, "$") {
+		k.variables.Set(k.Path, value)
+		return data, nil
+	}
+
+	return k.path.Merge(data, value), nil
+}
+
+// resolve returns the value of the variable or the event path.
+func (k *K8sLookup) resolve(event interface{}, source string, path convert.Path) string {
+	if source == "" {
+		return ""
+	}
+	var value interface{}
+	if strings.HasPrefix(source, "$") {
+		value = k.variables.Get(source)
+	} else {
+		value = path.Read(event)
+	}
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// get returns the object content, nil if the object does not exist.
+func (c *Client) get(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string) (*convert.Object, error) {
+	client, mapper, err := c.clients()
+	if err != nil {
+		return nil, err
+	}
+
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		// the kind may be defined after the discovery was cached
+		if resettable, ok := mapper.(interface{ Reset() }); ok {
+			resettable.Reset()
+			mapping, err = mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot find resource of %s: %w", gvk, err)
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return nil, fmt.Errorf("%s is cluster scoped", gvk.Kind)
+	}
+	if namespace == "" {
+		namespace = c.namespace
+	}
+	if c.namespace != "" && namespace != c.namespace {
+		return nil, fmt.Errorf("%s %q is not in the namespace %q", gvk.Kind, name, c.namespace)
+	}
+	resource := client.Resource(mapping.Resource).Namespace(namespace)
+
+	key := fmt.Sprintf("%s/%s/%s", mapping.Resource, namespace, name)
+	c.mux.Lock()
+	cached, ok := c.objects[key]
+	c.mux.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.object, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var object *convert.Object
+	u, err := resource.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrs.IsNotFound(err):
+	case err != nil:
+		return nil, fmt.Errorf("cannot get %s %q: %w", gvk.Kind, name, err)
+	default:
+		// unstructured fields may contain integers
+		// that are converted with the object
+		object = convert.Copy(u.Object).(*convert.Object)
+	}
+
+	now := time.Now()
+	c.mux.Lock()
+	for cachedKey, o := range c.objects {
+		if now.After(o.expires) {
+			delete(c.objects, cachedKey)
+		}
+	}
+	c.objects[key] = cachedObject{
+		object:  object,
+		expires: now.Add(c.cacheTTL),
+	}
+	c.mux.Unlock()
+	return object, nil
+}
+
+// clients returns the dynamic client and the REST mapper,
+// creating them from the in-cluster configuration if needed.
+func (c *Client) clients() (dynamic.Interface, meta.RESTMapper, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.dynamic != nil {
+		return c.dynamic, c.mapper, nil
+	}
+
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot load in-cluster config: %w", err)
+	}
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create discovery client: %w", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create dynamic client: %w", err)
+	}
+
+	c.dynamic = dynamicClient
+	c.mapper = restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
+	return c.dynamic, c.mapper, nil
+}
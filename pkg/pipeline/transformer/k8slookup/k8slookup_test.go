@@ -0,0 +1,212 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8slookup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+var deploymentGVK = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+
+func testClient(scope meta.RESTScope) (*Client, *dynamicfake.FakeDynamicClient) {
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"namespace": "shop",
+			"name":      "checkout",
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(3),
+		},
+	}}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(deploymentGVK, scope)
+
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), deployment)
+	return NewClient("shop", client, mapper), client
+}
+
+func testLookup(t *testing.T, c *Client, key, value string, object v1alpha1.KubernetesObject) transformer.Transformer {
+	k := &K8sLookup{}
+	k.SetStorage(storage.New())
+	k.SetClient(c)
+	op, err := k.New(key, value)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	if !assert.NoError(t, op.(transformer.Configurable).Configure(v1alpha1.Transform{K8sLookup: &object})) {
+		return nil
+	}
+	return op
+}
+
+func TestApply(t *testing.T) {
+	c, _ := testClient(meta.RESTScopeNamespace)
+
+	testCases := []struct {
+		name      string
+		key       string
+		value     string
+		object    v1alpha1.KubernetesObject
+		data      string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "Object field",
+			key:      "replicas",
+			value:    "spec.replicas",
+			object:   v1alpha1.KubernetesObject{APIVersion: "apps/v1", Kind: "Deployment", Name: "name"},
+			data:     `{"name":"checkout"}`,
+			expected: `{"name":"checkout","replicas":3}`,
+		}, {
+			name:     "Whole object",
+			key:      "deployment.metadata",
+			value:    "metadata",
+			object:   v1alpha1.KubernetesObject{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "ns", Name: "name"},
+			data:     `{"ns":"shop","name":"checkout"}`,
+			expected: `{"ns":"shop","name":"checkout","deployment":{"metadata":{"name":"checkout","namespace":"shop"}}}`,
+		}, {
+			name:     "Object not found",
+			key:      "replicas",
+			value:    "spec.replicas",
+			object:   v1alpha1.KubernetesObject{APIVersion: "apps/v1", Kind: "Deployment", Name: "name"},
+			data:     `{"name":"cart"}`,
+			expected: `{"name":"cart"}`,
+		}, {
+			name:      "Empty name",
+			key:       "replicas",
+			object:    v1alpha1.KubernetesObject{APIVersion: "apps/v1", Kind: "Deployment", Name: "name"},
+			data:      `{}`,
+			expectErr: true,
+		}, {
+			name:      "Another namespace",
+			key:       "replicas",
+			object:    v1alpha1.KubernetesObject{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "ns", Name: "name"},
+			data:      `{"ns":"kube-system","name":"checkout"}`,
+			expectErr: true,
+		}, {
+			name:      "Unknown resource",
+			key:       "replicas",
+			object:    v1alpha1.KubernetesObject{APIVersion: "batch/v1", Kind: "Job", Name: "name"},
+			data:      `{"name":"checkout"}`,
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			op := testLookup(t, c, tc.key, tc.value, tc.object)
+			if op == nil {
+				return
+			}
+			data, err := convert.Decode([]byte(tc.data))
+			if !assert.NoError(t, err) {
+				return
+			}
+			result, err := op.(transformer.ContextApplier).ApplyContext(context.Background(), data)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			output, err := convert.Marshal(result)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(output))
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	object := v1alpha1.KubernetesObject{APIVersion: "apps/v1", Kind: "Deployment", Name: "$name"}
+
+	// the object is cached
+	c, client := testClient(meta.RESTScopeNamespace)
+	op := testLookup(t, c, "$replicas", "spec.replicas", object)
+	if op == nil {
+		return
+	}
+	k := op.(*K8sLookup)
+	k.variables.Set("$name", "checkout")
+	_, err := op.Apply(convert.NewObject())
+	assert.NoError(t, err)
+	assert.Equal(t, json.Number("3"), k.variables.Get("$replicas"))
+
+	client.PrependReactor("get", "*", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("unavailable")
+	})
+	k.variables.Set("$replicas", nil)
+	_, err = op.Apply(convert.NewObject())
+	assert.NoError(t, err)
+	assert.Equal(t, json.Number("3"), k.variables.Get("$replicas"))
+
+	// request errors fail the operation
+	k.variables.Set("$name", "cart")
+	_, err = op.Apply(convert.NewObject())
+	assert.Error(t, err)
+
+	// cluster scoped resources are not read
+	c, _ = testClient(meta.RESTScopeRoot)
+	k.SetClient(c)
+	k.variables.Set("$name", "checkout")
+	_, err = op.Apply(convert.NewObject())
+	assert.Error(t, err)
+
+	// the client must be set
+	k.SetClient(nil)
+	_, err = op.Apply(convert.NewObject())
+	assert.Error(t, err)
+}
+
+func TestConfigure(t *testing.T) {
+	testCases := map[string]*v1alpha1.KubernetesObject{
+		"Object is not set":   nil,
+		"Name is not set":     {APIVersion: "apps/v1", Kind: "Deployment"},
+		"Invalid API version": {APIVersion: "apps/v1/beta", Kind: "Deployment", Name: "foo"},
+		"Kind is not allowed": {APIVersion: "v1", Kind: "Secret", Name: "foo"},
+		"Invalid name path":   {APIVersion: "apps/v1", Kind: "Deployment", Name: "foo..bar"},
+	}
+
+	for name, object := range testCases {
+		t.Run(name, func(t *testing.T) {
+			op, err := (&K8sLookup{}).New("foo", "")
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Error(t, op.(transformer.Configurable).Configure(v1alpha1.Transform{K8sLookup: object}))
+		})
+	}
+}
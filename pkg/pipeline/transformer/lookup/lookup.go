@@ -0,0 +1,246 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lookup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"sigs.k8s.io/yaml"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/configmap"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+var (
+	_ transformer.Transformer  = (*Lookup)(nil)
+	_ transformer.Configurable = (*Lookup)(nil)
+)
+
+// Lookup object implements Transformer interface.
+type Lookup struct {
+	Path   string
+	Target string
+
+	path         convert.Path
+	target       convert.Path
+	table        *table
+	defaultValue *string
+	dropOnMiss   bool
+
+	variables *storage.Storage
+}
+
+// table is a lookup map that is reloaded when
+// the mounted ConfigMap changes.
+type table struct {
+	inline map[string]interface{}
+	file   string
+
+	mux     sync.RWMutex
+	entries map[string]interface{}
+	modTime time.Time
+	checked time.Time
+}
+
+// InitStep is used to figure out if this operation should
+// run before main Transformations. For example, Store
+// operation needs to run first to load all Pipeline variables.
+var InitStep bool = false
+
+// operationName is used to identify this transformation.
+var operationName string = "lookup"
+
+// ReloadInterval is how often the mounted ConfigMap
+// is checked for changes.
+var ReloadInterval = 10 * time.Second
+
+// Register adds this transformation to the map which will
+// be used to create Transformation pipeline.
+func Register(m map[string]transformer.Transformer) {
+	m[operationName] = &Lookup{}
+}
+
+// SetStorage sets a shared Storage with Pipeline variables.
+func (l *Lookup) SetStorage(storage *storage.Storage) {
+	l.variables = storage
+}
+
+// InitStep returns "true" if this Transformation should run
+// as init step.
+func (l *Lookup) InitStep() bool {
+	return InitStep
+}
+
+// New returns a new instance of Lookup object. The key is a path
+// or a variable with the value to look up, the value is a path or
+// a variable to write the result to, the key itself if empty.
+func (l *Lookup) New(key, value string) (transformer.Transformer, error) {
+	if value == "" {
+		value = key
+	}
+	path, err := convert.ParseVariableOrPath(key)
+	if err != nil {
+		return nil, err
+	}
+	target, err := convert.ParseVariableOrPath(value)
+	if err != nil {
+		return nil, err
+	}
+	return &Lookup{
+		Path:   key,
+		Target: value,
+
+		path:      path,
+		target:    target,
+		variables: l.variables,
+	}, nil
+}
+
+// Configure loads the lookup table.
+func (l *Lookup) Configure(t v1alpha1.Transform) error {
+	if t.Lookup == nil {
+		return fmt.Errorf("lookup table is not set")
+	}
+
+	tbl := &table{
+		inline: make(map[string]interface{}, len(t.Lookup.Table)),
+	}
+	for k, v := range t.Lookup.Table {
+		tbl.inline[k] = v
+	}
+	if ref := t.Lookup.ConfigMapKeyRef; ref != nil {
+		tbl.file = configmap.Path(ref.Name, ref.Key)
+	}
+	if err := tbl.load(); err != nil {
+		return err
+	}
+
+	l.table = tbl
+	l.defaultValue = t.Lookup.Default
+	l.dropOnMiss = t.Lookup.DropOnMiss
+	return nil
+}
+
+// Apply is a main method of Transformation that replaces
+// the value with the corresponding table entry.
+func (l *Lookup) Apply(data interface{}) (interface{}, error) {
+	var key interface{}
+	if strings.HasPrefix(l.Path, "$") {
+		key = l.variables.Get(l.Path)
+	} else {
+		key = l.path.Read(data)
+	}
+
+	var result interface{}
+	var found bool
+	if key != nil {
+		result, found = l.table.get(fmt.Sprint(key))
+	}
+	if !found {
+		switch {
+		case l.dropOnMiss:
+			return data, transformer.ErrDropEvent
+		case l.defaultValue != nil:
+			result = *l.defaultValue
+		default:
+			return data, nil
+		}
+	}
+	// table entries are shared by all events
+	result = convert.Copy(result)
+
+	if strings.HasPrefix(l.Target, "$") {
+		l.variables.Set(l.Target, result)
+		return data, nil
+	}
+
+	return l.target.Merge(data, result), nil
+}
+
+func (t *table) get(key string) (interface{}, bool) {
+	t.mux.RLock()
+	expired := t.file != "" && time.Since(t.checked) >= ReloadInterval
+	t.mux.RUnlock()
+
+	if expired {
+		if err := t.load(); err != nil {
+			zap.S().Errorw("Cannot reload lookup table", zap.Error(err))
+		}
+	}
+
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+	value, ok := t.entries[key]
+	return value, ok
+}
+
+// load reads the ConfigMap if it has changed
+// and merges it with the inline entries.
+func (t *table) load() error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.checked = time.Now()
+	if t.file == "" {
+		t.entries = t.inline
+		return nil
+	}
+
+	info, err := os.Stat(t.file)
+	if err != nil {
+		return fmt.Errorf("cannot read lookup table: %w", err)
+	}
+	if t.entries != nil && info.ModTime().Equal(t.modTime) {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(t.file)
+	if err != nil {
+		return fmt.Errorf("cannot read lookup table: %w", err)
+	}
+	var fromFile map[string]interface{}
+	if err := yaml.Unmarshal(content, &fromFile, useNumber); err != nil {
+		return fmt.Errorf("cannot decode lookup table %q: %w", t.file, err)
+	}
+
+	entries := make(map[string]interface{}, len(t.inline)+len(fromFile))
+	for k, v := range t.inline {
+		entries[k] = v
+	}
+	for k, v := range fromFile {
+		entries[k] = v
+	}
+	t.entries = entries
+	t.modTime = info.ModTime()
+	return nil
+}
+
+// useNumber keeps the table numbers as json.Number.
+func useNumber(d *json.Decoder) *json.Decoder {
+	d.UseNumber()
+	return d
+}
@@ -0,0 +1,204 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lookup
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/configmap"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+func TestApply(t *testing.T) {
+	defaultValue := "unknown"
+	table := map[string]string{
+		"1":   "low",
+		"foo": "bar",
+	}
+
+	testCases := []struct {
+		name     string
+		key      string
+		value    string
+		lookup   v1alpha1.LookupTable
+		vars     map[string]interface{}
+		data     string
+		expected string
+		// expectedVars are checked after the operation
+		expectedVars map[string]interface{}
+		dropped      bool
+	}{
+		{
+			name:     "Replace value",
+			key:      "level",
+			data:     `{"level":1}`,
+			expected: `{"level":"low"}`,
+		}, {
+			name:     "Write to target",
+			key:      "a.b",
+			value:    "c",
+			data:     `{"a":{"b":"foo"}}`,
+			expected: `{"a":{"b":"foo"},"c":"bar"}`,
+		}, {
+			name:     "Miss keeps value",
+			key:      "level",
+			data:     `{"level":2}`,
+			expected: `{"level":2}`,
+		}, {
+			name:     "Missing path",
+			key:      "level",
+			data:     `{}`,
+			expected: `{}`,
+		}, {
+			name:     "Miss with default",
+			key:      "level",
+			value:    "label",
+			lookup:   v1alpha1.LookupTable{Default: &defaultValue},
+			data:     `{"level":2}`,
+			expected: `{"level":2,"label":"unknown"}`,
+		}, {
+			name:    "Miss drops event",
+			key:     "level",
+			lookup:  v1alpha1.LookupTable{DropOnMiss: true, Default: &defaultValue},
+			data:    `{"level":2}`,
+			dropped: true,
+		}, {
+			name:         "Variables",
+			key:          "$level",
+			value:        "$label",
+			vars:         map[string]interface{}{"$level": json.Number("1")},
+			data:         `{}`,
+			expected:     `{}`,
+			expectedVars: map[string]interface{}{"$label": "low"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			vars := storage.New()
+			for k, v := range tc.vars {
+				vars.Set(k, v)
+			}
+			l := &Lookup{}
+			l.SetStorage(vars)
+			op, err := l.New(tc.key, tc.value)
+			if !assert.NoError(t, err) {
+				return
+			}
+			tc.lookup.Table = table
+			if !assert.NoError(t, op.(transformer.Configurable).Configure(v1alpha1.Transform{Lookup: &tc.lookup})) {
+				return
+			}
+
+			data, err := convert.Decode([]byte(tc.data))
+			if !assert.NoError(t, err) {
+				return
+			}
+			result, err := op.Apply(data)
+			if tc.dropped {
+				assert.Equal(t, transformer.ErrDropEvent, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			output, err := convert.Marshal(result)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(output))
+			for k, v := range tc.expectedVars {
+				assert.Equal(t, v, vars.Get(k))
+			}
+		})
+	}
+}
+
+func TestConfigMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lookup")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	defer func(path string) { configmap.MountPath = path }(configmap.MountPath)
+	configmap.MountPath = dir
+	defer func(interval time.Duration) { ReloadInterval = interval }(ReloadInterval)
+	ReloadInterval = 0
+
+	file := configmap.Path("levels", "table.yaml")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+	assert.NoError(t, ioutil.WriteFile(file, []byte("1: high\n2: medium\n"), 0644))
+
+	op, err := (&Lookup{}).New("level", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	lookup := &v1alpha1.LookupTable{
+		Table: map[string]string{"1": "low", "3": "none"},
+		ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "levels"},
+			Key:                  "table.yaml",
+		},
+	}
+	if !assert.NoError(t, op.(transformer.Configurable).Configure(v1alpha1.Transform{Lookup: lookup})) {
+		return
+	}
+
+	apply := func(level string) string {
+		data, err := convert.Decode([]byte(`{"level":` + level + `}`))
+		assert.NoError(t, err)
+		result, err := op.Apply(data)
+		assert.NoError(t, err)
+		output, err := convert.Marshal(result)
+		assert.NoError(t, err)
+		return string(output)
+	}
+
+	// ConfigMap entries override the inline ones
+	assert.Equal(t, `{"level":"high"}`, apply("1"))
+	assert.Equal(t, `{"level":"medium"}`, apply("2"))
+	assert.Equal(t, `{"level":"none"}`, apply("3"))
+
+	// the changed ConfigMap is reloaded
+	assert.NoError(t, ioutil.WriteFile(file, []byte(`{"2": "low"}`), 0644))
+	modTime := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(file, modTime, modTime))
+	assert.Equal(t, `{"level":"low"}`, apply("1"))
+	assert.Equal(t, `{"level":"low"}`, apply("2"))
+
+	// the table is kept if the ConfigMap cannot be reloaded
+	assert.NoError(t, os.Remove(file))
+	assert.Equal(t, `{"level":"low"}`, apply("2"))
+
+	missing := &v1alpha1.LookupTable{
+		ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "missing"},
+			Key:                  "table.yaml",
+		},
+	}
+	assert.Error(t, op.(transformer.Configurable).Configure(v1alpha1.Transform{Lookup: missing}))
+	assert.Error(t, op.(transformer.Configurable).Configure(v1alpha1.Transform{}))
+}
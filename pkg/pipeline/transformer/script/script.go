@@ -0,0 +1,397 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package script
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/expression"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+var (
+	_ transformer.Transformer  = (*Script)(nil)
+	_ transformer.Evaluator    = (*Script)(nil)
+	_ transformer.Configurable = (*Script)(nil)
+)
+
+// Script object implements Transformer interface.
+type Script struct {
+	Function string
+	Source   string
+
+	program          *goja.Program
+	timeout          time.Duration
+	maxCallStackSize int
+	maxResultSize    int64
+	variables        *storage.Storage
+}
+
+// InitStep is used to figure out if this operation should
+// run before main Transformations. For example, Store
+// operation needs to run first to load all Pipeline variables.
+var InitStep bool = false
+
+// operationName is used to identify this transformation.
+var operationName string = "script"
+
+// defaultFunction is called if the function name is not set.
+const defaultFunction = "transform"
+
+// Default limits of the script execution per event.
+const (
+	defaultTimeout          = time.Second
+	defaultMaxCallStackSize = 1024
+	defaultMaxResultSize    = 64 << 20
+)
+
+// valueSize is the size counted for every exported
+// value in addition to the length of its strings.
+const valueSize = 8
+
+// Register adds this transformation to the map which will
+// be used to create Transformation pipeline.
+func Register(m map[string]transformer.Transformer) {
+	m[operationName] = &Script{}
+}
+
+// SetStorage sets a shared Storage with Pipeline variables.
+func (s *Script) SetStorage(storage *storage.Storage) {
+	s.variables = storage
+}
+
+// InitStep returns "true" if this Transformation should run
+// as init step.
+func (s *Script) InitStep() bool {
+	return InitStep
+}
+
+// New returns a new instance of Script object. The key is the name
+// of the function to call, the value is JavaScript source.
+func (s *Script) New(key, value string) (transformer.Transformer, error) {
+	if key == "" {
+		key = defaultFunction
+	}
+	program, err := goja.Compile(key, value, true)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compile script: %w", err)
+	}
+	return &Script{
+		Function: key,
+		Source:   value,
+
+		program:          program,
+		timeout:          defaultTimeout,
+		maxCallStackSize: defaultMaxCallStackSize,
+		maxResultSize:    defaultMaxResultSize,
+		variables:        s.variables,
+	}, nil
+}
+
+// Configure sets the limits of the script execution.
+func (s *Script) Configure(t v1alpha1.Transform) error {
+	l := t.Script
+	if l == nil {
+		return nil
+	}
+	if l.Timeout != nil {
+		if l.Timeout.Duration <= 0 {
+			return fmt.Errorf("script timeout must be positive")
+		}
+		s.timeout = l.Timeout.Duration
+	}
+	if l.MaxCallStackSize < 0 {
+		return fmt.Errorf("script call stack size cannot be negative")
+	}
+	if l.MaxCallStackSize != 0 {
+		s.maxCallStackSize = l.MaxCallStackSize
+	}
+	if l.MaxResultSize != nil {
+		if l.MaxResultSize.Sign() <= 0 {
+			return fmt.Errorf("script result size limit must be positive")
+		}
+		s.maxResultSize = l.MaxResultSize.Value()
+	}
+	return nil
+}
+
+// Apply calls the script function with the input JSON as data.
+func (s *Script) Apply(data interface{}) (interface{}, error) {
+	return s.Evaluate(expression.Data, data, expression.NewActivation(nil, data, s.variables))
+}
+
+// Evaluate is a main method of Transformation that calls the script
+// function with the event object that has "context", "data" and "vars"
+// properties. The function returns the event with the new document
+// and variables, or null to drop the event.
+func (s *Script) Evaluate(document string, data interface{}, activation expression.Activation) (interface{}, error) {
+	output, err := s.run(activation)
+	if err != nil {
+		return data, fmt.Errorf("script %q: %w", s.Function, err)
+	}
+	if output == nil {
+		return data, transformer.ErrDropEvent
+	}
+
+	result, ok := output.(*convert.Object)
+	if !ok {
+		return data, fmt.Errorf("script %q must return an object", s.Function)
+	}
+
+	if vars, ok := result.Get(expression.Vars); ok {
+		values, ok := vars.(*convert.Object)
+		if !ok {
+			return data, fmt.Errorf("script %q returned invalid vars", s.Function)
+		}
+		for _, k := range values.Keys() {
+			v, _ := values.Get(k)
+			s.variables.Set(k, v)
+		}
+	}
+
+	if value, ok := result.Get(document); ok {
+		return value, nil
+	}
+	return data, nil
+}
+
+// run executes the script in a new runtime that has no access to the
+// host, calls the function with the activation and returns its result.
+// Nil means that the function returned null or undefined.
+func (s *Script) run(activation expression.Activation) (interface{}, error) {
+	vm := goja.New()
+	vm.SetMaxCallStackSize(s.maxCallStackSize)
+
+	timer := time.AfterFunc(s.timeout, func() {
+		vm.Interrupt(fmt.Sprintf("execution timeout %s exceeded", s.timeout))
+	})
+	defer timer.Stop()
+
+	if _, err := vm.RunProgram(s.program); err != nil {
+		return nil, s.runError(err)
+	}
+	function, ok := goja.AssertFunction(vm.Get(s.Function))
+	if !ok {
+		return nil, fmt.Errorf("function is not defined")
+	}
+
+	c := newConverter(vm, s.maxResultSize)
+	event := vm.NewObject()
+	for _, key := range []string{expression.Context, expression.Data, expression.Vars} {
+		if err := event.Set(key, c.toValue(activation[key])); err != nil {
+			return nil, err
+		}
+	}
+	result, err := function(goja.Undefined(), event)
+	if err != nil {
+		return nil, s.runError(err)
+	}
+	return c.export(result)
+}
+
+// runError replaces the runtime errors that have no message.
+func (s *Script) runError(err error) error {
+	var overflow *goja.StackOverflowError
+	if errors.As(err, &overflow) {
+		return fmt.Errorf("call stack size %d exceeded", s.maxCallStackSize)
+	}
+	return err
+}
+
+// maxSafeInteger is the largest integer that the
+// runtime stores without converting it to float.
+const maxSafeInteger = 1<<53 - 1
+
+// converter passes JSON trees to the runtime and back. The runtime
+// stores integers above 2^53 as floats, so the original numbers are
+// restored unless the script changes their values.
+type converter struct {
+	vm *goja.Runtime
+	// numbers maps the floats to the numbers they were
+	// converted from, empty if the float is ambiguous.
+	numbers   map[float64]json.Number
+	ancestors map[*goja.Object]bool
+	// size is the remaining size of the exported values.
+	size  int64
+	limit int64
+}
+
+func newConverter(vm *goja.Runtime, limit int64) *converter {
+	return &converter{
+		vm:        vm,
+		numbers:   make(map[float64]json.Number),
+		ancestors: make(map[*goja.Object]bool),
+		size:      limit,
+		limit:     limit,
+	}
+}
+
+// allocate counts the size of the exported value against the limit.
+func (c *converter) allocate(n int) error {
+	c.size -= int64(n + valueSize)
+	if c.size < 0 {
+		return fmt.Errorf("result size limit of %d bytes exceeded", c.limit)
+	}
+	return nil
+}
+
+// toValue converts the JSON tree to the JavaScript value.
+func (c *converter) toValue(value interface{}) goja.Value {
+	switch v := value.(type) {
+	case nil:
+		return goja.Null()
+	case *convert.Object:
+		o := c.vm.NewObject()
+		for _, key := range v.Keys() {
+			item, _ := v.Get(key)
+			_ = o.Set(key, c.toValue(item))
+		}
+		return o
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		o := c.vm.NewObject()
+		for _, key := range keys {
+			_ = o.Set(key, c.toValue(v[key]))
+		}
+		return o
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = c.toValue(item)
+		}
+		return c.vm.NewArray(items...)
+	case json.Number:
+		if i, err := v.Int64(); err == nil && i >= -maxSafeInteger && i <= maxSafeInteger {
+			return c.vm.ToValue(i)
+		}
+		// out of range numbers are converted to infinity
+		f, _ := v.Float64()
+		if n, ok := c.numbers[f]; ok && n != v {
+			c.numbers[f] = ""
+		} else {
+			c.numbers[f] = v
+		}
+		return c.vm.ToValue(f)
+	}
+	return c.vm.ToValue(value)
+}
+
+// export converts the JavaScript value to the JSON tree the way
+// JSON.stringify does: functions and undefined properties are
+// omitted, objects with toJSON method are replaced with its result.
+func (c *converter) export(value goja.Value) (interface{}, error) {
+	if value == nil || goja.IsUndefined(value) || goja.IsNull(value) {
+		return nil, nil
+	}
+	o, ok := value.(*goja.Object)
+	if !ok {
+		v := value.Export()
+		s, _ := v.(string)
+		if err := c.allocate(len(s)); err != nil {
+			return nil, err
+		}
+		switch v := v.(type) {
+		case int64:
+			// integral floats are exported as integers
+			if n := c.numbers[float64(v)]; n != "" {
+				return n, nil
+			}
+			return json.Number(strconv.FormatInt(v, 10)), nil
+		case float64:
+			if n := c.numbers[v]; n != "" {
+				return n, nil
+			}
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, nil
+			}
+			return v, nil
+		default:
+			return v, nil
+		}
+	}
+
+	if toJSON, ok := goja.AssertFunction(o.Get("toJSON")); ok {
+		result, err := toJSON(o)
+		if err != nil {
+			return nil, err
+		}
+		if object, ok := result.(*goja.Object); !ok || object != o {
+			return c.export(result)
+		}
+	}
+
+	if c.ancestors[o] {
+		return nil, fmt.Errorf("cyclic object value")
+	}
+	if err := c.allocate(0); err != nil {
+		return nil, err
+	}
+	c.ancestors[o] = true
+	defer delete(c.ancestors, o)
+
+	if o.ClassName() == "Array" {
+		length := o.Get("length").ToInteger()
+		arr := make([]interface{}, 0, length)
+		for i := int64(0); i < length; i++ {
+			item := o.Get(strconv.FormatInt(i, 10))
+			if _, ok := goja.AssertFunction(item); ok {
+				item = nil
+			}
+			v, err := c.export(item)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	}
+
+	obj := convert.NewObject()
+	for _, key := range o.Keys() {
+		item := o.Get(key)
+		if item == nil || goja.IsUndefined(item) {
+			continue
+		}
+		if _, ok := goja.AssertFunction(item); ok {
+			continue
+		}
+		if err := c.allocate(len(key)); err != nil {
+			return nil, err
+		}
+		v, err := c.export(item)
+		if err != nil {
+			return nil, err
+		}
+		obj.Set(key, v)
+	}
+	return obj, nil
+}
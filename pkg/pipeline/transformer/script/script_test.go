@@ -0,0 +1,176 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package script
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+func TestApply(t *testing.T) {
+	timeout := &metav1.Duration{Duration: 100 * time.Millisecond}
+	size := resource.MustParse("1Ki")
+
+	testCases := []struct {
+		name      string
+		source    string
+		limits    *v1alpha1.ScriptLimits
+		data      string
+		expected  string
+		vars      map[string]interface{}
+		dropped   bool
+		expectErr bool
+		errMsg    string
+	}{
+		{
+			name:     "Keep numbers and key order",
+			source:   `function transform(e) { e.data.copy = e.data.id; e.data.sum = e.data.a + 1; return e; }`,
+			data:     `{"id":9007199254740993,"a":1.5,"b":{"z":1,"y":2}}`,
+			expected: `{"id":9007199254740993,"a":1.5,"b":{"z":1,"y":2},"copy":9007199254740993,"sum":2.5}`,
+		}, {
+			name:     "Set variables",
+			source:   `function transform(e) { e.vars["$count"] = e.data.items.length; return {vars: e.vars}; }`,
+			data:     `{"items":[1,2,3]}`,
+			expected: `{"items":[1,2,3]}`,
+			vars:     map[string]interface{}{"$count": json.Number("3")},
+		}, {
+			name:     "Omit functions and undefined",
+			source:   `function transform(e) { return {data: {f: function() {}, u: undefined, d: new Date(0), a: [undefined]}}; }`,
+			data:     `{}`,
+			expected: `{"d":"1970-01-01T00:00:00.000Z","a":[null]}`,
+		}, {
+			name:    "Drop event",
+			source:  `function transform(e) { return null; }`,
+			data:    `{}`,
+			dropped: true,
+		}, {
+			name:      "Not an object",
+			source:    `function transform(e) { return 1; }`,
+			data:      `{}`,
+			expectErr: true,
+		}, {
+			name:      "Cyclic object",
+			source:    `function transform(e) { e.data.self = e.data; return e; }`,
+			data:      `{}`,
+			expectErr: true,
+		}, {
+			name:      "Execution timeout",
+			source:    `function transform(e) { for (;;) {} }`,
+			limits:    &v1alpha1.ScriptLimits{Timeout: timeout},
+			data:      `{}`,
+			expectErr: true,
+		}, {
+			name:      "Call stack size",
+			source:    `function transform(e) { return transform(e); }`,
+			limits:    &v1alpha1.ScriptLimits{MaxCallStackSize: 10},
+			data:      `{}`,
+			expectErr: true,
+			errMsg:    `script "transform": call stack size 10 exceeded`,
+		}, {
+			name:      "Result size limit",
+			source:    `function transform(e) { e.data.s = "x".repeat(1024); return e; }`,
+			limits:    &v1alpha1.ScriptLimits{MaxResultSize: &size},
+			data:      `{}`,
+			expectErr: true,
+		}, {
+			name:      "Result size limit of items",
+			source:    `function transform(e) { e.data.a = []; for (let i = 0; i < 200; i++) e.data.a.push(i); return e; }`,
+			limits:    &v1alpha1.ScriptLimits{MaxResultSize: &size},
+			data:      `{}`,
+			expectErr: true,
+		}, {
+			name:     "Within result size limit",
+			source:   `function transform(e) { e.data.s = "x".repeat(10); return e; }`,
+			limits:   &v1alpha1.ScriptLimits{MaxResultSize: &size},
+			data:     `{}`,
+			expected: `{"s":"xxxxxxxxxx"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			variables := storage.New()
+			s := &Script{}
+			s.SetStorage(variables)
+			tr, err := s.New("", tc.source)
+			if !assert.NoError(t, err) {
+				return
+			}
+			if !assert.NoError(t, tr.(transformer.Configurable).Configure(v1alpha1.Transform{Script: tc.limits})) {
+				return
+			}
+
+			data, err := convert.Decode([]byte(tc.data))
+			assert.NoError(t, err)
+
+			result, err := tr.Apply(data)
+			switch {
+			case tc.expectErr:
+				assert.Error(t, err)
+				assert.NotEqual(t, transformer.ErrDropEvent, err)
+				if tc.errMsg != "" {
+					assert.EqualError(t, err, tc.errMsg)
+				}
+				return
+			case tc.dropped:
+				assert.Equal(t, transformer.ErrDropEvent, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			output, err := json.Marshal(result)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(output))
+			for k, v := range tc.vars {
+				assert.Equal(t, v, variables.Get(k))
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	s := &Script{}
+	_, err := s.New("", "function transform(e) {")
+	assert.Error(t, err)
+
+	tr, err := s.New("missing", "function transform(e) { return e; }")
+	assert.NoError(t, err)
+	_, err = tr.Apply(convert.NewObject())
+	assert.Error(t, err)
+
+	zero := &metav1.Duration{}
+	assert.Error(t, tr.(transformer.Configurable).Configure(v1alpha1.Transform{
+		Script: &v1alpha1.ScriptLimits{Timeout: zero},
+	}))
+	assert.Error(t, tr.(transformer.Configurable).Configure(v1alpha1.Transform{
+		Script: &v1alpha1.ScriptLimits{MaxCallStackSize: -1},
+	}))
+	zeroSize := resource.MustParse("0")
+	assert.Error(t, tr.(transformer.Configurable).Configure(v1alpha1.Transform{
+		Script: &v1alpha1.ScriptLimits{MaxResultSize: &zeroSize},
+	}))
+}
@@ -0,0 +1,109 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package setstate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/state"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+var (
+	_ transformer.Transformer = (*SetState)(nil)
+	_ transformer.Stateful    = (*SetState)(nil)
+)
+
+// SetState object implements Transformer interface.
+type SetState struct {
+	Key  string
+	Path string
+
+	path      convert.Path
+	state     state.Store
+	variables *storage.Storage
+}
+
+// InitStep is used to figure out if this operation should
+// run before main Transformations. For example, Store
+// operation needs to run first to load all Pipeline variables.
+var InitStep bool = false
+
+// operationName is used to identify this transformation.
+var operationName string = "setState"
+
+// Register adds this transformation to the map which will
+// be used to create Transformation pipeline.
+func Register(m map[string]transformer.Transformer) {
+	m[operationName] = &SetState{}
+}
+
+// SetStorage sets a shared Storage with Pipeline variables.
+func (s *SetState) SetStorage(storage *storage.Storage) {
+	s.variables = storage
+}
+
+// SetState sets the store of the persistent values.
+func (s *SetState) SetState(st state.Store) {
+	s.state = st
+}
+
+// InitStep returns "true" if this Transformation should run
+// as init step.
+func (s *SetState) InitStep() bool {
+	return InitStep
+}
+
+// New returns a new instance of SetState object. The key is
+// the state name where Pipeline variables are replaced with
+// their values, the value is a path or a variable to store.
+func (s *SetState) New(key, value string) (transformer.Transformer, error) {
+	if key == "" || value == "" {
+		return nil, fmt.Errorf("state name and path must be set")
+	}
+	path, err := convert.ParseVariableOrPath(value)
+	if err != nil {
+		return nil, err
+	}
+	return &SetState{
+		Key:  key,
+		Path: value,
+
+		path:      path,
+		state:     s.state,
+		variables: s.variables,
+	}, nil
+}
+
+// Apply is a main method of Transformation that stores
+// the value. Missing values do not change the state.
+func (s *SetState) Apply(data interface{}) (interface{}, error) {
+	var value interface{}
+	if strings.HasPrefix(s.Path, "$") {
+		value = s.variables.Get(s.Path)
+	} else {
+		value = s.path.Read(data)
+	}
+	if value == nil {
+		return data, nil
+	}
+
+	return data, s.state.Set(s.variables.Expand(s.Key), value)
+}
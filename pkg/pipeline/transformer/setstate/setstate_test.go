@@ -0,0 +1,123 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package setstate
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/state"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+)
+
+// failingStore fails all operations.
+type failingStore struct {
+	state.Store
+}
+
+func (failingStore) Set(string, interface{}) error {
+	return errors.New("store is unavailable")
+}
+
+func TestApply(t *testing.T) {
+	testCases := []struct {
+		name     string
+		key      string
+		value    string
+		data     string
+		expected map[string]string
+	}{
+		{
+			name:     "Store path value",
+			key:      "last-$customer",
+			value:    "order",
+			data:     `{"order":{"id":9007199254740993,"note":"<b>"}}`,
+			expected: map[string]string{"last-foo": `{"id":9007199254740993,"note":"<b>"}`},
+		}, {
+			name:     "Store variable",
+			key:      "customer",
+			value:    "$customer",
+			data:     `{}`,
+			expected: map[string]string{"customer": `"foo"`},
+		}, {
+			name:     "Missing value is not stored",
+			key:      "last",
+			value:    "order",
+			data:     `{}`,
+			expected: map[string]string{"last": `null`},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			vars := storage.New()
+			vars.Set("$customer", "foo")
+			store := state.NewMemory()
+			s := &SetState{}
+			s.SetStorage(vars)
+			s.SetState(store)
+			op, err := s.New(tc.key, tc.value)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			data, err := convert.Decode([]byte(tc.data))
+			if !assert.NoError(t, err) {
+				return
+			}
+			result, err := op.Apply(data)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, data, result)
+
+			for key, expected := range tc.expected {
+				value, err := store.Get(key)
+				assert.NoError(t, err)
+				stored, err := convert.Marshal(value)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, string(stored))
+			}
+		})
+	}
+
+	// store errors fail the operation
+	s := &SetState{}
+	s.SetStorage(storage.New())
+	s.SetState(failingStore{})
+	op, err := s.New("count", "count")
+	if !assert.NoError(t, err) {
+		return
+	}
+	data := convert.NewObject()
+	data.Set("count", json.Number("1"))
+	_, err = op.Apply(data)
+	assert.Error(t, err)
+}
+
+func TestNew(t *testing.T) {
+	_, err := (&SetState{}).New("", "count")
+	assert.Error(t, err)
+	_, err = (&SetState{}).New("count", "")
+	assert.Error(t, err)
+	_, err = (&SetState{}).New("count", "count..total")
+	assert.Error(t, err)
+}
@@ -18,6 +18,7 @@ package shift
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
 
 	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
@@ -33,6 +34,8 @@ type Shift struct {
 	NewPath string
 	Value   string
 
+	path      convert.Path
+	newPath   convert.Path
 	variables *storage.Storage
 }
 
@@ -63,48 +66,45 @@ func (s *Shift) InitStep() bool {
 	return InitStep
 }
 
-// New returns a new instance of Shift object.
-func (s *Shift) New(key, value string) transformer.Transformer {
-	// doubtful scheme, review needed
+// New returns a new instance of Shift object. The key is
+// the old and the new paths separated by colon.
+func (s *Shift) New(key, value string) (transformer.Transformer, error) {
 	keys := strings.Split(key, delimeter)
 	if len(keys) != 2 {
-		return nil
+		return nil, fmt.Errorf("key %q must be the old and the new path separated by %q", key, delimeter)
+	}
+	path, err := convert.ParsePath(keys[0])
+	if err != nil {
+		return nil, err
+	}
+	newPath, err := convert.ParsePath(keys[1])
+	if err != nil {
+		return nil, err
 	}
 	return &Shift{
 		Path:    keys[0],
 		NewPath: keys[1],
 		Value:   value,
 
+		path:      path,
+		newPath:   newPath,
 		variables: s.variables,
-	}
+	}, nil
 }
 
 // Apply is a main method of Transformation that moves existing
 // values to a new locations.
-func (s *Shift) Apply(data []byte) ([]byte, error) {
-	oldPath := convert.SliceToMap(strings.Split(s.Path, "."), "")
-
-	var event interface{}
-	if err := json.Unmarshal(data, &event); err != nil {
-		return data, err
-	}
-
-	newEvent, value := extractValue(event, oldPath)
+func (s *Shift) Apply(data interface{}) (interface{}, error) {
+	// extracting the value modifies the document,
+	// it must be compared before that
 	if s.Value != "" {
-		if !equal(s.retrieveInterface(s.Value), value) {
+		if !equal(s.retrieveInterface(s.Value), s.path.Read(data)) {
 			return data, nil
 		}
 	}
 
-	newPath := convert.SliceToMap(strings.Split(s.NewPath, "."), value)
-
-	result := convert.MergeJSONWithMap(newEvent, newPath)
-	output, err := json.Marshal(result)
-	if err != nil {
-		return data, err
-	}
-
-	return output, nil
+	data, value := s.path.Extract(data)
+	return s.newPath.Merge(data, value), nil
 }
 
 func (s *Shift) retrieveInterface(key string) interface{} {
@@ -114,71 +114,6 @@ func (s *Shift) retrieveInterface(key string) interface{} {
 	return key
 }
 
-func extractValue(source interface{}, path map[string]interface{}) (map[string]interface{}, interface{}) {
-	var ok bool
-	var result interface{}
-	sourceMap := make(map[string]interface{})
-	for k, v := range path {
-		switch value := v.(type) {
-		case float64, bool, string:
-			sourceMap, ok = source.(map[string]interface{})
-			if !ok {
-				break
-			}
-			result = sourceMap[k]
-			delete(sourceMap, k)
-		case []interface{}:
-			if k != "" {
-				// array is inside the object
-				// {"foo":[{},{},{}]}
-				sourceMap, ok = source.(map[string]interface{})
-				if !ok {
-					break
-				}
-				source, ok = sourceMap[k]
-				if !ok {
-					break
-				}
-			}
-			// array is a root object
-			// [{},{},{}]
-			sourceArr, ok := source.([]interface{})
-			if !ok {
-				break
-			}
-
-			index := len(value) - 1
-			if index >= len(sourceArr) {
-				break
-			}
-
-			m, ok := value[index].(map[string]interface{})
-			if ok {
-				sourceArr[index], result = extractValue(sourceArr[index].(map[string]interface{}), m)
-				sourceMap[k] = sourceArr
-				break
-			}
-			result = sourceArr[index]
-			sourceMap[k] = sourceArr[:index]
-			if len(sourceArr) > index {
-				sourceMap[k] = append(sourceArr[:index], sourceArr[index+1:]...)
-			}
-		case map[string]interface{}:
-			sourceMap, ok = source.(map[string]interface{})
-			if !ok {
-				break
-			}
-			if _, ok := sourceMap[k]; !ok {
-				break
-			}
-			sourceMap[k], result = extractValue(sourceMap[k], value)
-		case nil:
-			sourceMap[k] = nil
-		}
-	}
-	return sourceMap, result
-}
-
 func equal(a, b interface{}) bool {
 	switch value := b.(type) {
 	case string:
@@ -191,11 +126,8 @@ func equal(a, b interface{}) bool {
 		if ok && v == value {
 			return true
 		}
-	case float64:
-		v, ok := a.(float64)
-		if ok && v == value {
-			return true
-		}
+	case json.Number, float64:
+		return convert.NumberEqual(a, value)
 	}
 	return false
 }
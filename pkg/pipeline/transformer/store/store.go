@@ -17,9 +17,6 @@ limitations under the License.
 package store
 
 import (
-	"encoding/json"
-	"strings"
-
 	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
 	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
 	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
@@ -32,6 +29,7 @@ type Store struct {
 	Path  string
 	Value string
 
+	value     convert.Path
 	variables *storage.Storage
 }
 
@@ -61,76 +59,26 @@ func (s *Store) InitStep() bool {
 }
 
 // New returns a new instance of Store object.
-func (s *Store) New(key, value string) transformer.Transformer {
+func (s *Store) New(key, value string) (transformer.Transformer, error) {
+	path, err := convert.ParsePath(value)
+	if err != nil {
+		return nil, err
+	}
 	return &Store{
 		Path:  key,
 		Value: value,
 
+		value:     path,
 		variables: s.variables,
-	}
+	}, nil
 }
 
 // Apply is a main method of Transformation that stores JSON values
 // into variables that can be used by other Transformations in a pipeline.
-func (s *Store) Apply(data []byte) ([]byte, error) {
-	path := convert.SliceToMap(strings.Split(s.Value, "."), "")
-
-	var event interface{}
-	if err := json.Unmarshal(data, &event); err != nil {
-		return data, err
-	}
-
-	value := readValue(event, path)
+func (s *Store) Apply(data interface{}) (interface{}, error) {
+	// the variable must not change with the document
+	value := convert.Copy(s.value.Read(data))
 	s.variables.Set(s.Path, value)
 
 	return data, nil
 }
-
-func readValue(source interface{}, path map[string]interface{}) interface{} {
-	var result interface{}
-	for k, v := range path {
-		switch value := v.(type) {
-		case float64, bool, string:
-			sourceMap, ok := source.(map[string]interface{})
-			if !ok {
-				break
-			}
-			result = sourceMap[k]
-		case []interface{}:
-			if k != "" {
-				// array is inside the object
-				// {"foo":[{},{},{}]}
-				sourceMap, ok := source.(map[string]interface{})
-				if !ok {
-					break
-				}
-				source, ok = sourceMap[k]
-				if !ok {
-					break
-				}
-			}
-			// array is a root object
-			// [{},{},{}]
-			sourceArr, ok := source.([]interface{})
-			if !ok {
-				break
-			}
-
-			index := len(value) - 1
-			if index >= len(sourceArr) {
-				break
-			}
-			result = readValue(sourceArr[index], value[index].(map[string]interface{}))
-		case map[string]interface{}:
-			sourceMap, ok := source.(map[string]interface{})
-			if !ok {
-				break
-			}
-			if _, ok := sourceMap[k]; !ok {
-				break
-			}
-			result = readValue(sourceMap[k], value)
-		}
-	}
-	return result
-}
@@ -17,14 +17,54 @@ limitations under the License.
 package transformer
 
 import (
+	"context"
+	"errors"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/expression"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/state"
 	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
 )
 
+// ErrDropEvent is returned by Transformers when the event
+// must be acknowledged without producing a new one.
+var ErrDropEvent = errors.New("event dropped")
+
 // Transformer is an interface that contains common methods
-// to work with JSON data.
+// to work with JSON data. Apply receives the document decoded
+// into a JSON tree of maps, slices and scalars that is shared by
+// all operations of the event. It may modify the tree in place
+// and returns its root that can be a new value. The tree must not
+// be modified if an error is returned.
 type Transformer interface {
-	New(string, string) Transformer
-	Apply([]byte) ([]byte, error)
+	New(string, string) (Transformer, error)
+	Apply(interface{}) (interface{}, error)
 	SetStorage(*storage.Storage)
 	InitStep() bool
 }
+
+// Evaluator is implemented by Transformers that need the whole
+// event and Pipeline variables to modify the JSON data. The first
+// argument is the name of the transformed document, "context" or "data".
+type Evaluator interface {
+	Evaluate(string, interface{}, expression.Activation) (interface{}, error)
+}
+
+// ContextApplier is implemented by Transformers that make requests
+// to external services. ApplyContext is called instead of Apply with
+// the context of the event, so that the requests are canceled with it.
+type ContextApplier interface {
+	ApplyContext(context.Context, interface{}) (interface{}, error)
+}
+
+// Configurable is implemented by Transformers that take
+// operation specific parameters from the Transform spec.
+type Configurable interface {
+	Configure(v1alpha1.Transform) error
+}
+
+// Stateful is implemented by Transformers that keep
+// values across events in the State store.
+type Stateful interface {
+	SetState(state.Store)
+}
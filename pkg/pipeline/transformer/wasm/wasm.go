@@ -0,0 +1,311 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wasm
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/storage"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+var (
+	_ transformer.Transformer    = (*Wasm)(nil)
+	_ transformer.Configurable   = (*Wasm)(nil)
+	_ transformer.ContextApplier = (*Wasm)(nil)
+)
+
+// Wasm object implements Transformer interface.
+type Wasm struct {
+	Function string
+	Module   string
+
+	module           []byte
+	timeout          time.Duration
+	memoryLimitPages uint32
+	poolSize         int
+
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	// pool contains module instances, nil items
+	// are instantiated on demand.
+	pool chan api.Module
+
+	variables *storage.Storage
+}
+
+// InitStep is used to figure out if this operation should
+// run before main Transformations. For example, Store
+// operation needs to run first to load all Pipeline variables.
+var InitStep bool = false
+
+// operationName is used to identify this transformation.
+var operationName string = "wasm"
+
+// defaultFunction is called if the function name is not set.
+const defaultFunction = "transform"
+
+// magic is the beginning of a binary WASM module.
+const magic = "\x00asm"
+
+// Functions that modules must export to exchange data with the host.
+const (
+	allocateFunction   = "allocate"
+	deallocateFunction = "deallocate"
+)
+
+// pageSize is the size of the module memory page.
+const pageSize = 64 << 10
+
+// maxMemoryPages is the memory limit of 32-bit modules.
+const maxMemoryPages = 1 << 16
+
+// Default limits of the module execution.
+const (
+	defaultTimeout          = time.Second
+	defaultMemoryLimitPages = 256
+	defaultPoolSize         = 4
+)
+
+// Register adds this transformation to the map which will
+// be used to create Transformation pipeline.
+func Register(m map[string]transformer.Transformer) {
+	m[operationName] = &Wasm{}
+}
+
+// SetStorage sets a shared Storage with Pipeline variables.
+func (w *Wasm) SetStorage(storage *storage.Storage) {
+	w.variables = storage
+}
+
+// InitStep returns "true" if this Transformation should run
+// as init step.
+func (w *Wasm) InitStep() bool {
+	return InitStep
+}
+
+// New returns a new instance of Wasm object. The key is the name of the
+// exported function, the value is either a binary module or the path
+// to the module file. The module is loaded when the operation is
+// configured.
+func (w *Wasm) New(key, value string) (transformer.Transformer, error) {
+	if key == "" {
+		key = defaultFunction
+	}
+	wasm := &Wasm{
+		Function: key,
+		Module:   value,
+
+		module:           []byte(value),
+		timeout:          defaultTimeout,
+		memoryLimitPages: defaultMemoryLimitPages,
+		poolSize:         defaultPoolSize,
+		variables:        w.variables,
+	}
+	if strings.HasPrefix(value, magic) {
+		wasm.Module = "<inline>"
+	} else {
+		module, err := ioutil.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read WASM module: %w", err)
+		}
+		wasm.module = module
+	}
+	return wasm, nil
+}
+
+// Configure sets the limits of the module execution and loads the module.
+func (w *Wasm) Configure(t v1alpha1.Transform) error {
+	if l := t.Wasm; l != nil {
+		if l.Timeout != nil {
+			if l.Timeout.Duration <= 0 {
+				return fmt.Errorf("WASM timeout must be positive")
+			}
+			w.timeout = l.Timeout.Duration
+		}
+		if l.MaxMemory != nil {
+			pages := (l.MaxMemory.Value() + pageSize - 1) / pageSize
+			if pages <= 0 || pages > maxMemoryPages {
+				return fmt.Errorf("WASM memory limit must be between 64Ki and 4Gi")
+			}
+			w.memoryLimitPages = uint32(pages)
+		}
+		if l.PoolSize < 0 {
+			return fmt.Errorf("WASM pool size cannot be negative")
+		}
+		if l.PoolSize != 0 {
+			w.poolSize = l.PoolSize
+		}
+	}
+	if err := w.load(); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return nil
+}
+
+// load compiles the module and fills the pool with its instances.
+func (w *Wasm) load() error {
+	ctx := context.Background()
+	w.runtime = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(w.memoryLimitPages).
+		WithCloseOnContextDone(true))
+
+	// Modules built for WASI get no filesystem, network or real clock.
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, w.runtime); err != nil {
+		return fmt.Errorf("cannot instantiate WASI: %w", err)
+	}
+
+	var err error
+	if w.compiled, err = w.runtime.CompileModule(ctx, w.module); err != nil {
+		return fmt.Errorf("cannot compile WASM module %q: %w", w.Module, err)
+	}
+
+	w.pool = make(chan api.Module, w.poolSize)
+	for i := 0; i < w.poolSize; i++ {
+		instance, err := w.instantiate(ctx)
+		if err != nil {
+			return err
+		}
+		w.pool <- instance
+	}
+	return nil
+}
+
+// Close releases the runtime with the compiled module and its instances.
+func (w *Wasm) Close() error {
+	if w.runtime == nil {
+		return nil
+	}
+	err := w.runtime.Close(context.Background())
+	w.runtime, w.compiled, w.pool = nil, nil, nil
+	return err
+}
+
+func (w *Wasm) instantiate(ctx context.Context) (api.Module, error) {
+	instance, err := w.runtime.InstantiateModule(ctx, w.compiled,
+		wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot instantiate WASM module %q: %w", w.Module, err)
+	}
+	for _, name := range []string{allocateFunction, w.Function} {
+		if instance.ExportedFunction(name) == nil {
+			return nil, fmt.Errorf("WASM module %q does not export %q function", w.Module, name)
+		}
+	}
+	if instance.Memory() == nil {
+		return nil, fmt.Errorf("WASM module %q does not export memory", w.Module)
+	}
+	return instance, nil
+}
+
+// Apply calls the module function without the event context.
+func (w *Wasm) Apply(data interface{}) (interface{}, error) {
+	return w.ApplyContext(context.Background(), data)
+}
+
+// ApplyContext is a main method of Transformation that passes JSON to the
+// module function and returns its result. The function accepts the pointer
+// and the length of the input and returns the pointer and the length of
+// the result packed into i64. Empty result drops the event. The call is
+// interrupted when the event context is done.
+func (w *Wasm) ApplyContext(ctx context.Context, data interface{}) (interface{}, error) {
+	if w.pool == nil {
+		return data, fmt.Errorf("WASM module %q is not loaded", w.Module)
+	}
+	input, err := convert.Marshal(data)
+	if err != nil {
+		return data, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	instance := <-w.pool
+	if instance == nil {
+		if instance, err = w.instantiate(ctx); err != nil {
+			w.pool <- nil
+			return data, err
+		}
+	}
+
+	output, err := w.call(ctx, instance, input)
+	if err != nil {
+		// the instance state is unknown after a trap or timeout
+		_ = instance.Close(context.Background())
+		w.pool <- nil
+		return data, fmt.Errorf("WASM function %q: %w", w.Function, err)
+	}
+	w.pool <- instance
+
+	if len(output) == 0 {
+		return data, transformer.ErrDropEvent
+	}
+	result, err := convert.Decode(output)
+	if err != nil {
+		return data, fmt.Errorf("WASM function %q returned invalid JSON", w.Function)
+	}
+	return result, nil
+}
+
+func (w *Wasm) call(ctx context.Context, instance api.Module, data []byte) ([]byte, error) {
+	memory := instance.Memory()
+
+	res, err := instance.ExportedFunction(allocateFunction).Call(ctx, uint64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(res[0])
+	if !memory.Write(ptr, data) {
+		return nil, fmt.Errorf("allocated memory is out of range")
+	}
+
+	res, err = instance.ExportedFunction(w.Function).Call(ctx, uint64(ptr), uint64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	resultPtr, resultLen := uint32(res[0]>>32), uint32(res[0])
+
+	result, ok := memory.Read(resultPtr, resultLen)
+	if !ok {
+		return nil, fmt.Errorf("result is out of memory range")
+	}
+	output := make([]byte, len(result))
+	copy(output, result)
+
+	if deallocate := instance.ExportedFunction(deallocateFunction); deallocate != nil {
+		if _, err := deallocate.Call(ctx, uint64(ptr), uint64(len(data))); err != nil {
+			return nil, err
+		}
+		if resultLen != 0 && resultPtr != ptr {
+			if _, err := deallocate.Call(ctx, uint64(resultPtr), uint64(resultLen)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return output, nil
+}
@@ -0,0 +1,182 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wasm
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/transformer"
+)
+
+// testModule is assembled from pkg/pipeline/testdata/upper.wat.
+const testModule = "../../testdata/upper.wasm"
+
+func newWasm(function, module string, limits *v1alpha1.WasmLimits) (*Wasm, error) {
+	w, err := (&Wasm{}).New(function, module)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.(transformer.Configurable).Configure(v1alpha1.Transform{Wasm: limits}); err != nil {
+		return nil, err
+	}
+	return w.(*Wasm), nil
+}
+
+func TestApply(t *testing.T) {
+	module, err := ioutil.ReadFile(testModule)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	timeout := &metav1.Duration{Duration: 100 * time.Millisecond}
+	memory := resource.MustParse("256Mi")
+
+	testCases := []struct {
+		name      string
+		function  string
+		limits    *v1alpha1.WasmLimits
+		data      string
+		expected  string
+		dropped   bool
+		errorText string
+	}{
+		{
+			name:     "Transform data",
+			data:     `{"foo":"bar"}`,
+			expected: `{"FOO":"BAR"}`,
+		}, {
+			name:     "Drop event",
+			function: "drop",
+			data:     `{}`,
+			dropped:  true,
+		}, {
+			name:      "Invalid result",
+			data:      `true`,
+			errorText: "invalid JSON",
+		}, {
+			name:      "Trap",
+			function:  "grow",
+			data:      `{}`,
+			errorText: "unreachable",
+		}, {
+			name:     "Memory limit",
+			function: "grow",
+			limits:   &v1alpha1.WasmLimits{MaxMemory: &memory},
+			data:     `{}`,
+			dropped:  true,
+		}, {
+			name:      "Execution timeout",
+			function:  "loop",
+			limits:    &v1alpha1.WasmLimits{Timeout: timeout, PoolSize: 2},
+			data:      `{}`,
+			errorText: "deadline exceeded",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := newWasm(tc.function, string(module), tc.limits)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer w.Close()
+
+			// failed instances are replaced, the pool serves every call
+			for i := 0; i < w.poolSize+1; i++ {
+				data, err := convert.Decode([]byte(tc.data))
+				if !assert.NoError(t, err) {
+					return
+				}
+				result, err := w.Apply(data)
+				switch {
+				case tc.errorText != "":
+					if assert.Error(t, err) {
+						assert.Contains(t, err.Error(), tc.errorText)
+					}
+					assert.Equal(t, data, result)
+				case tc.dropped:
+					assert.Equal(t, transformer.ErrDropEvent, err)
+				default:
+					if !assert.NoError(t, err) {
+						return
+					}
+					output, err := convert.Marshal(result)
+					assert.NoError(t, err)
+					assert.Equal(t, tc.expected, string(output))
+				}
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	module, err := ioutil.ReadFile(testModule)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	w, err := newWasm("", testModule, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, defaultFunction, w.Function)
+		assert.Equal(t, testModule, w.Module)
+		assert.NoError(t, w.Close())
+	}
+	w, err = newWasm("", string(module), nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "<inline>", w.Module)
+		assert.NoError(t, w.Close())
+	}
+
+	_, err = newWasm("missing", string(module), nil)
+	assert.Error(t, err)
+	_, err = newWasm("", "missing.wasm", nil)
+	assert.Error(t, err)
+	_, err = newWasm("", magic+"invalid", nil)
+	assert.Error(t, err)
+
+	zero := &metav1.Duration{}
+	tooLarge := resource.MustParse("5Gi")
+	for _, limits := range []*v1alpha1.WasmLimits{
+		{Timeout: zero},
+		{MaxMemory: &tooLarge},
+		{PoolSize: -1},
+	} {
+		_, err = newWasm("", string(module), limits)
+		assert.Error(t, err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	w, err := newWasm("", testModule, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, w.Close())
+	assert.NoError(t, w.Close())
+
+	_, err = w.ApplyContext(context.Background(), convert.NewObject())
+	assert.Error(t, err)
+}
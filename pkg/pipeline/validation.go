@@ -0,0 +1,145 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"knative.dev/pkg/logging"
+
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/configmap"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/convert"
+)
+
+// validationErrorExtension is a CE extension that contains
+// JSON Schema validation error.
+const validationErrorExtension = "validationerror"
+
+// validator checks CE Data against JSON Schemas.
+type validator struct {
+	input    *jsonschema.Schema
+	output   *jsonschema.Schema
+	outputID string
+	policy   string
+}
+
+// Validation loads JSON Schemas of incoming and transformed CE Data.
+func Validation(v *v1alpha1.Validation) Option {
+	return func(h *Handler) error {
+		if v == nil {
+			return nil
+		}
+
+		val := &validator{
+			policy: v.Policy,
+		}
+		switch val.policy {
+		case "":
+			val.policy = v1alpha1.ValidationReject
+		case v1alpha1.ValidationReject, v1alpha1.ValidationDeadLetter, v1alpha1.ValidationAnnotate:
+		default:
+			return fmt.Errorf("validation policy %q is not valid", v.Policy)
+		}
+
+		var err error
+		if v.Input != nil {
+			if val.input, _, err = compileSchema("input.json", v.Input); err != nil {
+				return fmt.Errorf("input schema: %w", err)
+			}
+		}
+		if v.Output != nil {
+			if val.output, val.outputID, err = compileSchema("output.json", v.Output); err != nil {
+				return fmt.Errorf("output schema: %w", err)
+			}
+		}
+
+		h.validator = val
+		return nil
+	}
+}
+
+// compileSchema loads JSON Schema document and returns compiled
+// schema with its "$id".
+func compileSchema(url string, s *v1alpha1.JSONSchema) (*jsonschema.Schema, string, error) {
+	document := []byte(s.Inline)
+	if s.ConfigMapKeyRef != nil {
+		var err error
+		if document, err = configmap.Read(*s.ConfigMapKeyRef); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var meta struct {
+		ID string `json:"$id"`
+	}
+	if err := json.Unmarshal(document, &meta); err != nil {
+		return nil, "", fmt.Errorf("cannot decode schema: %w", err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(url, bytes.NewReader(document)); err != nil {
+		return nil, "", err
+	}
+	schema, err := compiler.Compile(url)
+	if err != nil {
+		return nil, "", err
+	}
+	return schema, meta.ID, nil
+}
+
+// validate checks the JSON tree against the schema. Nil schema
+// accepts any data.
+func validate(schema *jsonschema.Schema, tree interface{}) error {
+	if schema == nil {
+		return nil
+	}
+	// the validator walks maps, not Objects
+	return schema.Validate(convert.Plain(tree))
+}
+
+// enforce applies validation policy to the event that does not
+// match the schema. Returned error means that the event must not
+// be processed further.
+func (v *validator) enforce(ctx context.Context, validationErr error, event *cloudevents.Event) error {
+	if validationErr == nil {
+		return nil
+	}
+	err := fmt.Errorf("CE data does not match schema: %w", validationErr)
+	logging.FromContext(ctx).Info(err)
+
+	switch v.policy {
+	case v1alpha1.ValidationAnnotate:
+		return event.Context.SetExtension(validationErrorExtension, err.Error())
+	case v1alpha1.ValidationDeadLetter:
+		deadLetterEvent := event.Clone()
+		if err := deadLetterEvent.Context.SetExtension(validationErrorExtension, err.Error()); err != nil {
+			return err
+		}
+		return &deadLetterError{
+			event: deadLetterEvent,
+			err:   err,
+		}
+	}
+	return &rejectError{err: err}
+}
@@ -20,16 +20,27 @@ import (
 	"context"
 
 	"github.com/kelseyhightower/envconfig"
-
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+
+	kubeclient "knative.dev/pkg/client/injection/kube/client"
+	serviceaccountinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/serviceaccount"
+	roleinformer "knative.dev/pkg/client/injection/kube/informers/rbac/v1/role"
+	rolebindinginformer "knative.dev/pkg/client/injection/kube/informers/rbac/v1/rolebinding"
 	"knative.dev/pkg/configmap"
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
+	"knative.dev/pkg/metrics"
 	"knative.dev/pkg/resolver"
+	tracingconfig "knative.dev/pkg/tracing/config"
 	"knative.dev/pkg/tracker"
 	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
 	servingv1client "knative.dev/serving/pkg/client/injection/client"
 	knsvcinformer "knative.dev/serving/pkg/client/injection/informers/serving/v1/service"
 
+	"github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
 	transformationinformer "github.com/triggermesh/bumblebee/pkg/client/generated/injection/informers/transformation/v1alpha1/transformation"
 	transformationreconciler "github.com/triggermesh/bumblebee/pkg/client/generated/injection/reconciler/transformation/v1alpha1/transformation"
 )
@@ -47,10 +58,22 @@ func NewController(
 
 	transformationInformer := transformationinformer.Get(ctx)
 	knsvcInformer := knsvcinformer.Get(ctx)
+	serviceAccountInformer := serviceaccountinformer.Get(ctx)
+	roleInformer := roleinformer.Get(ctx)
+	roleBindingInformer := rolebindinginformer.Get(ctx)
+
+	kubeClient := kubeclient.Get(ctx)
 
 	r := &Reconciler{
 		servingClientSet: servingv1client.Get(ctx),
 		knServiceLister:  knsvcInformer.Lister(),
+
+		serviceAccountLister: serviceAccountInformer.Lister(),
+		roleLister:           roleInformer.Lister(),
+		roleBindingLister:    roleBindingInformer.Lister(),
+		kubeClientSet:        kubeClient,
+		restMapper:           restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(kubeClient.Discovery())),
+		observability:        &observabilityConfig{},
 	}
 
 	env := &envConfig{}
@@ -82,5 +105,31 @@ func NewController(
 		),
 	))
 
+	// Adapter RBAC objects are owned by the Transformation.
+	ownedHandler := cache.FilteringResourceEventHandler{
+		FilterFunc: controller.FilterControllerGK(v1alpha1.Kind("Transformation")),
+		Handler:    controller.HandleAll(impl.EnqueueControllerOf),
+	}
+	serviceAccountInformer.Informer().AddEventHandler(ownedHandler)
+	roleInformer.Informer().AddEventHandler(ownedHandler)
+	roleBindingInformer.Informer().AddEventHandler(ownedHandler)
+
+	// Adapters are updated when their observability configuration changes.
+	updateMetrics := r.observability.updateFromMetricsConfigMap(logger)
+	cmw.Watch(metrics.ConfigMapName(), func(cm *corev1.ConfigMap) {
+		updateMetrics(cm)
+		impl.GlobalResync(transformationInformer.Informer())
+	})
+	updateLogging := r.observability.updateFromLoggingConfigMap(logger)
+	cmw.Watch(logging.ConfigMapName(), func(cm *corev1.ConfigMap) {
+		updateLogging(cm)
+		impl.GlobalResync(transformationInformer.Informer())
+	})
+	updateTracing := r.observability.updateFromTracingConfigMap(logger)
+	cmw.Watch(tracingconfig.ConfigName, func(cm *corev1.ConfigMap) {
+		updateTracing(cm)
+		impl.GlobalResync(transformationInformer.Informer())
+	})
+
 	return impl
 }
@@ -0,0 +1,129 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"sync"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/metrics"
+	tracingconfig "knative.dev/pkg/tracing/config"
+)
+
+// metricsComponent is the component of the adapter metrics.
+const metricsComponent = "transformation"
+
+// observabilityConfig holds the observability configuration of the
+// adapters, derived from the ConfigMaps the controller watches.
+type observabilityConfig struct {
+	mu sync.RWMutex
+	// metrics are the JSON encoded metrics exporter options.
+	metrics string
+	// tracing is the JSON encoded tracing configuration.
+	tracing string
+	// logging is the JSON encoded logging configuration.
+	logging string
+}
+
+// updateFromMetricsConfigMap is a configmap.Watcher observer
+// of the config-observability ConfigMap.
+func (c *observabilityConfig) updateFromMetricsConfigMap(logger *zap.SugaredLogger) func(*corev1.ConfigMap) {
+	return func(cm *corev1.ConfigMap) {
+		opts, err := metrics.OptionsToJSON(&metrics.ExporterOptions{
+			Domain:    metrics.Domain(),
+			Component: metricsComponent,
+			ConfigMap: cm.Data,
+		})
+		if err != nil {
+			logger.Errorw("Cannot encode adapter metrics config", zap.Error(err))
+			return
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.metrics = opts
+	}
+}
+
+// updateFromTracingConfigMap is a configmap.Watcher observer
+// of the config-tracing ConfigMap.
+func (c *observabilityConfig) updateFromTracingConfigMap(logger *zap.SugaredLogger) func(*corev1.ConfigMap) {
+	return func(cm *corev1.ConfigMap) {
+		cfg, err := tracingconfig.NewTracingConfigFromConfigMap(cm)
+		if err != nil {
+			logger.Errorw("Cannot parse adapter tracing config", zap.Error(err))
+			return
+		}
+		cfgJSON, err := tracingconfig.TracingConfigToJSON(cfg)
+		if err != nil {
+			logger.Errorw("Cannot encode adapter tracing config", zap.Error(err))
+			return
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.tracing = cfgJSON
+	}
+}
+
+// updateFromLoggingConfigMap is a configmap.Watcher observer
+// of the config-logging ConfigMap.
+func (c *observabilityConfig) updateFromLoggingConfigMap(logger *zap.SugaredLogger) func(*corev1.ConfigMap) {
+	return func(cm *corev1.ConfigMap) {
+		// the logger config and the levels of all the components
+		data := make(map[string]string, len(cm.Data))
+		for k, v := range cm.Data {
+			if k != configmap.ExampleKey {
+				data[k] = v
+			}
+		}
+		cfgJSON, err := json.Marshal(data)
+		if err != nil {
+			logger.Errorw("Cannot encode adapter logging config", zap.Error(err))
+			return
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.logging = string(cfgJSON)
+	}
+}
+
+// metricsConfig returns the metrics exporter options of the adapters.
+func (c *observabilityConfig) metricsConfig() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.metrics
+}
+
+// tracingConfig returns the tracing configuration of the adapters.
+func (c *observabilityConfig) tracingConfig() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tracing
+}
+
+// loggingConfig returns the logging configuration of the adapters.
+func (c *observabilityConfig) loggingConfig() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.logging
+}
@@ -0,0 +1,233 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"knative.dev/pkg/kmeta"
+	"knative.dev/pkg/logging"
+
+	transformationv1alpha1 "github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
+	"github.com/triggermesh/bumblebee/pkg/reconciler/controller/resources"
+)
+
+// notOwnedError reports an adapter RBAC object that
+// exists but is not controlled by the Transformation.
+type notOwnedError struct {
+	kind string
+	name string
+}
+
+func (e *notOwnedError) Error() string {
+	return fmt.Sprintf("%s %q is not owned by the Transformation", e.kind, e.name)
+}
+
+// reconcileRBAC provisions the ServiceAccount, the Role and the RoleBinding that allow
+// the adapter to read the objects referenced in "k8slookup" operations. It returns
+// the name of the ServiceAccount, empty if the Transformation does not need one.
+func (r *Reconciler) reconcileRBAC(ctx context.Context, trn *transformationv1alpha1.Transformation) (string, error) {
+	rules, err := r.lookupRules(&trn.Spec)
+	if err != nil {
+		return "", err
+	}
+
+	logger := logging.FromContext(ctx)
+	name := kmeta.ChildName(trn.Name, "-adapter")
+
+	if len(rules) == 0 {
+		return "", r.deleteRBAC(ctx, trn, name)
+	}
+
+	expectedSA := resources.NewServiceAccount(trn.Namespace, name, trn)
+	sa, err := r.serviceAccountLister.ServiceAccounts(trn.Namespace).Get(name)
+	switch {
+	case apierrs.IsNotFound(err):
+		logger.Infof("Creating ServiceAccount %q", name)
+		if _, err := r.kubeClientSet.CoreV1().ServiceAccounts(trn.Namespace).Create(ctx, expectedSA, v1.CreateOptions{}); err != nil {
+			return "", fmt.Errorf("cannot create ServiceAccount: %w", err)
+		}
+	case err != nil:
+		return "", err
+	case !v1.IsControlledBy(sa, trn):
+		return "", &notOwnedError{kind: "ServiceAccount", name: name}
+	}
+
+	expectedRole := resources.NewRole(trn.Namespace, name, trn, rules)
+	role, err := r.roleLister.Roles(trn.Namespace).Get(name)
+	switch {
+	case apierrs.IsNotFound(err):
+		logger.Infof("Creating Role %q", name)
+		if _, err := r.kubeClientSet.RbacV1().Roles(trn.Namespace).Create(ctx, expectedRole, v1.CreateOptions{}); err != nil {
+			return "", fmt.Errorf("cannot create Role: %w", err)
+		}
+	case err != nil:
+		return "", err
+	case !v1.IsControlledBy(role, trn):
+		return "", &notOwnedError{kind: "Role", name: name}
+	case !equality.Semantic.DeepEqual(role.Rules, expectedRole.Rules):
+		role = role.DeepCopy()
+		role.Rules = expectedRole.Rules
+		if _, err := r.kubeClientSet.RbacV1().Roles(trn.Namespace).Update(ctx, role, v1.UpdateOptions{}); err != nil {
+			return "", fmt.Errorf("cannot update Role: %w", err)
+		}
+	}
+
+	expectedRB := resources.NewRoleBinding(trn.Namespace, name, trn)
+	rb, err := r.roleBindingLister.RoleBindings(trn.Namespace).Get(name)
+	switch {
+	case apierrs.IsNotFound(err):
+		logger.Infof("Creating RoleBinding %q", name)
+		if _, err := r.kubeClientSet.RbacV1().RoleBindings(trn.Namespace).Create(ctx, expectedRB, v1.CreateOptions{}); err != nil {
+			return "", fmt.Errorf("cannot create RoleBinding: %w", err)
+		}
+	case err != nil:
+		return "", err
+	case !v1.IsControlledBy(rb, trn):
+		return "", &notOwnedError{kind: "RoleBinding", name: name}
+	case !equality.Semantic.DeepEqual(rb.Subjects, expectedRB.Subjects):
+		rb = rb.DeepCopy()
+		rb.Subjects = expectedRB.Subjects
+		if _, err := r.kubeClientSet.RbacV1().RoleBindings(trn.Namespace).Update(ctx, rb, v1.UpdateOptions{}); err != nil {
+			return "", fmt.Errorf("cannot update RoleBinding: %w", err)
+		}
+	}
+
+	return name, nil
+}
+
+// deleteRBAC removes the adapter RBAC objects owned by the Transformation
+// that no longer has "k8slookup" operations.
+func (r *Reconciler) deleteRBAC(ctx context.Context, trn *transformationv1alpha1.Transformation, name string) error {
+	logger := logging.FromContext(ctx)
+
+	rb, err := r.roleBindingLister.RoleBindings(trn.Namespace).Get(name)
+	switch {
+	case apierrs.IsNotFound(err):
+	case err != nil:
+		return err
+	case v1.IsControlledBy(rb, trn):
+		logger.Infof("Deleting RoleBinding %q", name)
+		err := r.kubeClientSet.RbacV1().RoleBindings(trn.Namespace).Delete(ctx, name, v1.DeleteOptions{})
+		if err != nil && !apierrs.IsNotFound(err) {
+			return fmt.Errorf("cannot delete RoleBinding: %w", err)
+		}
+	}
+
+	role, err := r.roleLister.Roles(trn.Namespace).Get(name)
+	switch {
+	case apierrs.IsNotFound(err):
+	case err != nil:
+		return err
+	case v1.IsControlledBy(role, trn):
+		logger.Infof("Deleting Role %q", name)
+		err := r.kubeClientSet.RbacV1().Roles(trn.Namespace).Delete(ctx, name, v1.DeleteOptions{})
+		if err != nil && !apierrs.IsNotFound(err) {
+			return fmt.Errorf("cannot delete Role: %w", err)
+		}
+	}
+
+	sa, err := r.serviceAccountLister.ServiceAccounts(trn.Namespace).Get(name)
+	switch {
+	case apierrs.IsNotFound(err):
+	case err != nil:
+		return err
+	case v1.IsControlledBy(sa, trn):
+		logger.Infof("Deleting ServiceAccount %q", name)
+		err := r.kubeClientSet.CoreV1().ServiceAccounts(trn.Namespace).Delete(ctx, name, v1.DeleteOptions{})
+		if err != nil && !apierrs.IsNotFound(err) {
+			return fmt.Errorf("cannot delete ServiceAccount: %w", err)
+		}
+	}
+	return nil
+}
+
+// lookupRules returns the rules that allow to get the objects
+// referenced in "k8slookup" operations, grouped by API group.
+// Only the namespaced kinds in LookupKinds can be referenced.
+func (r *Reconciler) lookupRules(ts *transformationv1alpha1.TransformationSpec) ([]rbacv1.PolicyRule, error) {
+	groups := make(map[string]map[string]struct{})
+	for _, transformations := range [][]transformationv1alpha1.Transform{ts.Context, ts.Data} {
+		for _, t := range transformations {
+			if t.K8sLookup == nil {
+				continue
+			}
+			gv, err := schema.ParseGroupVersion(t.K8sLookup.APIVersion)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse k8slookup apiVersion: %w", err)
+			}
+			gk := gv.WithKind(t.K8sLookup.Kind).GroupKind()
+			if !transformationv1alpha1.LookupKinds[gk] {
+				return nil, fmt.Errorf("k8slookup of %s is not allowed", gk)
+			}
+			mapping, err := r.restMapping(gk, gv.Version)
+			if err != nil {
+				return nil, fmt.Errorf("cannot find resource of %s %s: %w", t.K8sLookup.APIVersion, t.K8sLookup.Kind, err)
+			}
+			if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+				return nil, fmt.Errorf("k8slookup of cluster scoped %s is not allowed", gk)
+			}
+			if _, ok := groups[gv.Group]; !ok {
+				groups[gv.Group] = make(map[string]struct{})
+			}
+			groups[gv.Group][mapping.Resource.Resource] = struct{}{}
+		}
+	}
+
+	names := make([]string, 0, len(groups))
+	for group := range groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+
+	rules := make([]rbacv1.PolicyRule, 0, len(groups))
+	for _, group := range names {
+		resources := make([]string, 0, len(groups[group]))
+		for resource := range groups[group] {
+			resources = append(resources, resource)
+		}
+		sort.Strings(resources)
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{group},
+			Resources: resources,
+			Verbs:     []string{"get"},
+		})
+	}
+	return rules, nil
+}
+
+// restMapping returns the resource of the kind. The discovery cache is
+// reset when the kind is not found, so that new CRDs are resolved.
+func (r *Reconciler) restMapping(gk schema.GroupKind, version string) (*meta.RESTMapping, error) {
+	mapping, err := r.restMapper.RESTMapping(gk, version)
+	if meta.IsNoMatchError(err) {
+		if resettable, ok := r.restMapper.(interface{ Reset() }); ok {
+			resettable.Reset()
+			mapping, err = r.restMapper.RESTMapping(gk, version)
+		}
+	}
+	return mapping, err
+}
@@ -18,6 +18,7 @@ package resources
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	network "knative.dev/networking/pkg"
@@ -76,6 +77,79 @@ func EnvVar(name, val string) Option {
 	}
 }
 
+// ConfigMapVolume mounts the ConfigMap into the Container.
+func ConfigMapVolume(name, mountPath string) Option {
+	return func(svc *servingv1.Service) {
+		volumeName := kmeta.ChildName(name, "-configmap")
+		svc.Spec.Template.Spec.Volumes = append(svc.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name: volumeName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: name,
+					},
+				},
+			},
+		})
+		mounts := &firstContainer(svc).VolumeMounts
+		*mounts = append(*mounts, corev1.VolumeMount{
+			Name:      volumeName,
+			MountPath: mountPath,
+			ReadOnly:  true,
+		})
+	}
+}
+
+// BufferVolume mounts the volume of the undelivered events buffer. The
+// PersistentVolumeClaim is used if the claim name is set, emptyDir otherwise.
+func BufferVolume(claimName string, sizeLimit *resource.Quantity, mountPath string) Option {
+	return func(svc *servingv1.Service) {
+		volume := corev1.Volume{Name: "buffer"}
+		if claimName != "" {
+			volume.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: claimName,
+			}
+		} else {
+			volume.EmptyDir = &corev1.EmptyDirVolumeSource{
+				SizeLimit: sizeLimit,
+			}
+		}
+		svc.Spec.Template.Spec.Volumes = append(svc.Spec.Template.Spec.Volumes, volume)
+		mounts := &firstContainer(svc).VolumeMounts
+		*mounts = append(*mounts, corev1.VolumeMount{
+			Name:      volume.Name,
+			MountPath: mountPath,
+		})
+	}
+}
+
+// StateVolume mounts the PersistentVolumeClaim of the state database file.
+func StateVolume(claimName, mountPath string) Option {
+	return func(svc *servingv1.Service) {
+		volume := corev1.Volume{
+			Name: "state",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: claimName,
+				},
+			},
+		}
+		svc.Spec.Template.Spec.Volumes = append(svc.Spec.Template.Spec.Volumes, volume)
+		mounts := &firstContainer(svc).VolumeMounts
+		*mounts = append(*mounts, corev1.VolumeMount{
+			Name:      volume.Name,
+			MountPath: mountPath,
+		})
+	}
+}
+
+// ServiceAccount sets the ServiceAccount the Service runs with.
+func ServiceAccount(name string) Option {
+	return func(svc *servingv1.Service) {
+		svc.Spec.Template.Spec.ServiceAccountName = name
+	}
+}
+
 func Owner(o kmeta.OwnerRefable) Option {
 	return func(svc *servingv1.Service) {
 		svc.SetOwnerReferences([]metav1.OwnerReference{
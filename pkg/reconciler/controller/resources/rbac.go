@@ -0,0 +1,68 @@
+/*
+Copyright (c) 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"knative.dev/pkg/kmeta"
+)
+
+// NewServiceAccount creates a ServiceAccount object for the adapter.
+func NewServiceAccount(ns, name string, owner kmeta.OwnerRefable) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		ObjectMeta: objectMeta(ns, name, owner),
+	}
+}
+
+// NewRole creates a Role object with the given rules.
+func NewRole(ns, name string, owner kmeta.OwnerRefable, rules []rbacv1.PolicyRule) *rbacv1.Role {
+	return &rbacv1.Role{
+		ObjectMeta: objectMeta(ns, name, owner),
+		Rules:      rules,
+	}
+}
+
+// NewRoleBinding creates a RoleBinding object that binds the Role
+// to the ServiceAccount with the same name.
+func NewRoleBinding(ns, name string, owner kmeta.OwnerRefable) *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		ObjectMeta: objectMeta(ns, name, owner),
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     name,
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Namespace: ns,
+			Name:      name,
+		}},
+	}
+}
+
+func objectMeta(ns, name string, owner kmeta.OwnerRefable) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Namespace: ns,
+		Name:      name,
+		OwnerReferences: []metav1.OwnerReference{
+			*kmeta.NewControllerRef(owner),
+		},
+	}
+}
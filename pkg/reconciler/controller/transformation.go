@@ -19,14 +19,22 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"path/filepath"
 	"reflect"
+	"sort"
 
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	rbacv1listers "k8s.io/client-go/listers/rbac/v1"
+
 	"knative.dev/pkg/apis"
 	duckv1 "knative.dev/pkg/apis/duck/v1"
 	"knative.dev/pkg/logging"
@@ -40,13 +48,33 @@ import (
 
 	transformationv1alpha1 "github.com/triggermesh/bumblebee/pkg/apis/transformation/v1alpha1"
 	transformationreconciler "github.com/triggermesh/bumblebee/pkg/client/generated/injection/reconciler/transformation/v1alpha1/transformation"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/configmap"
+	"github.com/triggermesh/bumblebee/pkg/pipeline/common/queue"
 	"github.com/triggermesh/bumblebee/pkg/reconciler/controller/resources"
 )
 
 const (
 	envSink               = "K_SINK"
+	envDeadLetterSink     = "DEAD_LETTER_SINK"
 	envTransformationCtx  = "TRANSFORMATION_CONTEXT"
 	envTransformationData = "TRANSFORMATION_DATA"
+
+	envTransformationEncoding   = "TRANSFORMATION_ENCODING"
+	envTransformationValidation = "TRANSFORMATION_VALIDATION"
+	envTransformationDedup      = "TRANSFORMATION_DEDUPLICATION"
+	envTransformationState      = "TRANSFORMATION_STATE"
+	envTransformationRateLimit  = "TRANSFORMATION_RATELIMIT"
+	envTransformationSampling   = "TRANSFORMATION_SAMPLING"
+	envTransformationDelivery   = "TRANSFORMATION_DELIVERY"
+	envTransformationBuffer     = "TRANSFORMATION_BUFFER"
+	envTransformationOnError    = "TRANSFORMATION_ONERROR"
+	envTransformationLogging    = "TRANSFORMATION_LOGGING"
+
+	envNamespace     = "NAMESPACE"
+	envName          = "NAME"
+	envMetricsConfig = "K_METRICS_CONFIG"
+	envTracingConfig = "K_TRACING_CONFIG"
+	envLoggingConfig = "K_LOGGING_CONFIG"
 )
 
 // newReconciledNormal makes a new reconciler event with event type Normal, and
@@ -66,9 +94,16 @@ type Reconciler struct {
 	knServiceLister  servingv1listers.ServiceLister
 	servingClientSet servingv1client.Interface
 
+	serviceAccountLister corev1listers.ServiceAccountLister
+	roleLister           rbacv1listers.RoleLister
+	roleBindingLister    rbacv1listers.RoleBindingLister
+	kubeClientSet        kubernetes.Interface
+	restMapper           meta.RESTMapper
+
 	sinkResolver *resolver.URIResolver
 
 	transformerImage string
+	observability    *observabilityConfig
 }
 
 // Check that our Reconciler implements Interface
@@ -92,7 +127,12 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, trn *transformationv1alp
 	ksvc, err := r.reconcileKnService(ctx, trn)
 	if err != nil {
 		logger.Error("Error reconciling Kn Service", zap.Error(err))
-		trn.Status.MarkServiceUnavailable(trn.Name)
+		var notOwned *notOwnedError
+		if errors.As(err, &notOwned) {
+			trn.Status.MarkResourceNotOwned(notOwned.kind, notOwned.name)
+		} else {
+			trn.Status.MarkServiceUnavailable(trn.Name)
+		}
 		return err
 	}
 
@@ -116,7 +156,7 @@ func (r *Reconciler) reconcileKnService(ctx context.Context, trn *transformation
 
 	var sink string
 	if trn.Spec.Sink != (duckv1.Destination{}) {
-		uri, err := r.resolveDestination(ctx, trn)
+		uri, err := r.resolveDestination(ctx, trn.Spec.Sink, trn)
 		if err != nil {
 			return nil, fmt.Errorf("cannot resolve Sink destination: %w", err)
 		}
@@ -124,6 +164,17 @@ func (r *Reconciler) reconcileKnService(ctx context.Context, trn *transformation
 		sink = uri.String()
 	}
 
+	var deadLetterSink string
+	trn.Status.DeadLetterSinkURI = nil
+	if trn.Spec.DeadLetterSink != nil {
+		uri, err := r.resolveDestination(ctx, *trn.Spec.DeadLetterSink, trn)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve DeadLetterSink destination: %w", err)
+		}
+		trn.Status.DeadLetterSinkURI = uri
+		deadLetterSink = uri.String()
+	}
+
 	trnContext, err := json.Marshal(trn.Spec.Context)
 	if err != nil {
 		return nil, fmt.Errorf("cannot marshal context transformation spec: %w", err)
@@ -134,14 +185,94 @@ func (r *Reconciler) reconcileKnService(ctx context.Context, trn *transformation
 		return nil, fmt.Errorf("cannot marshal data transformation spec: %w", err)
 	}
 
-	expectedKsvc := resources.NewKnService(trn.Namespace, trn.Name,
+	trnEncoding, err := json.Marshal(trn.Spec.Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal encoding spec: %w", err)
+	}
+
+	trnValidation, err := json.Marshal(trn.Spec.Validation)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal validation spec: %w", err)
+	}
+
+	trnDedup, err := json.Marshal(trn.Spec.Deduplication)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal deduplication spec: %w", err)
+	}
+
+	trnState, err := json.Marshal(trn.Spec.State)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal state spec: %w", err)
+	}
+
+	trnRateLimit, err := json.Marshal(trn.Spec.RateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal rate limit spec: %w", err)
+	}
+
+	trnSampling, err := json.Marshal(trn.Spec.Sampling)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal sampling spec: %w", err)
+	}
+
+	trnDelivery, err := json.Marshal(trn.Spec.Delivery)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal delivery spec: %w", err)
+	}
+
+	trnBuffer, err := json.Marshal(trn.Spec.Buffer)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal buffer spec: %w", err)
+	}
+
+	trnLogging, err := json.Marshal(trn.Spec.Logging)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal logging spec: %w", err)
+	}
+
+	serviceAccount, err := r.reconcileRBAC(ctx, trn)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reconcile adapter RBAC: %w", err)
+	}
+
+	options := []resources.Option{
 		resources.Image(r.transformerImage),
 		resources.EnvVar(envTransformationCtx, string(trnContext)),
 		resources.EnvVar(envTransformationData, string(trnData)),
+		resources.EnvVar(envTransformationEncoding, string(trnEncoding)),
+		resources.EnvVar(envTransformationValidation, string(trnValidation)),
+		resources.EnvVar(envTransformationDedup, string(trnDedup)),
+		resources.EnvVar(envTransformationState, string(trnState)),
+		resources.EnvVar(envTransformationRateLimit, string(trnRateLimit)),
+		resources.EnvVar(envTransformationSampling, string(trnSampling)),
+		resources.EnvVar(envTransformationDelivery, string(trnDelivery)),
+		resources.EnvVar(envTransformationBuffer, string(trnBuffer)),
+		resources.EnvVar(envTransformationOnError, trn.Spec.OnError),
+		resources.EnvVar(envTransformationLogging, string(trnLogging)),
 		resources.EnvVar(envSink, sink),
+		resources.EnvVar(envDeadLetterSink, deadLetterSink),
+		resources.EnvVar(envNamespace, trn.Namespace),
+		resources.EnvVar(envName, trn.Name),
+		resources.EnvVar(envMetricsConfig, r.observability.metricsConfig()),
+		resources.EnvVar(envTracingConfig, r.observability.tracingConfig()),
+		resources.EnvVar(envLoggingConfig, r.observability.loggingConfig()),
 		resources.KsvcLabelVisibilityClusterLocal(),
 		resources.Owner(trn),
-	)
+	}
+	if serviceAccount != "" {
+		options = append(options, resources.ServiceAccount(serviceAccount))
+	}
+	if b := trn.Spec.Buffer; b != nil {
+		options = append(options, resources.BufferVolume(b.PersistentVolumeClaim, b.MaxSize, queue.MountPath))
+	}
+	if s := trn.Spec.State; s != nil && s.PersistentVolumeClaim != "" && s.Path != "" {
+		options = append(options, resources.StateVolume(s.PersistentVolumeClaim, filepath.Dir(s.Path)))
+	}
+	for _, name := range configMapRefs(&trn.Spec) {
+		options = append(options, resources.ConfigMapVolume(name, filepath.Join(configmap.MountPath, name)))
+	}
+
+	expectedKsvc := resources.NewKnService(trn.Namespace, trn.Name, options...)
 
 	ksvc, err := r.knServiceLister.Services(trn.Namespace).Get(trn.Name)
 	if apierrs.IsNotFound(err) {
@@ -181,8 +312,50 @@ func (r *Reconciler) createCloudEventAttributes(ts *transformationv1alpha1.Trans
 	return ceAttributes
 }
 
-func (r *Reconciler) resolveDestination(ctx context.Context, trn *transformationv1alpha1.Transformation) (*apis.URL, error) {
-	dest := trn.Spec.Sink.DeepCopy()
+// configMapRefs returns sorted names of the ConfigMaps referenced in the Transformation spec.
+func configMapRefs(ts *transformationv1alpha1.TransformationSpec) []string {
+	refs := make(map[string]struct{})
+	if e := ts.Encoding; e != nil {
+		if e.Protobuf != nil {
+			refs[e.Protobuf.DescriptorSet.Name] = struct{}{}
+		}
+		if e.Avro != nil {
+			refs[e.Avro.Schema.Name] = struct{}{}
+			if e.Avro.OutputSchema != nil {
+				refs[e.Avro.OutputSchema.Name] = struct{}{}
+			}
+		}
+	}
+	if v := ts.Validation; v != nil {
+		for _, schema := range []*transformationv1alpha1.JSONSchema{v.Input, v.Output} {
+			if schema != nil && schema.ConfigMapKeyRef != nil {
+				refs[schema.ConfigMapKeyRef.Name] = struct{}{}
+			}
+		}
+	}
+	for _, transformations := range [][]transformationv1alpha1.Transform{ts.Context, ts.Data} {
+		for _, t := range transformations {
+			if t.Lookup != nil && t.Lookup.ConfigMapKeyRef != nil {
+				refs[t.Lookup.ConfigMapKeyRef.Name] = struct{}{}
+			}
+			for _, p := range t.Paths {
+				if p.ValueFrom != nil && p.ValueFrom.ConfigMapKeyRef != nil {
+					refs[p.ValueFrom.ConfigMapKeyRef.Name] = struct{}{}
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Reconciler) resolveDestination(ctx context.Context, destination duckv1.Destination, trn *transformationv1alpha1.Transformation) (*apis.URL, error) {
+	dest := destination.DeepCopy()
 	if dest.Ref != nil {
 		if dest.Ref.Namespace == "" {
 			dest.Ref.Namespace = trn.GetNamespace()